@@ -0,0 +1,61 @@
+package analysis
+
+import (
+	ppi "github.com/skaji/go-ppi"
+)
+
+// ClassBuilder recognizes one way of building classes: an OO module such
+// as Moose or Mojo::Base, or the class keyword. CollectInheritance,
+// CollectAccessors and the strict vars check consult every builder in
+// classBuilders, so supporting a new module only takes a new builder.
+type ClassBuilder interface {
+	// Pragmas returns the pragmas, such as "strict" or "signatures", that
+	// the use statement n enables through the builder's module.
+	Pragmas(n *ppi.Node) []string
+	// Parents records the parents and roles the builder declares in doc.
+	Parents(doc *ppi.Document, inh *Inheritance)
+	// Methods returns the methods the builder generates in doc.
+	Methods(doc *ppi.Document) []Accessor
+}
+
+var classBuilders = []ClassBuilder{
+	mooseBuilder{},
+	mojoBaseBuilder{},
+	classAccessorBuilder{},
+	classKeywordBuilder{},
+}
+
+// BuilderPragmas returns the pragmas the use statement n enables through
+// a class builder module.
+func BuilderPragmas(n *ppi.Node) []string {
+	if n == nil || n.Kind != "statement::include" || n.Keyword != "use" {
+		return nil
+	}
+	var out []string
+	for _, b := range classBuilders {
+		out = append(out, b.Pragmas(n)...)
+	}
+	return out
+}
+
+// IsBuilderUse reports whether the use statement n loads a class builder
+// module, such as "use Mojo::Base 'Mojolicious', -signatures". Its
+// arguments are parents and flags, not imported subs.
+func IsBuilderUse(n *ppi.Node) bool {
+	return len(BuilderPragmas(n)) > 0
+}
+
+// usingPackages returns the packages of doc that use one of modules, for
+// builders whose keywords only mean something after such a use.
+func usingPackages(doc *ppi.Document, modules map[string]bool) map[string]bool {
+	out := make(map[string]bool)
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::include" || n.Keyword != "use" || !modules[n.Name] {
+			return
+		}
+		if start, _, ok := nodeTokenRange(n); ok {
+			out[packageOrMain(doc, start)] = true
+		}
+	})
+	return out
+}
@@ -0,0 +1,139 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func builderDoc(src string) *ppi.Document {
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	return doc
+}
+
+func accessorStrings(accs []Accessor) []string {
+	var out []string
+	for _, acc := range accs {
+		out = append(out, acc.Package+" "+acc.Kind+" "+acc.Name+" :SIG("+acc.Sig+")")
+	}
+	return out
+}
+
+func TestMojoBaseBuilder(t *testing.T) {
+	src := `package App::User;
+use Mojo::Base 'App::Model', -signatures;
+has name => sub { 'anon' };
+has [qw(age email)];
+sub greet ($self) { $nobody }
+package App::Model;
+use Mojo::Base -base;
+has 'db';
+package App::Util;
+use Mojo::Base -strict;
+has ignored => 1;
+`
+	doc := builderDoc(src)
+	want := []string{
+		"App::User accessor name :SIG((any, any?) -> any)",
+		"App::User accessor age :SIG((any, any?) -> any)",
+		"App::User accessor email :SIG((any, any?) -> any)",
+		"App::Model accessor db :SIG((any, any?) -> any)",
+	}
+	if got := accessorStrings(CollectAccessors(doc)); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	parents := CollectInheritance(doc).Parents
+	if !reflect.DeepEqual(parents["App::User"], []string{"App::Model"}) || !reflect.DeepEqual(parents["App::Model"], []string{"Mojo::Base"}) {
+		t.Fatalf("unexpected parents: %v", parents)
+	}
+	if _, ok := parents["App::Util"]; ok {
+		t.Fatalf("-strict should not set a parent: %v", parents)
+	}
+	var use *ppi.Node
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if use == nil && n.Kind == "statement::include" {
+			use = n
+		}
+	})
+	if got := BuilderPragmas(use); !reflect.DeepEqual(got, []string{"strict", "warnings", "utf8", ":5.16", "signatures"}) {
+		t.Fatalf("unexpected pragmas: %v", got)
+	}
+	diags := StrictVarDiagnostics(doc)
+	if len(diags) != 1 || diags[0].Message != "use strict vars: variable $nobody is not declared" {
+		t.Fatalf("Mojo::Base should enable strict: %+v", diags)
+	}
+}
+
+func TestClassAccessorBuilder(t *testing.T) {
+	src := `package Legacy;
+use base 'Class::Accessor::Fast';
+__PACKAGE__->mk_accessors(qw(host port));
+__PACKAGE__->mk_ro_accessors('id');
+package Legacy::Strict;
+use base 'Class::Accessor';
+__PACKAGE__->follow_best_practice;
+__PACKAGE__->mk_accessors('name');
+Legacy->mk_wo_accessors('secret');
+`
+	doc := builderDoc(src)
+	want := []string{
+		"Legacy accessor host :SIG((any, any?) -> any)",
+		"Legacy accessor port :SIG((any, any?) -> any)",
+		"Legacy reader id :SIG(any -> any)",
+		"Legacy::Strict reader get_name :SIG(any -> any)",
+		"Legacy::Strict writer set_name :SIG((any, any) -> any)",
+		"Legacy writer secret :SIG((any, any) -> any)",
+	}
+	accs := CollectAccessors(doc)
+	if got := accessorStrings(accs); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if name := src[accs[1].Start:accs[1].End]; name != "port" {
+		t.Fatalf("unexpected name range %q", name)
+	}
+}
+
+func TestObjectPadBuilder(t *testing.T) {
+	src := `use strict;
+use Object::Pad;
+class Counter 0.01 isa Base does Role::Count {
+    has $count :reader = 0;
+    method inc { $count++; $missing }
+}
+`
+	doc := builderDoc(src)
+	classes := CollectClasses(doc)
+	if len(classes) != 1 || classes[0].Parent != "Base" || !reflect.DeepEqual(classes[0].Roles, []string{"Role::Count"}) {
+		t.Fatalf("unexpected classes: %+v", classes)
+	}
+	if len(classes[0].Fields) != 1 || classes[0].Fields[0].Keyword != "has" || classes[0].Fields[0].Reader != "count" {
+		t.Fatalf("unexpected fields: %+v", classes[0].Fields)
+	}
+	if parents := CollectInheritance(doc).Parents["Counter"]; !reflect.DeepEqual(parents, []string{"Base", "Role::Count"}) {
+		t.Fatalf("unexpected parents: %v", parents)
+	}
+	accs := CollectAccessors(doc)
+	if len(accs) != 2 || accs[0].Name != "count" || accs[0].Decl != "has $count :reader" {
+		t.Fatalf("unexpected accessors: %+v", accs)
+	}
+	diags := StrictVarDiagnostics(doc)
+	if len(diags) != 1 || diags[0].Message != "use strict vars: variable $missing is not declared" {
+		t.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+
+	// Without Object::Pad, has is not a field keyword of a class.
+	doc = builderDoc("use v5.38;\nuse experimental 'class';\nclass Plain {\n    has $x;\n}\n")
+	if classes := CollectClasses(doc); len(classes) != 1 || len(classes[0].Fields) != 0 {
+		t.Fatalf("unexpected classes: %+v", classes)
+	}
+}
+
+func TestMooseBuilderEnablesStrict(t *testing.T) {
+	doc := builderDoc("package Person;\nuse Moo;\nsub greet { $who }\n")
+	diags := StrictVarDiagnostics(doc)
+	if len(diags) != 1 || diags[0].Message != "use strict vars: variable $who is not declared" {
+		t.Fatalf("Moo should enable strict: %+v", diags)
+	}
+}
@@ -0,0 +1,511 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// ClassDecl is a class declared with the class feature of Perl 5.38:
+// "class Name VERSION :isa(Parent) { ... }" or the statement form
+// "class Name;". go-ppi does not parse these, so they are read from the
+// tokens. Object::Pad classes share the syntax, and may also declare
+// fields with "has", the parent with "isa Parent" or "extends Parent",
+// and roles with :does(Role).
+type ClassDecl struct {
+	Name    string
+	Version string
+	Parent  string
+	Roles   []string
+	// Start and End span the class name.
+	Start int
+	End   int
+	// ScopeStart and ScopeEnd delimit the code the class is in effect for:
+	// its block, or up to the next package or class statement.
+	ScopeStart int
+	ScopeEnd   int
+	Fields     []ClassField
+	Methods    []ClassMethod
+	// Adjust holds the ADJUST blocks, named "ADJUST".
+	Adjust []ClassMethod
+}
+
+// ClassField is a field declaration of a class.
+type ClassField struct {
+	// Name is the variable name, including the sigil.
+	Name string
+	// Keyword is "field", or "has" in an Object::Pad class.
+	Keyword string
+	Start   int
+	End     int
+	// Offset is the start of the field keyword.
+	Offset int
+	// Param is the constructor argument that initializes the field, set
+	// for :param.
+	Param string
+	// Reader is the name of the reader method generated by :reader.
+	Reader string
+}
+
+// ClassMethod is a method declaration or an ADJUST block of a class.
+type ClassMethod struct {
+	Name string
+	// Start and End span the method name.
+	Start int
+	End   int
+	// BodyStart is the start of the method keyword and BodyEnd the end of
+	// the closing brace.
+	BodyStart int
+	BodyEnd   int
+	// Params holds the signature variables, with their positions.
+	Params []Symbol
+}
+
+// CollectClasses returns the classes declared in doc.
+func CollectClasses(doc *ppi.Document) []ClassDecl {
+	if doc == nil {
+		return nil
+	}
+	tokens := doc.Tokens
+	objectPad := hasUseModule(doc.Root, "Object::Pad")
+	var out []ClassDecl
+	for i := range tokens {
+		if tokens[i].Type != ppi.TokenWord || tokens[i].Value != "class" || !atStatementStart(tokens, i) {
+			continue
+		}
+		if class, ok := parseClass(doc, i, objectPad); ok {
+			out = append(out, class)
+		}
+	}
+	return out
+}
+
+// ClassAt returns the innermost class in effect at offset.
+func ClassAt(classes []ClassDecl, offset int) (ClassDecl, bool) {
+	var found ClassDecl
+	ok := false
+	for _, class := range classes {
+		if offset < class.ScopeStart || offset >= class.ScopeEnd {
+			continue
+		}
+		if !ok || class.ScopeStart >= found.ScopeStart {
+			found = class
+			ok = true
+		}
+	}
+	return found, ok
+}
+
+// PackageDecl is a "package NAME;" statement.
+type PackageDecl struct {
+	Name string
+	// Start and End span the package name.
+	Start int
+	End   int
+	// Offset is the start of the package keyword.
+	Offset int
+}
+
+// StrayPackages returns the package statements that go-ppi folds into the
+// statement before them, which happens after the closing brace of a class
+// block.
+func StrayPackages(doc *ppi.Document) []PackageDecl {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	parsed := make(map[int]struct{})
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n != nil && n.Kind == "statement::package" && len(n.Tokens) > 0 {
+			parsed[n.Tokens[0].Start] = struct{}{}
+		}
+	})
+	tokens := doc.Tokens
+	var out []PackageDecl
+	for i, tok := range tokens {
+		if tok.Type != ppi.TokenWord || tok.Value != "package" || !atStatementStart(tokens, i) {
+			continue
+		}
+		if _, ok := parsed[tok.Start]; ok {
+			continue
+		}
+		name := nextNonTrivia(tokens, i+1)
+		if name < 0 || tokens[name].Type != ppi.TokenWord || !isClassName(tokens[name].Value) {
+			continue
+		}
+		if semi := nextNonTrivia(tokens, name+1); semi < 0 || tokens[semi].Type != ppi.TokenOperator || tokens[semi].Value != ";" {
+			continue
+		}
+		out = append(out, PackageDecl{Name: tokens[name].Value, Start: tokens[name].Start, End: tokens[name].End, Offset: tok.Start})
+	}
+	return out
+}
+
+// PackageLookup returns a function that reports the package in effect at
+// an offset like ppi.Document.PackageAt, taking classes and the package
+// statements that follow them into account.
+func PackageLookup(doc *ppi.Document) func(offset int) string {
+	classes := CollectClasses(doc)
+	strays := StrayPackages(doc)
+	var parsed []int
+	if doc != nil && doc.Root != nil {
+		walkNodes(doc.Root, func(n *ppi.Node) {
+			if n != nil && n.Kind == "statement::package" && len(n.Tokens) > 0 {
+				parsed = append(parsed, n.Tokens[0].Start)
+			}
+		})
+	}
+	return func(offset int) string {
+		if class, ok := ClassAt(classes, offset); ok {
+			return class.Name
+		}
+		var stray *PackageDecl
+		for i := range strays {
+			if strays[i].Offset <= offset {
+				stray = &strays[i]
+			}
+		}
+		if stray != nil {
+			later := false
+			for _, start := range parsed {
+				if start > stray.Offset && start <= offset {
+					later = true
+				}
+			}
+			if !later {
+				return stray.Name
+			}
+		}
+		return doc.PackageAt(offset)
+	}
+}
+
+// atStatementStart reports whether tokens[idx] begins a statement.
+func atStatementStart(tokens []ppi.Token, idx int) bool {
+	prev := prevNonTrivia(tokens, idx-1)
+	if prev < 0 {
+		return true
+	}
+	tok := tokens[prev]
+	return tok.Type == ppi.TokenOperator && (tok.Value == ";" || tok.Value == "{" || tok.Value == "}")
+}
+
+func parseClass(doc *ppi.Document, idx int, objectPad bool) (ClassDecl, bool) {
+	tokens := doc.Tokens
+	pos := nextNonTrivia(tokens, idx+1)
+	if pos < 0 || tokens[pos].Type != ppi.TokenWord || !isClassName(tokens[pos].Value) {
+		return ClassDecl{}, false
+	}
+	class := ClassDecl{Name: tokens[pos].Value, Start: tokens[pos].Start, End: tokens[pos].End}
+	pos = nextNonTrivia(tokens, pos+1)
+	if pos >= 0 && tokens[pos].Type == ppi.TokenNumber {
+		class.Version = tokens[pos].Value
+		pos = nextNonTrivia(tokens, pos+1)
+	}
+attrs:
+	for pos >= 0 {
+		tok := tokens[pos]
+		switch {
+		case tok.Type == ppi.TokenOperator && tok.Value == ":":
+		case tok.Type == ppi.TokenAttribute:
+			name, arg := splitAttribute(tok.Value)
+			fields := strings.Fields(arg)
+			switch {
+			case name == "isa" && len(fields) > 0 && isClassName(fields[0]):
+				class.Parent = fields[0]
+			case name == "does":
+				for _, role := range fields {
+					if isClassName(role) {
+						class.Roles = append(class.Roles, role)
+					}
+				}
+			}
+		case objectPad && tok.Type == ppi.TokenWord && (tok.Value == "isa" || tok.Value == "extends" || tok.Value == "does"):
+			next := nextNonTrivia(tokens, pos+1)
+			if next < 0 || tokens[next].Type != ppi.TokenWord || !isClassName(tokens[next].Value) {
+				return ClassDecl{}, false
+			}
+			if tok.Value == "does" {
+				class.Roles = append(class.Roles, tokens[next].Value)
+			} else {
+				class.Parent = tokens[next].Value
+			}
+			pos = next
+		default:
+			break attrs
+		}
+		pos = nextNonTrivia(tokens, pos+1)
+	}
+	if pos < 0 || tokens[pos].Type != ppi.TokenOperator {
+		return ClassDecl{}, false
+	}
+	var bodyStart, bodyEnd int
+	switch tokens[pos].Value {
+	case "{":
+		closeIdx := matchBrace(tokens, pos)
+		if closeIdx < 0 {
+			closeIdx = len(tokens) - 1
+		}
+		class.ScopeStart = tokens[pos].Start
+		class.ScopeEnd = tokens[closeIdx].End
+		bodyStart, bodyEnd = pos+1, closeIdx
+	case ";":
+		class.ScopeStart = tokens[pos].End
+		class.ScopeEnd = len(doc.Source)
+		bodyStart, bodyEnd = pos+1, len(tokens)
+		depth := 0
+	scan:
+		for i := pos + 1; i < len(tokens); i++ {
+			tok := tokens[i]
+			switch {
+			case tok.Type == ppi.TokenOperator && tok.Value == "{":
+				depth++
+			case tok.Type == ppi.TokenOperator && tok.Value == "}":
+				depth--
+				if depth < 0 {
+					class.ScopeEnd, bodyEnd = tok.Start, i
+					break scan
+				}
+			case depth == 0 && tok.Type == ppi.TokenWord && (tok.Value == "package" || tok.Value == "class") && atStatementStart(tokens, i):
+				class.ScopeEnd, bodyEnd = tok.Start, i
+				break scan
+			}
+		}
+	default:
+		return ClassDecl{}, false
+	}
+	collectClassMembers(doc, &class, bodyStart, bodyEnd, objectPad)
+	return class, true
+}
+
+// collectClassMembers reads the fields, methods and ADJUST blocks written
+// directly in tokens[start:end]. Object::Pad also declares fields with has.
+func collectClassMembers(doc *ppi.Document, class *ClassDecl, start, end int, objectPad bool) {
+	tokens := doc.Tokens
+	depth := 0
+	for i := start; i < end; i++ {
+		tok := tokens[i]
+		if tok.Type == ppi.TokenOperator {
+			switch tok.Value {
+			case "{":
+				depth++
+			case "}":
+				depth--
+			}
+			continue
+		}
+		if depth != 0 || tok.Type != ppi.TokenWord || !atStatementStart(tokens, i) {
+			continue
+		}
+		switch tok.Value {
+		case "field", "has":
+			if tok.Value == "has" && !objectPad {
+				continue
+			}
+			if field, ok := parseField(tokens, i); ok {
+				class.Fields = append(class.Fields, field)
+			}
+		case "method":
+			if method, next, ok := parseMethod(tokens, i); ok {
+				class.Methods = append(class.Methods, method)
+				i = next
+			}
+		case "ADJUST":
+			open := nextNonTrivia(tokens, i+1)
+			closeIdx := matchBrace(tokens, open)
+			if closeIdx < 0 {
+				continue
+			}
+			class.Adjust = append(class.Adjust, ClassMethod{
+				Name:      "ADJUST",
+				Start:     tok.Start,
+				End:       tok.End,
+				BodyStart: tok.Start,
+				BodyEnd:   tokens[closeIdx].End,
+			})
+			i = closeIdx
+		}
+	}
+}
+
+func parseField(tokens []ppi.Token, idx int) (ClassField, bool) {
+	pos := nextNonTrivia(tokens, idx+1)
+	if pos < 0 || tokens[pos].Type != ppi.TokenSymbol || len(tokens[pos].Value) < 2 {
+		return ClassField{}, false
+	}
+	field := ClassField{Name: tokens[pos].Value, Keyword: tokens[idx].Value, Start: tokens[pos].Start, End: tokens[pos].End, Offset: tokens[idx].Start}
+	bare := field.Name[1:]
+	for pos = nextNonTrivia(tokens, pos+1); pos >= 0; pos = nextNonTrivia(tokens, pos+1) {
+		tok := tokens[pos]
+		if tok.Type == ppi.TokenOperator && tok.Value == ":" {
+			continue
+		}
+		if tok.Type != ppi.TokenAttribute {
+			break
+		}
+		name, arg := splitAttribute(tok.Value)
+		if arg == "" {
+			arg = bare
+		}
+		switch name {
+		case "param":
+			field.Param = arg
+		case "reader":
+			field.Reader = arg
+		}
+	}
+	return field, true
+}
+
+func parseMethod(tokens []ppi.Token, idx int) (ClassMethod, int, bool) {
+	pos := nextNonTrivia(tokens, idx+1)
+	if pos < 0 || tokens[pos].Type != ppi.TokenWord || !isIdent(tokens[pos].Value) {
+		return ClassMethod{}, idx, false
+	}
+	method := ClassMethod{Name: tokens[pos].Value, Start: tokens[pos].Start, End: tokens[pos].End, BodyStart: tokens[idx].Start}
+	pos = nextNonTrivia(tokens, pos+1)
+	if pos >= 0 && tokens[pos].Type == ppi.TokenPrototype {
+		for _, name := range signatureVarsFromPrototype(tokens[pos].Value) {
+			offset := tokens[pos].Start + strings.Index(tokens[pos].Value, name)
+			method.Params = append(method.Params, Symbol{Name: name, Kind: SymbolVar, Storage: "my", Start: offset, End: offset + len(name)})
+		}
+		pos = nextNonTrivia(tokens, pos+1)
+	} else if pos >= 0 && tokens[pos].Type == ppi.TokenOperator && tokens[pos].Value == "(" {
+		depth := 0
+		for ; pos < len(tokens); pos++ {
+			tok := tokens[pos]
+			if tok.Type == ppi.TokenOperator && tok.Value == "(" {
+				depth++
+			}
+			if tok.Type == ppi.TokenOperator && tok.Value == ")" {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+			if tok.Type == ppi.TokenSymbol && depth == 1 && len(tok.Value) > 1 {
+				method.Params = append(method.Params, Symbol{Name: tok.Value, Kind: SymbolVar, Storage: "my", Start: tok.Start, End: tok.End})
+			}
+		}
+		pos = nextNonTrivia(tokens, pos+1)
+	}
+	closeIdx := matchBrace(tokens, pos)
+	if closeIdx < 0 {
+		return ClassMethod{}, idx, false
+	}
+	method.BodyEnd = tokens[closeIdx].End
+	return method, closeIdx, true
+}
+
+// splitAttribute splits an attribute such as "isa(Base)" into its name and
+// argument.
+func splitAttribute(value string) (string, string) {
+	name, arg, ok := strings.Cut(value, "(")
+	if !ok {
+		return value, ""
+	}
+	return name, strings.TrimSpace(strings.TrimSuffix(arg, ")"))
+}
+
+// classScopes returns the scopes of class blocks and of methods and ADJUST
+// blocks, where fields and $self are visible.
+func classScopes(classes []ClassDecl) []*Scope {
+	var scopes []*Scope
+	for _, class := range classes {
+		scopes = append(scopes, &Scope{Kind: "class", Start: class.ScopeStart, End: class.ScopeEnd})
+		for _, method := range append(append([]ClassMethod(nil), class.Methods...), class.Adjust...) {
+			scopes = append(scopes, &Scope{Kind: "sub", Start: method.BodyStart, End: method.BodyEnd})
+		}
+	}
+	return scopes
+}
+
+// collectClassVars declares fields in their class scope, and $self and the
+// signature variables in each method and ADJUST block.
+func collectClassVars(classes []ClassDecl, root *Scope) {
+	for _, class := range classes {
+		scope := findScopeByRange(root, "class", class.ScopeStart)
+		if scope == nil {
+			continue
+		}
+		for _, field := range class.Fields {
+			scope.Symbols = append(scope.Symbols, Symbol{Name: field.Name, Kind: SymbolVar, Storage: "field", Start: field.Start, End: field.End})
+		}
+		for _, method := range append(append([]ClassMethod(nil), class.Methods...), class.Adjust...) {
+			body := findScopeByRange(root, "sub", method.BodyStart)
+			if body == nil {
+				continue
+			}
+			addSigVar(body, method.BodyStart, "$self")
+			addReceiver(body, "$self")
+			for _, param := range method.Params {
+				addSigVarWithRange(body, param.Start, param.End, param.Name)
+			}
+		}
+	}
+}
+
+// classKeywordBuilder is the class builder of the class keyword, of the
+// class feature and of Object::Pad.
+type classKeywordBuilder struct{}
+
+func (classKeywordBuilder) Pragmas(*ppi.Node) []string {
+	return nil
+}
+
+func (classKeywordBuilder) Parents(doc *ppi.Document, inh *Inheritance) {
+	for _, class := range CollectClasses(doc) {
+		if class.Parent != "" {
+			inh.set(class.Name, []string{class.Parent})
+		}
+		inh.Roles[class.Name] = append(inh.Roles[class.Name], class.Roles...)
+	}
+}
+
+func (classKeywordBuilder) Methods(doc *ppi.Document) []Accessor {
+	return classAccessors(doc, CollectClasses(doc))
+}
+
+// classAccessors returns the methods generated for a class: a reader for
+// each :reader field and the constructor new.
+func classAccessors(doc *ppi.Document, classes []ClassDecl) []Accessor {
+	var out []Accessor
+	for _, class := range classes {
+		var params []string
+		for _, field := range class.Fields {
+			if field.Param != "" {
+				params = append(params, field.Param+" => ...")
+			}
+			if field.Reader == "" {
+				continue
+			}
+			t := "any"
+			if sig := sigCommentBeforeOffset(doc.Source, field.Offset); sig != "" {
+				t = sig
+			}
+			ret := t
+			if !strings.HasPrefix(field.Name, "$") {
+				ret = "...any"
+			}
+			out = append(out, Accessor{
+				Package:   class.Name,
+				Name:      field.Reader,
+				Attribute: field.Name,
+				Kind:      "reader",
+				Sig:       "any -> " + ret,
+				Decl:      field.Keyword + " " + field.Name + " :reader",
+				Start:     field.Start,
+				End:       field.End,
+			})
+		}
+		out = append(out, Accessor{
+			Package: class.Name,
+			Name:    "new",
+			Kind:    "constructor",
+			Sig:     "(any, ...any) -> " + class.Name,
+			Decl:    class.Name + "->new(" + strings.Join(params, ", ") + ")",
+			Start:   class.Start,
+			End:     class.End,
+		})
+	}
+	return out
+}
@@ -0,0 +1,133 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+const classSrc = `use v5.38;
+use experimental 'class';
+class Point 1.0 :isa(Shape) {
+    field $x :param :reader;
+    # :SIG(int)
+    field $y :param(why) :reader(get_y) = 0;
+    field @history;
+    # :SIG((Point, int) -> int)
+    method move ($dx) {
+        push @history, $x;
+        $x += $dx;
+        return $self->get_y;
+    }
+    ADJUST {
+        $x //= $y;
+    }
+}
+class Point3D;
+field $z;
+method depth { return $z + $undeclared; }
+package main;
+# :SIG(Point)
+my $p = Point->new(x => 1);
+$p->move("far");
+`
+
+func parseClassSrc(t *testing.T) *ppi.Document {
+	t.Helper()
+	doc := ppi.NewDocument(classSrc)
+	doc.ParseWithDiagnostics()
+	return doc
+}
+
+func TestCollectClasses(t *testing.T) {
+	doc := parseClassSrc(t)
+	classes := CollectClasses(doc)
+	if len(classes) != 2 {
+		t.Fatalf("expected 2 classes, got %+v", classes)
+	}
+	point := classes[0]
+	if point.Name != "Point" || point.Version != "1.0" || point.Parent != "Shape" {
+		t.Fatalf("unexpected class: %+v", point)
+	}
+	var fields []string
+	for _, f := range point.Fields {
+		fields = append(fields, f.Name+" "+f.Param+" "+f.Reader)
+	}
+	if want := []string{"$x x x", "$y why get_y", "@history  "}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("unexpected fields: %q", fields)
+	}
+	if len(point.Methods) != 1 || point.Methods[0].Name != "move" || len(point.Methods[0].Params) != 1 || point.Methods[0].Params[0].Name != "$dx" {
+		t.Fatalf("unexpected methods: %+v", point.Methods)
+	}
+	if len(point.Adjust) != 1 {
+		t.Fatalf("expected one ADJUST block, got %+v", point.Adjust)
+	}
+	lookup := PackageLookup(doc)
+	for text, want := range map[string]string{"$dx;": "Point", "$z +": "Point3D", "my $p": "main"} {
+		if got := lookup(indexOf(t, classSrc, text)); got != want {
+			t.Fatalf("package at %q: expected %q, got %q", text, want, got)
+		}
+	}
+	if parents := CollectInheritance(doc).Parents["Point"]; !reflect.DeepEqual(parents, []string{"Shape"}) {
+		t.Fatalf("unexpected parents: %v", parents)
+	}
+}
+
+func TestPackageLookupAfterClassBlock(t *testing.T) {
+	src := "class Counter {\n    method inc { 1 }\n}\npackage Other;\nsub helper { 1 }\n"
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	strays := StrayPackages(doc)
+	if len(strays) != 1 || strays[0].Name != "Other" || strays[0].Start != indexOf(t, src, "Other") {
+		t.Fatalf("unexpected stray packages: %+v", strays)
+	}
+	lookup := PackageLookup(doc)
+	for text, want := range map[string]string{"inc": "Counter", "helper": "Other"} {
+		if got := lookup(indexOf(t, src, text)); got != want {
+			t.Fatalf("package at %q: expected %q, got %q", text, want, got)
+		}
+	}
+}
+
+func TestStrictVarDiagnosticsClass(t *testing.T) {
+	doc := parseClassSrc(t)
+	diags := StrictVarDiagnostics(doc)
+	if len(diags) != 1 || diags[0].Message != "use strict vars: variable $undeclared is not declared" {
+		t.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+}
+
+func TestClassAccessors(t *testing.T) {
+	doc := parseClassSrc(t)
+	var got []string
+	for _, acc := range CollectAccessors(doc) {
+		got = append(got, acc.Package+"->"+acc.Name+" :SIG("+acc.Sig+") "+acc.Decl)
+	}
+	want := []string{
+		"Point->x :SIG(any -> any) field $x :reader",
+		"Point->get_y :SIG(any -> int) field $y :reader",
+		"Point->new :SIG((any, ...any) -> Point) Point->new(x => ..., why => ...)",
+		"Point3D->new :SIG((any, ...any) -> Point3D) Point3D->new()",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+	var msgs []string
+	for _, d := range SigCallDiagnostics(doc) {
+		msgs = append(msgs, d.Message)
+	}
+	if want := []string{"arg 1 of Point->move: expected int, got str"}; !reflect.DeepEqual(msgs, want) {
+		t.Fatalf("expected %q, got %q", want, msgs)
+	}
+}
+
+func indexOf(t *testing.T, s, sub string) int {
+	t.Helper()
+	i := strings.Index(s, sub)
+	if i < 0 {
+		t.Fatalf("%q not found", sub)
+	}
+	return i
+}
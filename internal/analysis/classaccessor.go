@@ -0,0 +1,81 @@
+package analysis
+
+import (
+	ppi "github.com/skaji/go-ppi"
+)
+
+// classAccessorKinds maps the Class::Accessor (and ::Fast, ::Faster)
+// generator methods to the kind of accessor they make.
+var classAccessorKinds = map[string]string{
+	"mk_accessors":    "accessor",
+	"mk_rw_accessors": "accessor",
+	"mk_ro_accessors": "reader",
+	"mk_wo_accessors": "writer",
+}
+
+// classAccessorBuilder is the class builder of Class::Accessor:
+// "__PACKAGE__->mk_accessors(qw(a b))" or "Class->mk_ro_accessors('a')".
+// After "__PACKAGE__->follow_best_practice" the accessors are named get_a
+// and set_a. Class::Accessor is inherited with "use base", so the builder
+// adds no parents.
+type classAccessorBuilder struct{}
+
+func (classAccessorBuilder) Pragmas(*ppi.Node) []string {
+	return nil
+}
+
+func (classAccessorBuilder) Parents(*ppi.Document, *Inheritance) {}
+
+func (classAccessorBuilder) Methods(doc *ppi.Document) []Accessor {
+	bestPractice := make(map[string]bool)
+	var out []Accessor
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::expression" {
+			return
+		}
+		ts := significantTokens(n.Tokens)
+		if len(ts) < 3 || ts[0].Type != ppi.TokenWord || ts[1].Type != ppi.TokenOperator || ts[1].Value != "->" || ts[2].Type != ppi.TokenWord {
+			return
+		}
+		pkg := ts[0].Value
+		if pkg == "__PACKAGE__" {
+			pkg = packageOrMain(doc, ts[0].Start)
+		} else if !isClassName(pkg) {
+			return
+		}
+		if ts[2].Value == "follow_best_practice" {
+			bestPractice[pkg] = true
+			return
+		}
+		kind, ok := classAccessorKinds[ts[2].Value]
+		if !ok {
+			return
+		}
+		call := ts[0].Value + "->" + ts[2].Value
+		for _, attr := range listAttrNames(ts[3:]) {
+			for _, m := range classAccessorMethods(attr.name, kind, bestPractice[pkg]) {
+				m.Package = pkg
+				m.Attribute = attr.name
+				m.Decl = call + "('" + attr.name + "')"
+				m.Start = attr.start
+				m.End = attr.end
+				out = append(out, m)
+			}
+		}
+	})
+	return out
+}
+
+func classAccessorMethods(name, kind string, bestPractice bool) []Accessor {
+	if !bestPractice {
+		return []Accessor{{Name: name, Kind: kind, Sig: accessorSig(kind, "any")}}
+	}
+	var out []Accessor
+	if kind != "writer" {
+		out = append(out, Accessor{Name: "get_" + name, Kind: "reader", Sig: accessorSig("reader", "any")})
+	}
+	if kind != "reader" {
+		out = append(out, Accessor{Name: "set_" + name, Kind: "writer", Sig: accessorSig("writer", "any")})
+	}
+	return out
+}
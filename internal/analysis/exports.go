@@ -61,6 +61,65 @@ func ExportedSymbols(doc *ppi.Document) map[string]struct{} {
 	return out
 }
 
+// exporterModules build import methods of their own, so the subs a module
+// using them exports by default cannot be read from @EXPORT.
+var exporterModules = map[string]bool{
+	"Moose::Exporter": true, "Sub::Exporter": true, "Sub::Exporter::Progressive": true, "Import::Into": true,
+}
+
+// ExportedSubs returns the subs a module exports by default through
+// "our @EXPORT = qw(...)" or a list of quoted names. ok is false when the
+// default exports cannot be known: the module defines its own import, uses
+// an exporter module other than Exporter, or fills @EXPORT some other way.
+func ExportedSubs(doc *ppi.Document) (map[string]struct{}, bool) {
+	if doc == nil || doc.Root == nil {
+		return nil, false
+	}
+	out := make(map[string]struct{})
+	ok := true
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if !ok || n == nil || n.Type != ppi.NodeStatement {
+			return
+		}
+		switch {
+		case n.Kind == "statement::sub" && n.Name == "import":
+			ok = false
+			return
+		case n.Kind == "statement::include" && exporterModules[n.Name]:
+			ok = false
+			return
+		}
+		ts := significantTokens(n.Tokens)
+		for i, tok := range ts {
+			if tok.Type != ppi.TokenSymbol || !isExportArraySymbol(tok.Value) {
+				continue
+			}
+			if (i > 1 || (i == 1 && ts[0].Value != "our")) || i+2 >= len(ts) || ts[i+1].Value != "=" {
+				ok = false
+				return
+			}
+			for _, item := range ts[i+2:] {
+				switch {
+				case item.Type == ppi.TokenQuoteLike:
+					for _, name := range splitQW(item.Value) {
+						out[strings.TrimPrefix(name, "&")] = struct{}{}
+					}
+				case item.Type == ppi.TokenQuote:
+					out[strings.TrimPrefix(unquote(item.Value), "&")] = struct{}{}
+				case item.Type == ppi.TokenOperator && (item.Value == "(" || item.Value == ")" || item.Value == "," || item.Value == ";"):
+				default:
+					ok = false
+					return
+				}
+			}
+		}
+	})
+	if !ok {
+		return nil, false
+	}
+	return out, true
+}
+
 func splitQW(value string) []string {
 	if !strings.HasPrefix(value, "qw") || len(value) < 3 {
 		return nil
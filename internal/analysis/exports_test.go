@@ -1,6 +1,8 @@
 package analysis
 
 import (
+	"sort"
+	"strings"
 	"testing"
 
 	ppi "github.com/skaji/go-ppi"
@@ -33,3 +35,30 @@ func TestExportedSymbolsPackageExport(t *testing.T) {
 		t.Fatalf("missing export %%Config")
 	}
 }
+
+func TestExportedSubs(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want []string
+		ok   bool
+	}{
+		{"package Foo;\nour @EXPORT = qw(foo &bar);\nour @EXPORT_OK = qw(baz);\n", []string{"bar", "foo"}, true},
+		{"package Foo;\n@EXPORT = ('foo', 'bar');\n", []string{"bar", "foo"}, true},
+		{"package Foo;\nsub foo { 1 }\n", nil, true},
+		{"package Foo;\nour @EXPORT = qw(foo);\npush @EXPORT, 'bar';\n", nil, false},
+		{"package Foo;\nsub import { 1 }\n", nil, false},
+		{"package Foo;\nuse Moose::Exporter;\n", nil, false},
+	} {
+		doc := ppi.NewDocument(tc.src)
+		doc.ParseWithDiagnostics()
+		exports, ok := ExportedSubs(doc)
+		var got []string
+		for name := range exports {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if ok != tc.ok || strings.Join(got, ",") != strings.Join(tc.want, ",") {
+			t.Fatalf("%q: expected %v %v, got %v %v", tc.src, tc.want, tc.ok, got, ok)
+		}
+	}
+}
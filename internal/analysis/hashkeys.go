@@ -0,0 +1,580 @@
+package analysis
+
+import (
+	"sort"
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// HashKeyTypo is a literal key read from a lexical hash or hashref that is
+// never written to it, and is close to a key that is.
+type HashKeyTypo struct {
+	// Var is the hash, "%cfg", or the variable holding the hashref, "$cfg".
+	Var        string
+	Key        string
+	Suggestion string
+	Start      int
+	End        int
+}
+
+// hashKeySet collects the keys written to one declared hash. A hash is open
+// when keys may be written that are not seen: its contents come from
+// elsewhere, a key is computed, or a reference to it escapes. A hashref
+// with a :SIG shape is never open, as the shape declares its keys.
+type hashKeySet struct {
+	name    string
+	written map[string]bool
+	open    bool
+	shape   bool
+	reads   []hashKeyRead
+}
+
+type hashKeyRead struct {
+	key        string
+	start, end int
+}
+
+// HashKeyTypos returns the reads of keys of lexical hashes and hashrefs
+// that are never written to them, such as $cfg{hsot} when %cfg only gets
+// host and port, and are within edit distance 2 of a key that is. The
+// known keys are those of a literal initializer, of assignments with a
+// literal key and of a :SIG hash shape. Hashes whose keys cannot all be
+// seen are not checked.
+func HashKeyTypos(doc *ppi.Document) []HashKeyTypo {
+	return HashKeyTyposWithOptions(doc, SigCheckOptions{})
+}
+
+// HashKeyTyposWithOptions is HashKeyTypos with options. Only Aliases is
+// used, to expand the :SIG of hashrefs.
+func HashKeyTyposWithOptions(doc *ppi.Document, opts SigCheckOptions) []HashKeyTypo {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	checker := newTypeChecker(doc, opts)
+	if checker.index == nil {
+		return nil
+	}
+	tokens := doc.Tokens
+	r := newDeclResolver(tokens, checker.index.Root)
+	lexicals := lexicalDeclarations(tokens)
+	sets := make(map[int]*hashKeySet)
+	lookup := func(name string, offset int) *hashKeySet {
+		sym, ok := r.resolve(name, offset)
+		if !ok {
+			return nil
+		}
+		if set, ok := sets[sym.Start]; ok {
+			return set
+		}
+		set := &hashKeySet{name: name, written: make(map[string]bool)}
+		sets[sym.Start] = set
+		if shape, ok := shapeOf(checker, name, sym.Start); ok {
+			set.shape = true
+			for _, f := range shape.Fields {
+				set.written[f.Name] = true
+			}
+			return set
+		}
+		idx, ok := lexicals[sym.Start]
+		if !ok {
+			set.open = true
+			return set
+		}
+		set.assign(tokens, idx)
+		return set
+	}
+
+	for i, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenQuote, ppi.TokenHereDocContent:
+			for _, read := range interpolatedKeyReads(tok.Value) {
+				if set := lookup(read.name, tok.Start); set != nil {
+					set.reads = append(set.reads, hashKeyRead{key: read.key, start: tok.Start + read.start, end: tok.Start + read.end})
+				}
+			}
+			continue
+		case ppi.TokenSymbol:
+		default:
+			continue
+		}
+		v := tok.Value
+		if len(v) < 2 || strings.Contains(v, "::") || !isWordStart(v[1]) {
+			continue
+		}
+		if _, ok := lexicals[tok.Start]; ok {
+			continue
+		}
+		next := nextNonTrivia(tokens, i+1)
+		nextVal := ""
+		if next >= 0 && tokens[next].Type == ppi.TokenOperator {
+			nextVal = tokens[next].Value
+		}
+		switch {
+		case v[0] == '$' && isCast(tokens, i):
+			if set := lookup(v, tok.Start); set != nil {
+				set.open = true
+			}
+		case v[0] == '$' && nextVal == "{":
+			if set := lookup("%"+v[1:], tok.Start); set != nil {
+				set.element(tokens, i, next)
+			}
+		case v[0] == '$' && nextVal == "->":
+			set := lookup(v, tok.Start)
+			if set == nil {
+				continue
+			}
+			if brace := nextNonTrivia(tokens, next+1); brace >= 0 && tokens[brace].Value == "{" {
+				set.element(tokens, i, brace)
+			} else {
+				set.open = true
+			}
+		case v[0] == '$':
+			if set := lookup(v, tok.Start); set != nil {
+				set.escape(tokens, i)
+			}
+		case v[0] == '@' && nextVal == "{":
+			if set := lookup("%"+v[1:], tok.Start); set != nil {
+				set.slice(tokens, i, next)
+			}
+		case v[0] == '%' && nextVal != "{" && nextVal != "[":
+			if set := lookup(v, tok.Start); set != nil {
+				set.escape(tokens, i)
+			}
+		}
+	}
+
+	var out []HashKeyTypo
+	for _, set := range sets {
+		if set.open && !set.shape {
+			continue
+		}
+		keys := make([]string, 0, len(set.written))
+		for key := range set.written {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, read := range set.reads {
+			if set.written[read.key] {
+				continue
+			}
+			if suggestion := suggestHashKey(read.key, keys); suggestion != "" {
+				out = append(out, HashKeyTypo{Var: set.name, Key: read.key, Suggestion: suggestion, Start: read.start, End: read.end})
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
+
+// shapeOf returns the :SIG hash shape of a hashref variable, looking
+// through T? and other unions with a single shape.
+func shapeOf(c *typeChecker, name string, offset int) (ShapeType, bool) {
+	t, ok := c.varType(name, offset)
+	if !ok {
+		return ShapeType{}, false
+	}
+	if union, ok := t.(UnionType); ok {
+		var found []Type
+		for _, member := range union.Types {
+			if _, ok := member.(ShapeType); ok {
+				found = append(found, member)
+			}
+		}
+		if len(found) != 1 {
+			return ShapeType{}, false
+		}
+		t = found[0]
+	}
+	shape, ok := t.(ShapeType)
+	return shape, ok
+}
+
+// suggestHashKey returns the key closest to key, if it is within edit
+// distance 2 and shorter than both keys.
+func suggestHashKey(key string, keys []string) string {
+	best := ""
+	bestDist := 3
+	for _, candidate := range keys {
+		if d := editDistance(key, candidate); d < bestDist && d < len(key) && d < len(candidate) {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+// lexicalDeclarations returns the token indexes of the variables that my
+// and state declare, by start.
+func lexicalDeclarations(tokens []ppi.Token) map[int]int {
+	out := make(map[int]int)
+	for i, tok := range tokens {
+		if tok.Type != ppi.TokenWord || (tok.Value != "my" && tok.Value != "state") {
+			continue
+		}
+		j := nextNonTrivia(tokens, i+1)
+		if j < 0 {
+			continue
+		}
+		if tokens[j].Type == ppi.TokenSymbol {
+			out[tokens[j].Start] = j
+			continue
+		}
+		if tokens[j].Value != "(" {
+			continue
+		}
+		for k := j + 1; k < len(tokens) && tokens[k].Value != ")"; k++ {
+			if tokens[k].Type == ppi.TokenSymbol {
+				out[tokens[k].Start] = k
+			}
+		}
+	}
+	return out
+}
+
+// assign records the keys assigned to the hash by the declaration or
+// assignment of the variable at tokens[idx]. Anything but a literal list,
+// or an empty declaration, opens the hash.
+func (s *hashKeySet) assign(tokens []ppi.Token, idx int) {
+	next := nextNonTrivia(tokens, idx+1)
+	if next < 0 {
+		s.open = true
+		return
+	}
+	if tokens[next].Value == ";" {
+		if prev := prevNonTrivia(tokens, idx-1); prev >= 0 && (tokens[prev].Value == "my" || tokens[prev].Value == "state") {
+			return
+		}
+	}
+	if tokens[next].Value != "=" || isMatchOperator(tokens, next) {
+		s.open = true
+		return
+	}
+	open := "("
+	if s.name[0] == '$' {
+		open = "{"
+	}
+	start := nextNonTrivia(tokens, next+1)
+	if start < 0 || tokens[start].Value != open {
+		s.open = true
+		return
+	}
+	end := closesAt(tokens, start)
+	if end < 0 {
+		s.open = true
+		return
+	}
+	if after := nextNonTrivia(tokens, end+1); after < 0 || (tokens[after].Value != ";" && tokens[after].Value != "}") {
+		s.open = true
+		return
+	}
+	keys, ok := literalPairKeys(tokens[start+1 : end])
+	if !ok {
+		s.open = true
+		return
+	}
+	for _, key := range keys {
+		s.written[key] = true
+	}
+}
+
+// literalPairKeys returns the keys of a list of key/value pairs whose keys
+// are all literal.
+func literalPairKeys(tokens []ppi.Token) ([]string, bool) {
+	var items [][]ppi.Token
+	var cur []ppi.Token
+	depth := 0
+	for _, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenWhitespace, ppi.TokenComment, ppi.TokenHereDocContent:
+			continue
+		}
+		if tok.Type == ppi.TokenOperator {
+			switch tok.Value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			case ",", "=>":
+				if depth == 0 {
+					items = append(items, cur)
+					cur = nil
+					continue
+				}
+			}
+		}
+		cur = append(cur, tok)
+	}
+	if len(cur) > 0 {
+		items = append(items, cur)
+	}
+	if len(items)%2 != 0 {
+		return nil, false
+	}
+	var keys []string
+	for i := 0; i < len(items); i += 2 {
+		key, ok := literalKey(items[i])
+		if !ok {
+			return nil, false
+		}
+		keys = append(keys, key)
+	}
+	return keys, true
+}
+
+// literalKey returns the key that the significant tokens of a hash
+// subscript or a pair spell: a bare word, -word, or a string without
+// interpolation.
+func literalKey(ts []ppi.Token) (string, bool) {
+	switch {
+	case len(ts) == 1 && ts[0].Type == ppi.TokenWord && isIdent(ts[0].Value):
+		return ts[0].Value, true
+	case len(ts) == 1 && ts[0].Type == ppi.TokenQuote:
+		v := ts[0].Value
+		if v[0] == '"' && strings.ContainsAny(v, "$@\\") {
+			return "", false
+		}
+		if key := unquote(v); key != v {
+			return key, true
+		}
+	case len(ts) == 2 && ts[0].Value == "-" && ts[1].Type == ppi.TokenWord && isIdent(ts[1].Value):
+		return "-" + ts[1].Value, true
+	}
+	return "", false
+}
+
+// element records the key of the element whose subscript opens at
+// tokens[brace], for the variable at tokens[idx].
+func (s *hashKeySet) element(tokens []ppi.Token, idx, brace int) {
+	closeIdx := closesAt(tokens, brace)
+	if closeIdx < 0 {
+		s.open = true
+		return
+	}
+	key, literal := literalKey(significantTokens(tokens[brace+1 : closeIdx]))
+	if !isElementWrite(tokens, idx, closeIdx) {
+		if literal {
+			first, last := nextNonTrivia(tokens, brace+1), prevNonTrivia(tokens, closeIdx-1)
+			s.reads = append(s.reads, hashKeyRead{key: key, start: tokens[first].Start, end: tokens[last].End})
+		}
+		return
+	}
+	if !literal {
+		s.open = true
+		return
+	}
+	s.written[key] = true
+}
+
+// slice records the keys a slice @h{...} assigns; reading a slice reads no
+// keys that are checked.
+func (s *hashKeySet) slice(tokens []ppi.Token, idx, brace int) {
+	closeIdx := closesAt(tokens, brace)
+	if closeIdx < 0 {
+		s.open = true
+		return
+	}
+	if !isElementWrite(tokens, idx, closeIdx) {
+		return
+	}
+	var keys []string
+	for _, tok := range significantTokens(tokens[brace+1 : closeIdx]) {
+		switch {
+		case tok.Type == ppi.TokenQuoteLike && strings.HasPrefix(tok.Value, "qw"):
+			keys = append(keys, splitQWNames(tok.Value)...)
+		case tok.Value == ",":
+		default:
+			key, ok := literalKey([]ppi.Token{tok})
+			if !ok {
+				s.open = true
+				return
+			}
+			keys = append(keys, key)
+		}
+	}
+	for _, key := range keys {
+		s.written[key] = true
+	}
+}
+
+// escape handles a use of the whole hash or hashref at tokens[idx]. An
+// assignment replaces its keys; a reference to the hash, or any use of a
+// hashref but a subscript, lets other code write keys.
+func (s *hashKeySet) escape(tokens []ppi.Token, idx int) {
+	if next := nextNonTrivia(tokens, idx+1); next >= 0 && tokens[next].Value == "=" && !isMatchOperator(tokens, next) {
+		s.assign(tokens, idx)
+		return
+	}
+	if s.name[0] == '$' || isCast(tokens, idx) {
+		s.open = true
+		return
+	}
+	if prev := prevNonTrivia(tokens, idx-1); prev >= 0 && tokens[prev].Value == "\\" {
+		s.open = true
+	}
+}
+
+// isCast reports whether the symbol at tokens[idx] is dereferenced, as in
+// %$h, @{$h} or $$h{key}.
+func isCast(tokens []ppi.Token, idx int) bool {
+	prev := prevNonTrivia(tokens, idx-1)
+	if prev >= 0 && tokens[prev].Value == "{" {
+		prev = prevNonTrivia(tokens, prev-1)
+	}
+	if prev < 0 || tokens[prev].Type != ppi.TokenSymbol {
+		return false
+	}
+	switch tokens[prev].Value {
+	case "$", "@", "%", "$#":
+		return true
+	}
+	return false
+}
+
+// isMatchOperator reports whether the "=" at tokens[idx] starts "=~".
+func isMatchOperator(tokens []ppi.Token, idx int) bool {
+	return idx+1 < len(tokens) && tokens[idx+1].Type == ppi.TokenOperator && tokens[idx+1].Value == "~"
+}
+
+// isElementWrite reports whether the element of the variable at
+// tokens[idx], whose subscript closes at tokens[closeIdx], may create its
+// key: it is assigned, incremented, referenced, localized or
+// autovivified by a deeper subscript or a dereference.
+func isElementWrite(tokens []ppi.Token, idx, closeIdx int) bool {
+	if prev := prevNonTrivia(tokens, idx-1); prev >= 0 {
+		switch tokens[prev].Value {
+		case "++", "--", "\\", "local":
+			return true
+		case "{":
+			if cast := prevNonTrivia(tokens, prev-1); cast >= 0 && tokens[cast].Type == ppi.TokenSymbol && (tokens[cast].Value == "@" || tokens[cast].Value == "%" || tokens[cast].Value == "$") {
+				return true
+			}
+		}
+	}
+	end := closeIdx
+	for {
+		next := nextNonTrivia(tokens, end+1)
+		if next < 0 {
+			return false
+		}
+		if tokens[next].Value == "->" {
+			if sub := nextNonTrivia(tokens, next+1); sub >= 0 && (tokens[sub].Value == "{" || tokens[sub].Value == "[") {
+				next = sub
+			}
+		}
+		if tokens[next].Value != "{" && tokens[next].Value != "[" {
+			break
+		}
+		if end = closesAt(tokens, next); end < 0 {
+			return false
+		}
+	}
+	next := nextNonTrivia(tokens, end+1)
+	if next < 0 {
+		return false
+	}
+	if isAssignOperator(tokens, next) {
+		return true
+	}
+	// An element in a list that is assigned: ($h{a}, $h{b}) = @_.
+	depth := 0
+	for i := next; i < len(tokens); i++ {
+		tok := tokens[i]
+		if tok.Type != ppi.TokenOperator {
+			continue
+		}
+		switch tok.Value {
+		case "(", "[", "{":
+			depth++
+		case "]", "}", ";":
+			if depth == 0 {
+				return false
+			}
+			depth--
+		case ")":
+			if depth == 0 {
+				after := nextNonTrivia(tokens, i+1)
+				return after >= 0 && tokens[after].Value == "=" && !isMatchOperator(tokens, after)
+			}
+			depth--
+		}
+	}
+	return false
+}
+
+// isAssignOperator reports whether tokens[idx] assigns to what precedes
+// it. "||=" comes through as "||" and "=".
+func isAssignOperator(tokens []ppi.Token, idx int) bool {
+	tok := tokens[idx]
+	if tok.Type == ppi.TokenWord && tok.Value == "x" {
+		return idx+1 < len(tokens) && tokens[idx+1].Value == "="
+	}
+	if tok.Type != ppi.TokenOperator {
+		return false
+	}
+	switch tok.Value {
+	case "=":
+		return !isMatchOperator(tokens, idx)
+	case "++", "--":
+		return true
+	case "||", "&&", "//":
+		return idx+1 < len(tokens) && tokens[idx+1].Value == "="
+	case "==", "!=", "<=", ">=":
+		return false
+	}
+	return len(tok.Value) > 1 && strings.HasSuffix(tok.Value, "=")
+}
+
+type interpolatedKeyRead struct {
+	name       string
+	key        string
+	start, end int
+}
+
+// interpolatedKeyReads returns the elements with a literal key that a
+// double-quoted string or heredoc interpolates: "$h{key}" reads %h and
+// "$h->{key}" reads the hashref $h.
+func interpolatedKeyReads(value string) []interpolatedKeyRead {
+	if strings.HasPrefix(value, "'") || strings.HasPrefix(value, "q") {
+		return nil
+	}
+	var out []interpolatedKeyRead
+	for i := 0; i < len(value); i++ {
+		if value[i] != '$' || (i > 0 && value[i-1] == '\\') {
+			continue
+		}
+		j := i + 1
+		start := j
+		for j < len(value) && (isWordStart(value[j]) || (j > start && isDigit(value[j]))) {
+			j++
+		}
+		if j == start {
+			continue
+		}
+		name := "%" + value[start:j]
+		if strings.HasPrefix(value[j:], "->{") {
+			name = "$" + value[start:j]
+			j += 2
+		}
+		if j >= len(value) || value[j] != '{' {
+			continue
+		}
+		closeIdx := strings.IndexByte(value[j:], '}')
+		if closeIdx < 0 {
+			continue
+		}
+		raw := value[j+1 : j+closeIdx]
+		key := strings.TrimPrefix(raw, "-")
+		if !isIdent(key) {
+			if q := unquote(raw); q != raw && raw[0] == '\'' && isIdent(q) {
+				key = q
+			} else {
+				continue
+			}
+		} else {
+			key = raw
+		}
+		out = append(out, interpolatedKeyRead{name: name, key: key, start: j + 1, end: j + closeIdx})
+		i = j + closeIdx
+	}
+	return out
+}
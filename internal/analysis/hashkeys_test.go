@@ -0,0 +1,68 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func TestHashKeyTypos(t *testing.T) {
+	src := `my %cfg = (host => 'localhost', 'port', 80);
+$cfg{timeout} = 10;
+$cfg{retries}{max} = 3;
+print $cfg{hsot}, $cfg{"prot"}, $cfg{timeout}, $cfg{retries};
+print "$cfg{tiemout}\n" if exists $cfg{xyzzy};
+my $opt = { verbose => 1 };
+print $opt->{verbsoe};
+
+my %args = @_;
+$args{name} = 1;
+print $args{nmae};
+
+my $dyn = {};
+$dyn->{$_} = 1 for qw(alpha beta);
+print $dyn->{alpah};
+
+my $escaped = { color => 1 };
+set_defaults($escaped);
+print $escaped->{colour};
+
+my %ref = (size => 1);
+fill(\%ref);
+print $ref{szie};
+
+# :SIG(hash{host: str, port: int})
+my $server = load();
+print $server->{hots};
+
+sub f {
+    my %h;
+    @h{qw(red green)} = (1, 2);
+    ($h{blue}, $h{cyan}) = (3, 4);
+    return $h{gren} + $h{bleu} + $h{cyna};
+}
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var got []string
+	for _, typo := range HashKeyTypos(doc) {
+		if src[typo.Start:typo.End] != typo.Key && src[typo.Start+1:typo.End-1] != typo.Key {
+			t.Fatalf("unexpected range %q for %+v", src[typo.Start:typo.End], typo)
+		}
+		got = append(got, typo.Var+" "+typo.Key+" -> "+typo.Suggestion)
+	}
+	want := []string{
+		"%cfg hsot -> host",
+		"%cfg prot -> port",
+		"%cfg tiemout -> timeout",
+		"$opt verbsoe -> verbose",
+		"$server hots -> host",
+		"%h gren -> green",
+		"%h bleu -> blue",
+		"%h cyna -> cyan",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
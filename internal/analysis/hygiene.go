@@ -0,0 +1,368 @@
+package analysis
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// HygieneIssue is a module hygiene problem and the edits that fix it. Fix
+// is empty when there is no safe fix.
+type HygieneIssue struct {
+	Message  string
+	Start    int
+	End      int
+	FixTitle string
+	Fix      []Edit
+}
+
+// HygieneOptions describes the file ModuleHygiene checks.
+type HygieneOptions struct {
+	// Module is set for .pm files, which must return a true value and
+	// should declare their package before any code.
+	Module bool
+	// Package is the package the path of the file under its lib root
+	// names, or "" when the file is not in a lib root.
+	Package string
+}
+
+// ModuleHygiene reports a package that does not match the file name, a
+// module that does not return a true value, subs defined twice in one
+// package and a package statement that follows code of package main.
+func ModuleHygiene(doc *ppi.Document, opts HygieneOptions) []HygieneIssue {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	var out []HygieneIssue
+	decls := packageDecls(doc)
+	if opts.Package != "" && isClassName(opts.Package) {
+		if issue, ok := packageMismatch(doc, decls, opts.Package); ok {
+			out = append(out, issue)
+		}
+	}
+	if opts.Module {
+		if issue, ok := packageAfterCode(doc, decls); ok {
+			out = append(out, issue)
+		}
+		if issue, ok := missingTrueValue(doc); ok {
+			out = append(out, issue)
+		}
+	}
+	out = append(out, duplicateSubs(doc)...)
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
+
+// packageDecl is a package or class declaration. stmt is the package
+// statement, nil for classes and stray packages.
+type packageDecl struct {
+	PackageDecl
+	stmt *ppi.Node
+}
+
+// packageDecls returns the package and class declarations of doc in
+// source order.
+func packageDecls(doc *ppi.Document) []packageDecl {
+	var out []packageDecl
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::package" || n.Name == "" {
+			return
+		}
+		for i, tok := range n.Tokens {
+			if tok.Type != ppi.TokenWord || tok.Value != "package" {
+				continue
+			}
+			if name := nextNonTrivia(n.Tokens, i+1); name >= 0 && n.Tokens[name].Value == n.Name {
+				out = append(out, packageDecl{
+					PackageDecl: PackageDecl{Name: n.Name, Start: n.Tokens[name].Start, End: n.Tokens[name].End, Offset: tok.Start},
+					stmt:        n,
+				})
+			}
+			break
+		}
+	})
+	for _, p := range StrayPackages(doc) {
+		out = append(out, packageDecl{PackageDecl: p})
+	}
+	classes := CollectClasses(doc)
+	for i, tok := range doc.Tokens {
+		for _, class := range classes {
+			if tok.Start != class.Start {
+				continue
+			}
+			offset := class.Start
+			if kw := prevNonTrivia(doc.Tokens, i-1); kw >= 0 {
+				offset = doc.Tokens[kw].Start
+			}
+			out = append(out, packageDecl{PackageDecl: PackageDecl{Name: class.Name, Start: class.Start, End: class.End, Offset: offset}})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start < out[j].Start })
+	return out
+}
+
+// packageMismatch reports a module none of whose packages is the one its
+// path names. The fix renames the first package, or declares the package
+// when there is none.
+func packageMismatch(doc *ppi.Document, decls []packageDecl, want string) (HygieneIssue, bool) {
+	for _, d := range decls {
+		if d.Name == want {
+			return HygieneIssue{}, false
+		}
+	}
+	if len(decls) == 0 {
+		at := firstCodeLine(doc)
+		end := strings.IndexByte(doc.Source[at:], '\n')
+		if end < 0 {
+			end = len(doc.Source) - at
+		}
+		return HygieneIssue{
+			Message:  "module declares no package, expected package " + want,
+			Start:    at,
+			End:      at + end,
+			FixTitle: "Add package " + want,
+			Fix:      []Edit{{Start: at, End: at, NewText: "package " + want + ";\n"}},
+		}, true
+	}
+	d := decls[0]
+	return HygieneIssue{
+		Message:  "package " + d.Name + " does not match the file name, expected " + want,
+		Start:    d.Start,
+		End:      d.End,
+		FixTitle: "Rename package to " + want,
+		Fix:      []Edit{{Start: d.Start, End: d.End, NewText: want}},
+	}, true
+}
+
+// firstCodeLine returns the start of the line of the first significant
+// token of doc, after a shebang line and leading comments.
+func firstCodeLine(doc *ppi.Document) int {
+	first := nextNonTrivia(doc.Tokens, 0)
+	if first < 0 {
+		return len(doc.Source)
+	}
+	at := doc.Tokens[first].Start
+	for at > 0 && doc.Source[at-1] != '\n' {
+		at--
+	}
+	return at
+}
+
+// packageAfterCode reports a module whose first package statement follows
+// code, which then runs in package main. The fix moves a plain
+// "package NAME;" statement to the top of the file.
+func packageAfterCode(doc *ppi.Document, decls []packageDecl) (HygieneIssue, bool) {
+	if len(decls) == 0 {
+		return HygieneIssue{}, false
+	}
+	d := decls[0]
+	code := false
+	for _, n := range doc.Root.Children {
+		start, _, ok := nodeTokenRange(n)
+		if !ok || start >= d.Offset {
+			break
+		}
+		// "require 5.010;" before the package is a common version check.
+		if ts := significantTokens(n.Tokens); isRuntimeStatement(n) && !(len(ts) > 0 && ts[0].Value == "require") {
+			code = true
+			break
+		}
+	}
+	if !code {
+		return HygieneIssue{}, false
+	}
+	issue := HygieneIssue{
+		Message: "package " + d.Name + " is declared after code in package main",
+		Start:   d.Start,
+		End:     d.End,
+	}
+	if d.stmt == nil || nodeBlockChild(d.stmt) != nil {
+		return issue, true
+	}
+	ts := significantTokens(d.stmt.Tokens)
+	last := ts[len(ts)-1]
+	if last.Value != ";" {
+		return issue, true
+	}
+	start, end := RemovalRange(doc.Source, d.Offset, last.End)
+	at := firstCodeLine(doc)
+	issue.FixTitle = "Move package " + d.Name + " to the top of the file"
+	issue.Fix = []Edit{
+		{Start: at, End: at, NewText: doc.Source[d.Offset:last.End] + "\n"},
+		{Start: start, End: end},
+	}
+	return issue, true
+}
+
+// isRuntimeStatement reports whether n runs when the file is loaded, as
+// opposed to declarations, use statements, BEGIN blocks and __END__.
+func isRuntimeStatement(n *ppi.Node) bool {
+	if n == nil || n.Type != ppi.NodeStatement {
+		return false
+	}
+	switch n.Kind {
+	case "statement::include", "statement::package", "statement::sub", "statement::scheduled", "statement::empty":
+		return false
+	}
+	ts := significantTokens(n.Tokens)
+	if len(ts) == 0 || ts[0].Type == ppi.TokenSeparator {
+		return false
+	}
+	// go-ppi reads class declarations as expressions.
+	return !(ts[0].Type == ppi.TokenWord && ts[0].Value == "class")
+}
+
+// missingTrueValue reports a module whose last statement run on load is
+// not a true value, unless the module_true feature is on. Only literals,
+// and assignments of literals, are taken as false; other expressions are
+// assumed to be true. The fix appends "1;" before __END__ or __DATA__.
+func missingTrueValue(doc *ppi.Document) (HygieneIssue, bool) {
+	end := len(doc.Source)
+	for _, tok := range doc.Tokens {
+		if tok.Type == ppi.TokenSeparator {
+			end = tok.Start
+			break
+		}
+	}
+	if PragmasAt(doc, end).Features["module_true"] {
+		return HygieneIssue{}, false
+	}
+	if last := lastRuntimeStatement(doc.Root.Children); last != nil && returnsTrue(last) {
+		return HygieneIssue{}, false
+	}
+	// The diagnostic goes on the last token of the code.
+	start, stop := end, end
+	for _, tok := range significantTokens(doc.Tokens) {
+		if tok.Start >= end {
+			break
+		}
+		start, stop = tok.Start, tok.End
+	}
+	text := "1;\n"
+	if end > 0 && doc.Source[end-1] != '\n' {
+		text = "\n" + text
+	}
+	return HygieneIssue{
+		Message:  "module does not return a true value, add 1; at its end",
+		Start:    start,
+		End:      stop,
+		FixTitle: "Add 1; at the end of the module",
+		Fix:      []Edit{{Start: end, End: end, NewText: text}},
+	}, true
+}
+
+// lastRuntimeStatement returns the last statement of nodes that runs on
+// load, looking into the block of a package block.
+func lastRuntimeStatement(nodes []*ppi.Node) *ppi.Node {
+	for i := len(nodes) - 1; i >= 0; i-- {
+		n := nodes[i]
+		if n != nil && n.Kind == "statement::package" {
+			if blk := nodeBlockChild(n); blk != nil {
+				if last := lastRuntimeStatement(blk.Children); last != nil {
+					return last
+				}
+			}
+			continue
+		}
+		if isRuntimeStatement(n) {
+			return n
+		}
+		if ts := significantTokens(n.Tokens); len(ts) > 0 && ts[0].Type == ppi.TokenWord && ts[0].Value == "class" {
+			// The value of a class block is not known.
+			return n
+		}
+	}
+	return nil
+}
+
+// returnsTrue reports whether the statement n may evaluate to true: it is
+// anything but a false literal or the assignment of one.
+func returnsTrue(n *ppi.Node) bool {
+	ts := significantTokens(n.Tokens)
+	if len(ts) > 0 && ts[len(ts)-1].Value == ";" {
+		ts = ts[:len(ts)-1]
+	}
+	if len(ts) > 0 && ts[0].Type == ppi.TokenWord && (ts[0].Value == "my" || ts[0].Value == "our" || ts[0].Value == "state" || ts[0].Value == "local") {
+		ts = ts[1:]
+	}
+	if len(ts) == 3 && ts[0].Type == ppi.TokenSymbol && ts[1].Value == "=" {
+		ts = ts[2:]
+	}
+	if len(ts) != 1 {
+		return true
+	}
+	switch ts[0].Type {
+	case ppi.TokenNumber:
+		v, err := strconv.ParseFloat(strings.ReplaceAll(ts[0].Value, "_", ""), 64)
+		return err != nil || v != 0
+	case ppi.TokenQuote:
+		v := unquote(ts[0].Value)
+		return v == ts[0].Value || (v != "" && v != "0")
+	}
+	return true
+}
+
+// duplicateSubs reports the subs defined again in the same package, which
+// replaces the earlier definition. The fix removes the earlier one, which
+// keeps the behavior. Redefinitions under no warnings 'redefine' are
+// deliberate and not reported.
+func duplicateSubs(doc *ppi.Document) []HygieneIssue {
+	pkgAt := PackageLookup(doc)
+	first := make(map[string]*ppi.Node)
+	var out []HygieneIssue
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::sub" || n.Name == "" || nodeBlockChild(n) == nil {
+			return
+		}
+		nameIdx := -1
+		for i, tok := range n.Tokens {
+			if tok.Type == ppi.TokenWord && tok.Value == "sub" {
+				if next := nextNonTrivia(n.Tokens, i+1); next >= 0 && n.Tokens[next].Value == n.Name {
+					nameIdx = next
+				}
+				break
+			}
+		}
+		if nameIdx < 0 {
+			return
+		}
+		nameTok := n.Tokens[nameIdx]
+		full := n.Name
+		if !strings.Contains(full, "::") {
+			pkg := pkgAt(nameTok.Start)
+			if pkg == "" {
+				pkg = "main"
+			}
+			full = pkg + "::" + full
+		}
+		prev, ok := first[full]
+		if !ok {
+			first[full] = n
+			return
+		}
+		if on, set := PragmasAt(doc, nameTok.Start).WarningCategories["redefine"]; set && !on {
+			return
+		}
+		prevStart, _, _ := nodeTokenRange(prev)
+		for _, tok := range prev.Tokens {
+			if tok.Type == ppi.TokenWord && tok.Value == "sub" {
+				prevStart = tok.Start
+				break
+			}
+		}
+		line := strings.Count(doc.Source[:prevStart], "\n") + 1
+		start, end := StatementSpan(doc.Source, prev)
+		start, end = RemovalRange(doc.Source, start, end)
+		out = append(out, HygieneIssue{
+			Message:  "sub " + n.Name + " redefined, first defined at line " + strconv.Itoa(line),
+			Start:    nameTok.Start,
+			End:      nameTok.End,
+			FixTitle: "Remove the earlier definition of sub " + n.Name,
+			Fix:      []Edit{{Start: start, End: end}},
+		})
+		first[full] = n
+	})
+	return out
+}
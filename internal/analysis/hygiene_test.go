@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"strings"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func hygieneMessages(src string, opts HygieneOptions) ([]HygieneIssue, []string) {
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	issues := ModuleHygiene(doc, opts)
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.Message)
+	}
+	return issues, got
+}
+
+func applyEdits(src string, edits []Edit) string {
+	for i := len(edits) - 1; i >= 0; i-- {
+		src = src[:edits[i].Start] + edits[i].NewText + src[edits[i].End:]
+	}
+	return src
+}
+
+func TestModuleHygiene(t *testing.T) {
+	opts := HygieneOptions{Module: true, Package: "Foo::Bar"}
+	src := "use strict;\nmy $debug = 0;\npackage Foo::Baz;\nsub run { 1 }\nsub run { 2 }\n__END__\n=pod\n"
+	issues, got := hygieneMessages(src, opts)
+	want := []string{
+		"package Foo::Baz does not match the file name, expected Foo::Bar",
+		"package Foo::Baz is declared after code in package main",
+		"sub run redefined, first defined at line 4",
+		"module does not return a true value, add 1; at its end",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+	fixes := []string{
+		"use strict;\nmy $debug = 0;\npackage Foo::Bar;\nsub run { 1 }\nsub run { 2 }\n__END__\n=pod\n",
+		"package Foo::Baz;\nuse strict;\nmy $debug = 0;\nsub run { 1 }\nsub run { 2 }\n__END__\n=pod\n",
+		"use strict;\nmy $debug = 0;\npackage Foo::Baz;\nsub run { 2 }\n__END__\n=pod\n",
+		"use strict;\nmy $debug = 0;\npackage Foo::Baz;\nsub run { 1 }\nsub run { 2 }\n1;\n__END__\n=pod\n",
+	}
+	for i, issue := range issues {
+		if out := applyEdits(src, issue.Fix); out != fixes[i] {
+			t.Fatalf("%s: unexpected fix\n%s", issue.FixTitle, out)
+		}
+	}
+
+	src = "#!perl\n# a module\nuse strict;\nsub run { 1 }\n"
+	issues, got = hygieneMessages(src, opts)
+	if len(got) != 2 || got[0] != "module declares no package, expected package Foo::Bar" {
+		t.Fatalf("unexpected issues: %v", got)
+	}
+	if out := applyEdits(src, issues[0].Fix); out != "#!perl\n# a module\npackage Foo::Bar;\nuse strict;\nsub run { 1 }\n" {
+		t.Fatalf("unexpected fix\n%s", out)
+	}
+
+	for _, src := range []string{
+		"package Foo::Bar;\nsub run { 1 }\n1;\n",
+		"require 5.006;\npackage Foo::Bar;\nsub run { 1 }\n1;\n",
+		"package Foo::Bar;\nsub run { 1 }\n1;\nsub later { 2 }\n",
+		"package Foo::Bar;\n__PACKAGE__->meta->make_immutable;\n",
+		"package Foo::Bar;\nour $VERSION = '1.0';\nsub run { 1 }\n",
+		"use v5.38;\npackage Foo::Bar;\nsub run { 1 }\n",
+		"package Foo::Bar {\n    sub run { 1 }\n    1;\n}\n",
+		"package Foo::Bar;\nsub run { 1 }\nno warnings 'redefine';\nsub run { 2 }\n1;\n",
+		"package Foo::Bar;\nsub run;\nsub run { 1 }\npackage Other;\nsub run { 2 }\n1;\n",
+	} {
+		if _, got := hygieneMessages(src, opts); len(got) > 0 {
+			t.Fatalf("%q: unexpected issues %v", src, got)
+		}
+	}
+	if _, got := hygieneMessages("package Foo::Bar;\nsub run { 1 }\n0;\n", opts); len(got) != 1 {
+		t.Fatalf("expected a false value to be reported, got %v", got)
+	}
+	if _, got := hygieneMessages("print 1;\npackage Foo;\nsub run { 1 }\n", HygieneOptions{}); len(got) > 0 {
+		t.Fatalf("scripts are not modules: %v", got)
+	}
+}
@@ -0,0 +1,146 @@
+package analysis
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignoreRule is one gitignore-style pattern relative to base.
+type ignoreRule struct {
+	base     string
+	pattern  string
+	negate   bool
+	dirOnly  bool
+	anchored bool
+}
+
+// ignoreMatcher evaluates gitignore-style rules. Later rules win, so a
+// negated pattern can re-include a path excluded by an earlier one.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+func newIgnoreRule(base, line string) (ignoreRule, bool) {
+	line = strings.TrimRight(line, " \t\r")
+	if line == "" || strings.HasPrefix(line, "#") {
+		return ignoreRule{}, false
+	}
+	rule := ignoreRule{base: base}
+	if rest, ok := strings.CutPrefix(line, "!"); ok {
+		rule.negate = true
+		line = rest
+	}
+	line = strings.TrimPrefix(line, `\`)
+	if rest, ok := strings.CutSuffix(line, "/"); ok {
+		rule.dirOnly = true
+		line = rest
+	}
+	if rest, ok := strings.CutPrefix(line, "/"); ok {
+		rule.anchored = true
+		line = rest
+	}
+	if strings.Contains(line, "/") {
+		rule.anchored = true
+	}
+	if line == "" {
+		return ignoreRule{}, false
+	}
+	rule.pattern = line
+	return rule, true
+}
+
+func (m *ignoreMatcher) add(base string, patterns []string) {
+	for _, p := range patterns {
+		if rule, ok := newIgnoreRule(base, p); ok {
+			m.rules = append(m.rules, rule)
+		}
+	}
+}
+
+// addFile loads the .gitignore in dir, if any.
+func (m *ignoreMatcher) addFile(dir string) {
+	b, err := os.ReadFile(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return
+	}
+	m.add(dir, strings.Split(string(b), "\n"))
+}
+
+// addAncestors loads .gitignore files from the parents of root up to the
+// enclosing git repository top. Nothing is loaded outside a repository.
+func (m *ignoreMatcher) addAncestors(root string) {
+	var dirs []string
+	dir := filepath.Clean(root)
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return
+		}
+		dir = parent
+		dirs = append(dirs, dir)
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+	}
+	for i := len(dirs) - 1; i >= 0; i-- {
+		m.addFile(dirs[i])
+	}
+}
+
+func (m *ignoreMatcher) match(p string, isDir bool) bool {
+	if m == nil {
+		return false
+	}
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		rel, err := filepath.Rel(rule.base, p)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(os.PathSeparator)) {
+			continue
+		}
+		rel = filepath.ToSlash(rel)
+		var ok bool
+		if rule.anchored {
+			ok = globMatch(rule.pattern, rel)
+		} else {
+			ok = globMatch(rule.pattern, path.Base(rel))
+		}
+		if ok {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// globMatch matches a slash-separated path against a pattern where "**"
+// matches any number of path segments.
+func globMatch(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			rest := pattern[1:]
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(rest, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		ok, err := path.Match(pattern[0], name[0])
+		if err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
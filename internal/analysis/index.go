@@ -49,11 +49,13 @@ func IndexDocument(doc *ppi.Document) *Index {
 	}
 	index := &Index{Root: root}
 
-	scopes := buildScopes(doc.Root, root, doc.Tokens)
+	classes := CollectClasses(doc)
+	scopes := buildScopes(doc.Root, root, doc.Tokens, classScopes(classes))
 	root.Children = scopes
 
 	collectDefinitions(doc.Root, index)
 	collectVariables(doc, root)
+	collectClassVars(classes, root)
 	collectSignatureVars(doc.Root, root)
 	collectAnonSignatureVars(doc, root)
 	collectReceiverNames(doc, root)
@@ -419,8 +421,8 @@ func collectAnonSignatureVars(doc *ppi.Document, root *Scope) {
 	}
 }
 
-func buildScopes(root *ppi.Node, parent *Scope, tokens []ppi.Token) []*Scope {
-	var scopes []*Scope
+func buildScopes(root *ppi.Node, parent *Scope, tokens []ppi.Token, extra []*Scope) []*Scope {
+	scopes := extra
 	walkNodes(root, func(n *ppi.Node) {
 		if n == nil {
 			return
@@ -0,0 +1,295 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// Inheritance holds the parent classes declared for each package in a
+// document and the packages that switch to the C3 method resolution order.
+type Inheritance struct {
+	Parents map[string][]string
+	C3      map[string]bool
+	// Roles holds the roles each package composes with "with". They are
+	// also appended to Parents so that their methods are found.
+	Roles map[string][]string
+}
+
+// CollectInheritance finds parent declarations made with "use parent",
+// "use base", and assignments to or pushes onto @ISA, and adds the parents
+// and roles declared through the class builders, such as Moose "extends"
+// or :isa of a class. "use mro 'c3'" marks the package as using C3.
+func CollectInheritance(doc *ppi.Document) Inheritance {
+	inh := Inheritance{
+		Parents: make(map[string][]string),
+		C3:      make(map[string]bool),
+		Roles:   make(map[string][]string),
+	}
+	if doc == nil || doc.Root == nil {
+		return inh
+	}
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement {
+			return
+		}
+		start, _, ok := nodeTokenRange(n)
+		if !ok {
+			return
+		}
+		pkg := doc.PackageAt(start)
+		if pkg == "" {
+			pkg = "main"
+		}
+		switch n.Kind {
+		case "statement::include":
+			if n.Keyword != "use" {
+				return
+			}
+			switch n.Name {
+			case "parent", "base":
+				inh.add(pkg, classNamesFromItems(n.ImportItems), false)
+			case "mro":
+				for _, item := range n.ImportItems {
+					if unquote(item) == "c3" {
+						inh.C3[pkg] = true
+					}
+				}
+			}
+		case "statement::expression":
+			collectISAStatement(n.Tokens, pkg, &inh)
+		}
+	})
+	for _, b := range classBuilders {
+		b.Parents(doc, &inh)
+	}
+	for pkg, roles := range inh.Roles {
+		inh.add(pkg, roles, false)
+	}
+	return inh
+}
+
+func collectISAStatement(tokens []ppi.Token, pkg string, inh *Inheritance) {
+	pos := nextNonTrivia(tokens, 0)
+	if pos < 0 {
+		return
+	}
+	first := tokens[pos]
+	if first.Type != ppi.TokenWord {
+		if first.Type == ppi.TokenSymbol {
+			if target, ok := isaTarget(first.Value, pkg); ok {
+				if eq := nextNonTrivia(tokens, pos+1); eq >= 0 && tokens[eq].Type == ppi.TokenOperator && tokens[eq].Value == "=" {
+					inh.set(target, classNamesFromTokens(tokens[eq+1:]))
+				}
+			}
+		}
+		return
+	}
+	switch first.Value {
+	case "our":
+		sym := nextNonTrivia(tokens, pos+1)
+		if sym < 0 || tokens[sym].Type != ppi.TokenSymbol {
+			return
+		}
+		target, ok := isaTarget(tokens[sym].Value, pkg)
+		if !ok {
+			return
+		}
+		eq := nextNonTrivia(tokens, sym+1)
+		if eq < 0 || tokens[eq].Type != ppi.TokenOperator || tokens[eq].Value != "=" {
+			return
+		}
+		inh.set(target, classNamesFromTokens(tokens[eq+1:]))
+	case "push", "unshift":
+		sym := nextNonTrivia(tokens, pos+1)
+		if sym >= 0 && tokens[sym].Type == ppi.TokenOperator && tokens[sym].Value == "(" {
+			sym = nextNonTrivia(tokens, sym+1)
+		}
+		if sym < 0 || tokens[sym].Type != ppi.TokenSymbol {
+			return
+		}
+		target, ok := isaTarget(tokens[sym].Value, pkg)
+		if !ok {
+			return
+		}
+		inh.add(target, classNamesFromTokens(tokens[sym+1:]), first.Value == "unshift")
+	}
+}
+
+// isaTarget returns the package whose @ISA the symbol names.
+func isaTarget(symbol, pkg string) (string, bool) {
+	if symbol == "@ISA" {
+		return pkg, true
+	}
+	if target, ok := strings.CutSuffix(strings.TrimPrefix(symbol, "@"), "::ISA"); ok && strings.HasPrefix(symbol, "@") && isClassName(target) {
+		return target, true
+	}
+	return "", false
+}
+
+func (inh *Inheritance) set(pkg string, parents []string) {
+	if len(parents) == 0 {
+		return
+	}
+	inh.Parents[pkg] = nil
+	inh.add(pkg, parents, false)
+}
+
+func (inh *Inheritance) add(pkg string, parents []string, front bool) {
+	addParents(inh.Parents, pkg, parents, front)
+}
+
+// addParents merges parents into m[pkg], dropping duplicates and pkg itself.
+func addParents(m map[string][]string, pkg string, parents []string, front bool) {
+	var merged []string
+	if front {
+		merged = append(append(merged, parents...), m[pkg]...)
+	} else {
+		merged = append(append(merged, m[pkg]...), parents...)
+	}
+	seen := make(map[string]struct{}, len(merged))
+	out := merged[:0]
+	for _, p := range merged {
+		if _, ok := seen[p]; ok || p == pkg {
+			continue
+		}
+		seen[p] = struct{}{}
+		out = append(out, p)
+	}
+	if len(out) > 0 {
+		m[pkg] = out
+	} else {
+		delete(m, pkg)
+	}
+}
+
+// classNamesFromTokens reads quoted and qw() class names up to the end of
+// the statement or the first nested block.
+func classNamesFromTokens(tokens []ppi.Token) []string {
+	var out []string
+	for _, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenQuote:
+			if name := unquote(tok.Value); isClassName(name) {
+				out = append(out, name)
+			}
+		case ppi.TokenQuoteLike:
+			for _, name := range splitQW(tok.Value) {
+				if isClassName(name) {
+					out = append(out, name)
+				}
+			}
+		case ppi.TokenOperator:
+			if tok.Value == ";" || tok.Value == "{" {
+				return out
+			}
+		}
+	}
+	return out
+}
+
+func classNamesFromItems(items []string) []string {
+	var out []string
+	for _, item := range items {
+		if name := unquote(strings.TrimSpace(item)); isClassName(name) {
+			out = append(out, name)
+		}
+	}
+	return out
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '\'' || s[0] == '"') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Linearize returns the method resolution order of pkg, starting with pkg
+// itself. It uses Perl's default depth-first order unless c3 is set, and
+// falls back to depth-first when the hierarchy has no C3 linearization.
+func Linearize(pkg string, parents func(string) []string, c3 bool) []string {
+	if pkg == "" {
+		return nil
+	}
+	if c3 {
+		if out, ok := c3Linearize(pkg, parents, map[string]bool{}); ok {
+			return out
+		}
+	}
+	seen := make(map[string]struct{})
+	var out []string
+	var visit func(string)
+	visit = func(p string) {
+		if _, ok := seen[p]; ok {
+			return
+		}
+		seen[p] = struct{}{}
+		out = append(out, p)
+		for _, parent := range parents(p) {
+			visit(parent)
+		}
+	}
+	visit(pkg)
+	return out
+}
+
+func c3Linearize(pkg string, parents func(string) []string, visiting map[string]bool) ([]string, bool) {
+	if visiting[pkg] {
+		return nil, false
+	}
+	visiting[pkg] = true
+	defer delete(visiting, pkg)
+
+	direct := parents(pkg)
+	var seqs [][]string
+	for _, parent := range direct {
+		lin, ok := c3Linearize(parent, parents, visiting)
+		if !ok {
+			return nil, false
+		}
+		seqs = append(seqs, lin)
+	}
+	seqs = append(seqs, append([]string(nil), direct...))
+
+	out := []string{pkg}
+	for {
+		nonEmpty := seqs[:0]
+		for _, seq := range seqs {
+			if len(seq) > 0 {
+				nonEmpty = append(nonEmpty, seq)
+			}
+		}
+		seqs = nonEmpty
+		if len(seqs) == 0 {
+			return out, true
+		}
+		var head string
+		for _, seq := range seqs {
+			if !inTail(seqs, seq[0]) {
+				head = seq[0]
+				break
+			}
+		}
+		if head == "" {
+			return nil, false
+		}
+		out = append(out, head)
+		for i, seq := range seqs {
+			if seq[0] == head {
+				seqs[i] = seq[1:]
+			}
+		}
+	}
+}
+
+func inTail(seqs [][]string, name string) bool {
+	for _, seq := range seqs {
+		for _, s := range seq[1:] {
+			if s == name {
+				return true
+			}
+		}
+	}
+	return false
+}
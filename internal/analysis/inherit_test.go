@@ -0,0 +1,82 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func TestCollectInheritance(t *testing.T) {
+	src := `package Foo;
+use parent -norequire, 'Bar', "Baz";
+use base qw(Qux);
+push @ISA, 'D';
+use mro 'c3';
+
+package Child;
+our @ISA = ('A', 'B::C');
+unshift @ISA, 'Z';
+
+package Moosey;
+with 'Role::R';
+extends 'E', 'F';
+
+package main;
+@Other::ISA = qw(Base);
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	inh := CollectInheritance(doc)
+	want := map[string][]string{
+		"Foo":    {"Bar", "Baz", "Qux", "D"},
+		"Child":  {"Z", "A", "B::C"},
+		"Moosey": {"E", "F", "Role::R"},
+		"Other":  {"Base"},
+	}
+	if !reflect.DeepEqual(inh.Parents, want) {
+		t.Fatalf("unexpected parents: %v", inh.Parents)
+	}
+	if !reflect.DeepEqual(inh.Roles["Moosey"], []string{"Role::R"}) {
+		t.Fatalf("unexpected roles: %v", inh.Roles)
+	}
+	if !inh.C3["Foo"] || inh.C3["Child"] {
+		t.Fatalf("unexpected c3 packages: %v", inh.C3)
+	}
+}
+
+func TestLinearize(t *testing.T) {
+	// Diamond: D -> B, C; B -> A; C -> A.
+	parents := map[string][]string{
+		"D": {"B", "C"},
+		"B": {"A"},
+		"C": {"A"},
+	}
+	lookup := func(p string) []string { return parents[p] }
+	if got := Linearize("D", lookup, false); !reflect.DeepEqual(got, []string{"D", "B", "A", "C"}) {
+		t.Fatalf("unexpected dfs order: %v", got)
+	}
+	if got := Linearize("D", lookup, true); !reflect.DeepEqual(got, []string{"D", "B", "C", "A"}) {
+		t.Fatalf("unexpected c3 order: %v", got)
+	}
+
+	parents["A"] = []string{"D"}
+	if got := Linearize("D", lookup, true); !reflect.DeepEqual(got, []string{"D", "B", "A", "C"}) {
+		t.Fatalf("expected dfs fallback on cycle, got %v", got)
+	}
+}
+
+func TestWorkspaceIndexMRO(t *testing.T) {
+	tmp := t.TempDir()
+	writeTestFile(t, tmp+"/Base.pm", "package Base;\nsub new {}\n1;\n")
+	writeTestFile(t, tmp+"/Mid.pm", "package Mid;\nuse parent 'Base';\nsub mid {}\n1;\n")
+	writeTestFile(t, tmp+"/Leaf.pm", "package Leaf;\nuse base 'Mid';\n1;\n")
+
+	index, err := BuildWorkspaceIndex([]string{tmp})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndex: %v", err)
+	}
+	if got := index.MRO("Leaf"); !reflect.DeepEqual(got, []string{"Leaf", "Mid", "Base"}) {
+		t.Fatalf("unexpected mro: %v", got)
+	}
+}
@@ -0,0 +1,122 @@
+package analysis
+
+import (
+	"container/list"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FindModuleFile resolves a module name such as Foo::Bar to Foo/Bar.pm
+// under the first root that contains it.
+func FindModuleFile(name string, roots []string) string {
+	if name == "" || len(roots) == 0 {
+		return ""
+	}
+	rel := strings.ReplaceAll(name, "::", string(os.PathSeparator)) + ".pm"
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		path := filepath.Join(root, rel)
+		info, err := os.Stat(path)
+		if err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// moduleCache parses modules on first lookup and keeps the most recently
+// used ones. Modules that cannot be found are remembered in a separate set,
+// so that lookups of unknown or dynamic names do not evict parsed modules.
+type moduleCache struct {
+	mu          sync.Mutex
+	roots       []string
+	size        int
+	maxFileSize int64
+	entries     map[string]*list.Element
+	order       *list.List
+	missing     map[string]bool
+}
+
+// maxMissingModules bounds the set of modules that were not found; it is
+// emptied when full.
+const maxMissingModules = 4096
+
+type moduleEntry struct {
+	name  string
+	index *WorkspaceIndex
+}
+
+func newModuleCache(roots []string, size int, maxFileSize int64) *moduleCache {
+	return &moduleCache{
+		roots:       append([]string(nil), roots...),
+		size:        size,
+		maxFileSize: maxFileSize,
+		entries:     make(map[string]*list.Element),
+		order:       list.New(),
+		missing:     make(map[string]bool),
+	}
+}
+
+// load returns the index of a single module file, or nil if the module
+// is not found under the lazy roots. A nil cache always returns nil.
+func (c *moduleCache) load(name string) *WorkspaceIndex {
+	if c == nil || !isClassName(name) {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.entries[name]; ok {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*moduleEntry).index
+	}
+	if c.missing[name] {
+		return nil
+	}
+	index := c.parse(name)
+	if index == nil {
+		if len(c.missing) >= maxMissingModules {
+			clear(c.missing)
+		}
+		c.missing[name] = true
+		return nil
+	}
+	c.entries[name] = c.order.PushFront(&moduleEntry{name: name, index: index})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*moduleEntry).name)
+	}
+	return index
+}
+
+func (c *moduleCache) parse(name string) *WorkspaceIndex {
+	path := FindModuleFile(name, c.roots)
+	if path == "" {
+		return nil
+	}
+	if c.maxFileSize > 0 {
+		info, err := os.Stat(path)
+		if err != nil || info.Size() > c.maxFileSize {
+			return nil
+		}
+	}
+	index := newWorkspaceIndex()
+	if err := indexFileWithOptions(path, index, true); err != nil {
+		return nil
+	}
+	index.Files = 1
+	return index
+}
+
+func (c *moduleCache) len() int {
+	if c == nil {
+		return 0
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
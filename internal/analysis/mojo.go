@@ -0,0 +1,123 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// mojoBaseBuilder is the class builder of Mojo::Base. "use Mojo::Base
+// 'Parent'" sets the parent and "-base" makes the package a Mojo::Base
+// subclass; both, and "-role", enable "has". Every form enables strict,
+// warnings, utf8 and the 5.16 feature bundle, and the -signatures and
+// -async_await flags enable those features. Mojolicious::Lite enables
+// the same pragmas through Mojo::Base.
+type mojoBaseBuilder struct{}
+
+func (mojoBaseBuilder) Pragmas(n *ppi.Node) []string {
+	if n.Name != "Mojo::Base" && n.Name != "Mojolicious::Lite" {
+		return nil
+	}
+	out := []string{"strict", "warnings", "utf8", ":5.16"}
+	_, flags := mojoBaseArgs(n)
+	for _, flag := range flags {
+		switch flag {
+		case "signatures":
+			out = append(out, "signatures")
+		case "async", "async_await":
+			out = append(out, "async_await")
+		}
+	}
+	return out
+}
+
+func (mojoBaseBuilder) Parents(doc *ppi.Document, inh *Inheritance) {
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::include" || n.Keyword != "use" || n.Name != "Mojo::Base" {
+			return
+		}
+		start, _, ok := nodeTokenRange(n)
+		if !ok {
+			return
+		}
+		if parent, _ := mojoBaseArgs(n); parent != "" {
+			inh.set(packageOrMain(doc, start), []string{parent})
+		}
+	})
+}
+
+// Methods returns the accessors "has" generates. A Mojo::Base accessor
+// reads the attribute, or sets it and returns the invocant.
+func (mojoBaseBuilder) Methods(doc *ppi.Document) []Accessor {
+	classes := make(map[string]bool)
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::include" || n.Keyword != "use" || n.Name != "Mojo::Base" {
+			return
+		}
+		start, _, ok := nodeTokenRange(n)
+		if !ok {
+			return
+		}
+		parent, flags := mojoBaseArgs(n)
+		role := false
+		for _, flag := range flags {
+			role = role || flag == "role"
+		}
+		if parent != "" || role {
+			classes[packageOrMain(doc, start)] = true
+		}
+	})
+	var out []Accessor
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::expression" || n.Keyword != "has" {
+			return
+		}
+		start, _, ok := nodeTokenRange(n)
+		if !ok {
+			return
+		}
+		pkg := packageOrMain(doc, start)
+		if !classes[pkg] {
+			return
+		}
+		ts := significantTokens(n.Tokens)
+		if len(ts) < 2 {
+			return
+		}
+		names, _ := attrNames(ts, 1)
+		for _, attr := range names {
+			out = append(out, Accessor{
+				Package:   pkg,
+				Name:      attr.name,
+				Attribute: attr.name,
+				Kind:      "accessor",
+				Sig:       accessorSig("accessor", "any"),
+				Decl:      "has " + attr.name,
+				Start:     attr.start,
+				End:       attr.end,
+			})
+		}
+	})
+	return out
+}
+
+// mojoBaseArgs returns the parent class and the flags, without the leading
+// "-", of a "use Mojo::Base" statement. -base stands for Mojo::Base itself.
+func mojoBaseArgs(n *ppi.Node) (string, []string) {
+	parent := ""
+	var flags []string
+	for _, item := range n.ImportItems {
+		item = strings.ReplaceAll(unquote(strings.TrimSpace(item)), " ", "")
+		if flag, ok := strings.CutPrefix(item, "-"); ok {
+			flags = append(flags, flag)
+			if flag == "base" {
+				parent = "Mojo::Base"
+			}
+			continue
+		}
+		if parent == "" && isClassName(item) {
+			parent = item
+		}
+	}
+	return parent, flags
+}
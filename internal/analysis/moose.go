@@ -0,0 +1,478 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// mooseModules are the modules whose "has" declares attributes.
+var mooseModules = map[string]bool{
+	"Moose": true, "Moose::Role": true,
+	"Moo": true, "Moo::Role": true,
+	"Mouse": true, "Mouse::Role": true,
+}
+
+// Accessor is a method generated by a Moose, Moo or Mouse "has"
+// declaration, or by a class of the class feature.
+type Accessor struct {
+	Package string
+	Name    string
+	// Attribute is the attribute name, without a leading "+".
+	Attribute string
+	// Kind is reader, writer, accessor, predicate, clearer, builder or,
+	// for a class, constructor.
+	Kind string
+	// Sig is the :SIG of the method, derived from the isa constraint.
+	Sig string
+	// Decl is the declaration that generates the method, for display.
+	Decl string
+	// Start and End span the attribute name in the has statement.
+	Start int
+	End   int
+}
+
+// CollectAccessors returns the methods the class builders generate in doc:
+// the accessors of Moose, Moo, Mouse and Mojo::Base "has", of
+// Class::Accessor's mk_accessors, and the readers and constructors of
+// classes.
+func CollectAccessors(doc *ppi.Document) []Accessor {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	var out []Accessor
+	for _, b := range classBuilders {
+		out = append(out, b.Methods(doc)...)
+	}
+	return out
+}
+
+// mooseBuilder is the class builder of Moose, Moo and Mouse. Their "has"
+// declares attributes, "extends" sets the parents and "with" composes
+// roles.
+type mooseBuilder struct{}
+
+func (mooseBuilder) Pragmas(n *ppi.Node) []string {
+	if mooseModules[n.Name] {
+		return []string{"strict", "warnings"}
+	}
+	return nil
+}
+
+func (mooseBuilder) Parents(doc *ppi.Document, inh *Inheritance) {
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::expression" {
+			return
+		}
+		pos := nextNonTrivia(n.Tokens, 0)
+		if pos < 0 || n.Tokens[pos].Type != ppi.TokenWord || (n.Tokens[pos].Value != "extends" && n.Tokens[pos].Value != "with") {
+			return
+		}
+		pkg := packageOrMain(doc, n.Tokens[pos].Start)
+		if n.Tokens[pos].Value == "extends" {
+			inh.set(pkg, classNamesFromTokens(n.Tokens[pos+1:]))
+		} else {
+			inh.Roles[pkg] = append(inh.Roles[pkg], classNamesFromTokens(n.Tokens[pos+1:])...)
+		}
+	})
+}
+
+// Methods returns the methods generated by "has" in the packages that use
+// Moose, Moo or Mouse (or one of their role modules). Both
+// "has name => (...)" and "has [qw(a b)] => (...)" are recognized, as is
+// "has '+name'" for an inherited attribute.
+func (mooseBuilder) Methods(doc *ppi.Document) []Accessor {
+	moose := usingPackages(doc, mooseModules)
+	var out []Accessor
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::expression" || n.Keyword != "has" {
+			return
+		}
+		start, _, ok := nodeTokenRange(n)
+		if !ok {
+			return
+		}
+		pkg := packageOrMain(doc, start)
+		if !moose[pkg] {
+			return
+		}
+		out = append(out, hasAccessors(pkg, n.Tokens)...)
+	})
+	return out
+}
+
+func packageOrMain(doc *ppi.Document, offset int) string {
+	if pkg := doc.PackageAt(offset); pkg != "" {
+		return pkg
+	}
+	return "main"
+}
+
+// attrName is an attribute name and where it is written.
+type attrName struct {
+	name       string
+	start, end int
+}
+
+func hasAccessors(pkg string, tokens []ppi.Token) []Accessor {
+	ts := significantTokens(tokens)
+	if len(ts) < 2 {
+		return nil
+	}
+	names, pos := attrNames(ts, 1)
+	if len(names) == 0 || pos >= len(ts) || ts[pos].Type != ppi.TokenOperator || (ts[pos].Value != "=>" && ts[pos].Value != ",") {
+		return nil
+	}
+	opts := attrOptions(ts[pos+1:])
+	var out []Accessor
+	for _, attr := range names {
+		for _, m := range attrMethods(attr.name, opts) {
+			m.Package = pkg
+			m.Attribute = attr.name
+			m.Start = attr.start
+			m.End = attr.end
+			m.Decl = "has " + attr.name
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+// attrNames reads the attribute names of a has statement starting at
+// ts[pos], returning them and the position after them.
+func attrNames(ts []ppi.Token, pos int) ([]attrName, int) {
+	tok := ts[pos]
+	switch {
+	case tok.Type == ppi.TokenWord:
+		return []attrName{{name: tok.Value, start: tok.Start, end: tok.End}}, pos + 1
+	case tok.Type == ppi.TokenQuote:
+		if name, ok := quotedAttrName(tok); ok {
+			return []attrName{name}, pos + 1
+		}
+		return nil, pos
+	case tok.Type == ppi.TokenOperator && tok.Value == "[":
+		end := closesAt(ts, pos)
+		if end < 0 {
+			return nil, pos
+		}
+		return listAttrNames(ts[pos+1 : end]), end + 1
+	}
+	return nil, pos
+}
+
+// listAttrNames reads the quoted and qw() names in a list of tokens.
+func listAttrNames(ts []ppi.Token) []attrName {
+	var names []attrName
+	for _, item := range ts {
+		switch item.Type {
+		case ppi.TokenQuote:
+			if name, ok := quotedAttrName(item); ok {
+				names = append(names, name)
+			}
+		case ppi.TokenQuoteLike:
+			from := 0
+			for _, name := range splitQW(item.Value) {
+				i := strings.Index(item.Value[from:], name) + from
+				from = i + len(name)
+				if name = strings.TrimPrefix(name, "+"); isIdent(name) {
+					names = append(names, attrName{name: name, start: item.Start + from - len(name), end: item.Start + from})
+				}
+			}
+		}
+	}
+	return names
+}
+
+// significantTokens drops whitespace, comments and heredoc bodies.
+func significantTokens(tokens []ppi.Token) []ppi.Token {
+	var ts []ppi.Token
+	for _, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenWhitespace, ppi.TokenComment, ppi.TokenHereDocContent:
+			continue
+		}
+		ts = append(ts, tok)
+	}
+	return ts
+}
+
+func quotedAttrName(tok ppi.Token) (attrName, bool) {
+	name := strings.TrimPrefix(unquote(tok.Value), "+")
+	if !isIdent(name) {
+		return attrName{}, false
+	}
+	return attrName{name: name, start: tok.End - 1 - len(name), end: tok.End - 1}, true
+}
+
+// attrOptions reads the key => value options of a has statement. Values
+// are kept as tokens.
+func attrOptions(ts []ppi.Token) map[string][]ppi.Token {
+	if len(ts) > 0 && ts[0].Type == ppi.TokenOperator && ts[0].Value == "(" {
+		if end := closesAt(ts, 0); end > 0 {
+			ts = ts[1:end]
+		}
+	}
+	opts := make(map[string][]ppi.Token)
+	for i := 0; i+1 < len(ts); {
+		if ts[i+1].Type != ppi.TokenOperator || (ts[i+1].Value != "=>" && ts[i+1].Value != ",") {
+			break
+		}
+		end := i + 2
+		for depth := 0; end < len(ts); end++ {
+			v := ts[end]
+			if v.Type != ppi.TokenOperator {
+				continue
+			}
+			switch v.Value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			}
+			if depth == 0 && (v.Value == "," || v.Value == ";") {
+				break
+			}
+		}
+		opts[unquote(ts[i].Value)] = ts[i+2 : end]
+		i = end + 1
+	}
+	return opts
+}
+
+// optString returns an option whose value is a string or number.
+func optString(opts map[string][]ppi.Token, key string) string {
+	v := opts[key]
+	if len(v) != 1 {
+		return ""
+	}
+	switch v[0].Type {
+	case ppi.TokenQuote, ppi.TokenNumber, ppi.TokenWord:
+		return unquote(v[0].Value)
+	}
+	return ""
+}
+
+// attrMethods returns the methods an attribute with the given options
+// generates, following the naming rules of Moose and Moo. A value of 1 for
+// predicate, clearer or builder picks the default name.
+func attrMethods(name string, opts map[string][]ppi.Token) []Accessor {
+	t := "any"
+	if v, ok := opts["isa"]; ok {
+		if mapped := MooseTypeSig(v); mapped != "" {
+			t = mapped
+		}
+	}
+	prefixed := func(prefix string) string {
+		if strings.HasPrefix(name, "_") {
+			return "_" + prefix + name
+		}
+		return prefix + "_" + name
+	}
+	option := func(key, def string) string {
+		v := optString(opts, key)
+		if v == "1" {
+			return def
+		}
+		return v
+	}
+	reader := optString(opts, "reader")
+	writer := optString(opts, "writer")
+	accessor := optString(opts, "accessor")
+	predicate := option("predicate", prefixed("has"))
+	clearer := option("clearer", prefixed("clear"))
+	builder := option("builder", "_build_"+name)
+	switch optString(opts, "is") {
+	case "ro":
+		if reader == "" {
+			reader = name
+		}
+	case "rw":
+		if writer != "" {
+			if reader == "" {
+				reader = name
+			}
+		} else if accessor == "" {
+			accessor = name
+		}
+	case "rwp":
+		if reader == "" {
+			reader = name
+		}
+		if writer == "" {
+			writer = "_set_" + name
+		}
+	case "lazy":
+		if reader == "" {
+			reader = name
+		}
+		if builder == "" {
+			builder = "_build_" + name
+		}
+	}
+	if v := optString(opts, "lazy_build"); v != "" && v != "0" {
+		if builder == "" {
+			builder = "_build_" + name
+		}
+		if clearer == "" {
+			clearer = prefixed("clear")
+		}
+		if predicate == "" {
+			predicate = prefixed("has")
+		}
+	}
+	var out []Accessor
+	for _, m := range []struct{ kind, name string }{
+		{"reader", reader},
+		{"writer", writer},
+		{"accessor", accessor},
+		{"predicate", predicate},
+		{"clearer", clearer},
+		{"builder", builder},
+	} {
+		if isIdent(m.name) {
+			out = append(out, Accessor{Name: m.name, Kind: m.kind, Sig: accessorSig(m.kind, t)})
+		}
+	}
+	return out
+}
+
+// accessorSig returns the :SIG of an accessor method for an attribute of
+// type t. The invocant is written as any, since the accessor may be
+// inherited or composed from a role.
+func accessorSig(kind, t string) string {
+	switch kind {
+	case "reader", "builder":
+		return "any -> " + t
+	case "writer":
+		return "(any, " + t + ") -> " + t
+	case "accessor":
+		return "(any, " + t + "?) -> " + t
+	case "predicate":
+		return "any -> bool"
+	case "clearer":
+		return "any -> void"
+	}
+	return ""
+}
+
+// mooseTypes maps Moose and Types::Standard type constraints to :SIG
+// types.
+var mooseTypes = map[string]string{
+	"Any": "any", "Item": "any", "Defined": "any", "Value": "any", "Object": "any",
+	"Ref": "any", "ScalarRef": "any",
+	"Str": "str", "NonEmptyStr": "str", "SimpleStr": "str", "NonEmptySimpleStr": "str",
+	"ClassName": "str", "RoleName": "str", "Enum": "str",
+	"Int": "int", "PositiveInt": "int", "PositiveOrZeroInt": "int", "NegativeInt": "int",
+	"Num": "num", "PositiveNum": "num", "PositiveOrZeroNum": "num", "NegativeNum": "num",
+	"Bool": "bool", "Undef": "undef",
+	"CodeRef": "code", "RegexpRef": "regexp", "GlobRef": "glob", "FileHandle": "glob",
+	"ArrayRef": "array[any]", "HashRef": "hash[any]", "Dict": "hash[any]",
+}
+
+// MooseTypeSig converts the tokens of an isa => ... value to a :SIG type,
+// or returns "" when the constraint is not understood. A quoted name that
+// is not a built-in type stands for a class, as it does in Moose.
+func MooseTypeSig(tokens []ppi.Token) string {
+	var b strings.Builder
+	quoted := false
+	for _, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenWhitespace, ppi.TokenComment:
+			continue
+		case ppi.TokenQuote:
+			if len(tokens) == 1 {
+				quoted = true
+			}
+			b.WriteString(unquote(tok.Value))
+		case ppi.TokenWord, ppi.TokenOperator:
+			b.WriteString(tok.Value)
+		default:
+			return ""
+		}
+	}
+	sig, ok := mooseType(b.String(), quoted)
+	if !ok {
+		return ""
+	}
+	if err := ValidateSig(sig); err != nil {
+		return ""
+	}
+	return sig
+}
+
+func mooseType(s string, classNames bool) (string, bool) {
+	s = strings.TrimSpace(s)
+	if parts := splitTopLevel(s, '|'); len(parts) > 1 {
+		out := make([]string, len(parts))
+		for i, part := range parts {
+			t, ok := mooseType(part, classNames)
+			if !ok {
+				return "", false
+			}
+			out[i] = t
+		}
+		return strings.Join(out, "|"), true
+	}
+	base, param, hasParam := strings.Cut(s, "[")
+	if hasParam {
+		if !strings.HasSuffix(param, "]") {
+			return "", false
+		}
+		param = param[:len(param)-1]
+	}
+	if !hasParam {
+		if t, ok := mooseTypes[s]; ok {
+			return t, true
+		}
+		if classNames && isClassName(s) {
+			return s, true
+		}
+		return "", false
+	}
+	switch base {
+	case "Maybe":
+		t, ok := mooseType(param, classNames)
+		if !ok {
+			return "", false
+		}
+		return t + "|undef", true
+	case "ArrayRef", "HashRef":
+		t, ok := mooseType(param, classNames)
+		if !ok {
+			return "", false
+		}
+		if base == "ArrayRef" {
+			return "array[" + t + "]", true
+		}
+		return "hash[" + t + "]", true
+	case "InstanceOf", "ConsumerOf":
+		if isClassName(param) {
+			return param, true
+		}
+		return "", false
+	case "Enum", "Dict":
+		return mooseTypes[base], true
+	}
+	return "", false
+}
+
+// splitTopLevel splits s on sep outside brackets.
+func splitTopLevel(s string, sep byte) []string {
+	var out []string
+	depth := 0
+	start := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case sep:
+			if depth == 0 {
+				out = append(out, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(out, s[start:])
+}
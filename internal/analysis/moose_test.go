@@ -0,0 +1,115 @@
+package analysis
+
+import (
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func TestCollectAccessors(t *testing.T) {
+	src := `package Person;
+use Moose;
+has name => (is => 'ro', isa => 'Str', predicate => 'has_name');
+has [qw(age height)] => (is => 'rw', isa => 'Int');
+has '+id', is => 'rwp', clearer => 1;
+has _cache => (is => 'bare', lazy_build => 1, isa => 'HashRef[Person]');
+has pet => (is => 'rw', writer => 'set_pet', isa => 'Maybe[Animal]');
+package Plain;
+has ignored => (is => 'ro');
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var got []string
+	for _, acc := range CollectAccessors(doc) {
+		if acc.Package != "Person" {
+			t.Fatalf("unexpected package: %+v", acc)
+		}
+		got = append(got, acc.Kind+" "+acc.Name+" :SIG("+acc.Sig+")")
+	}
+	want := []string{
+		"reader name :SIG(any -> str)",
+		"predicate has_name :SIG(any -> bool)",
+		"accessor age :SIG((any, int?) -> int)",
+		"accessor height :SIG((any, int?) -> int)",
+		"reader id :SIG(any -> any)",
+		"writer _set_id :SIG((any, any) -> any)",
+		"clearer clear_id :SIG(any -> void)",
+		"predicate _has_cache :SIG(any -> bool)",
+		"clearer _clear_cache :SIG(any -> void)",
+		"builder _build__cache :SIG(any -> hash[Person])",
+		"reader pet :SIG(any -> Animal|undef)",
+		"writer set_pet :SIG((any, Animal|undef) -> Animal|undef)",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("accessor %d: expected %q, got %q", i, want[i], got[i])
+		}
+	}
+	accs := CollectAccessors(doc)
+	if name := src[accs[0].Start:accs[0].End]; name != "name" {
+		t.Fatalf("unexpected name range %q", name)
+	}
+	if name := src[accs[3].Start:accs[3].End]; name != "height" {
+		t.Fatalf("unexpected qw name range %q", name)
+	}
+	if name := src[accs[4].Start:accs[4].End]; name != "id" {
+		t.Fatalf("unexpected +name range %q", name)
+	}
+}
+
+func TestMooseTypeSig(t *testing.T) {
+	cases := map[string]string{
+		"has x => (isa => Str);":                       "str",
+		"has x => (isa => 'Int|Undef');":               "int|undef",
+		"has x => (isa => InstanceOf['Foo::Bar']);":    "Foo::Bar",
+		"has x => (isa => ArrayRef[Foo]);":             "",
+		"has x => (isa => 'ArrayRef[Foo]');":           "array[Foo]",
+		"has x => (isa => ArrayRef[InstanceOf['A']]);": "array[A]",
+		"has x => (isa => 'Some::Class');":             "Some::Class",
+		"has x => (isa => CustomType);":                "",
+		"has x => (isa => sub { 1 });":                 "",
+	}
+	for src, want := range cases {
+		doc := ppi.NewDocument(src)
+		doc.ParseWithDiagnostics()
+		var ts []ppi.Token
+		for _, tok := range doc.Tokens {
+			if tok.Type != ppi.TokenWhitespace {
+				ts = append(ts, tok)
+			}
+		}
+		opts := attrOptions(ts[3 : len(ts)-1])
+		if got := MooseTypeSig(opts["isa"]); got != want {
+			t.Fatalf("%s: expected %q, got %q", src, want, got)
+		}
+	}
+}
+
+func TestSigCallDiagnosticsAccessors(t *testing.T) {
+	src := `package Person;
+use Moo;
+has age => (is => 'rw', isa => Int);
+package main;
+# :SIG(Person)
+my $p = Person->new;
+$p->age(3);
+$p->age("x");
+$p->age(1, 2);
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var msgs []string
+	for _, d := range SigCallDiagnostics(doc) {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"arg 1 of Person->age: expected int, got str",
+		"call to Person->age: expected 0 to 1 args, got 2",
+	}
+	if len(msgs) != len(want) || msgs[0] != want[0] || msgs[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, msgs)
+	}
+}
@@ -0,0 +1,454 @@
+package analysis
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// PragmaState is the set of lexical pragmas in effect at a point of a
+// document: whether strict is on, which features are enabled and which
+// warning categories are on.
+type PragmaState struct {
+	Strict   bool
+	Features map[string]bool
+	// Warnings is set by "use warnings" and cleared by "no warnings".
+	// WarningCategories overrides it for the categories named in a use or
+	// no warnings list.
+	Warnings          bool
+	WarningCategories map[string]bool
+}
+
+// defaultFeatures are the features enabled before any use statement.
+var defaultFeatures = []string{"bareword_filehandles", "indirect", "multidimensional"}
+
+// featureBundles lists, by Perl minor version, the features each bundle
+// enables and disables relative to the previous one.
+var featureBundles = []struct {
+	minor  int
+	add    []string
+	remove []string
+}{
+	{10, []string{"bareword_filehandles", "indirect", "multidimensional", "say", "state", "switch"}, nil},
+	{12, []string{"unicode_strings"}, nil},
+	{16, []string{"current_sub", "evalbytes", "fc", "unicode_eval"}, nil},
+	{24, []string{"postderef_qq"}, nil},
+	{28, []string{"bitwise"}, nil},
+	{36, []string{"isa", "signatures"}, []string{"indirect", "multidimensional", "switch"}},
+	{37, []string{"module_true"}, []string{"bareword_filehandles"}},
+	{40, []string{"try"}, nil},
+}
+
+// knownFeatures are the feature names "use feature" and "use experimental"
+// accept.
+var knownFeatures = map[string]bool{
+	"bareword_filehandles": true, "bitwise": true, "class": true,
+	"current_sub": true, "declared_refs": true, "defer": true,
+	"evalbytes": true, "extra_paired_delimiters": true, "fc": true,
+	"indirect": true, "isa": true, "module_true": true,
+	"multidimensional": true, "postderef": true, "postderef_qq": true,
+	"refaliasing": true, "say": true, "signatures": true, "state": true,
+	"switch": true, "try": true, "unicode_eval": true,
+	"unicode_strings": true,
+}
+
+// modernPerlYears maps the year argument of Modern::Perl to the feature
+// bundle it enables.
+var modernPerlYears = map[string]int{
+	"2009": 10, "2010": 10, "2011": 12, "2012": 14, "2013": 16,
+	"2014": 18, "2015": 20, "2016": 24, "2017": 24, "2018": 26,
+	"2019": 28, "2020": 30, "2021": 32, "2022": 34, "2023": 36,
+	"2024": 38, "2025": 40,
+}
+
+// bundleFeatures returns the features of the bundle for Perl 5.minor, or
+// nil before 5.10, which has no bundle.
+func bundleFeatures(minor int) map[string]bool {
+	if minor < 10 {
+		return nil
+	}
+	out := make(map[string]bool)
+	for _, b := range featureBundles {
+		if b.minor > minor {
+			break
+		}
+		for _, f := range b.add {
+			out[f] = true
+		}
+		for _, f := range b.remove {
+			delete(out, f)
+		}
+	}
+	return out
+}
+
+// PragmasAt returns the pragmas in effect at offset. use and no statements
+// apply up to the end of the enclosing block.
+func PragmasAt(doc *ppi.Document, offset int) PragmaState {
+	state := PragmaState{Features: make(map[string]bool)}
+	for _, f := range defaultFeatures {
+		state.Features[f] = true
+	}
+	if doc == nil || doc.Root == nil {
+		return state
+	}
+	return pragmasAtNodes(doc.Root.Children, offset, state)
+}
+
+func pragmasAtNodes(nodes []*ppi.Node, offset int, state PragmaState) PragmaState {
+	for _, n := range nodes {
+		if n == nil {
+			continue
+		}
+		start, end, ok := nodeTokenRange(n)
+		if ok && offset < start {
+			return state
+		}
+		if blk := nodeBlockChild(n); blk != nil {
+			bs, be, ok := nodeTokenRange(blk)
+			if ok && offset >= bs && offset < be {
+				return pragmasAtNodes(blk.Children, offset, state)
+			}
+		}
+		if next, changed := applyPragma(state, n); changed {
+			if ok && offset < end {
+				return state
+			}
+			state = next
+		}
+	}
+	return state
+}
+
+// IsPragmaStatement reports whether n changes the pragmas in effect.
+func IsPragmaStatement(n *ppi.Node) bool {
+	_, changed := applyPragma(PragmaState{Features: map[string]bool{}}, n)
+	return changed
+}
+
+// applyPragma returns the state after the use or no statement n. The
+// state is copied, never modified in place, as it is shared with outer
+// blocks.
+func applyPragma(state PragmaState, n *ppi.Node) (PragmaState, bool) {
+	if n == nil || n.Kind != "statement::include" {
+		return state, false
+	}
+	keyword := strings.ToLower(n.Keyword)
+	if keyword != "use" && keyword != "no" {
+		return state, false
+	}
+	next := state.clone()
+	if n.Name == "" && n.Version != "" {
+		if keyword != "use" {
+			return state, false
+		}
+		major, minor, _, ok := parsePerlVersion(n.Version)
+		if !ok || major != 5 || minor < 10 {
+			return state, false
+		}
+		next.Features = bundleFeatures(minor)
+		if isStrictVersion(n.Version) {
+			next.Strict = true
+		}
+		if minor >= 35 {
+			next.setWarnings(nil, true)
+		}
+		return next, true
+	}
+	switch n.Name {
+	case "strict":
+		next.Strict = keyword == "use"
+		return next, true
+	case "warnings":
+		next.setWarnings(importWords(n.ImportItems), keyword == "use")
+		return next, true
+	case "feature":
+		for _, item := range importWords(n.ImportItems) {
+			next.setFeature(item, keyword == "use")
+		}
+		return next, true
+	case "experimental":
+		if keyword != "use" {
+			return state, false
+		}
+		for _, item := range importWords(n.ImportItems) {
+			next.setFeature(item, true)
+		}
+		return next, true
+	}
+	if keyword != "use" {
+		return state, false
+	}
+	pragmas := modulePragmas(n)
+	if len(pragmas) == 0 {
+		return state, false
+	}
+	for _, p := range pragmas {
+		switch p {
+		case "strict":
+			next.Strict = true
+		case "warnings":
+			next.setWarnings(nil, true)
+		default:
+			next.setFeature(p, true)
+		}
+	}
+	return next, true
+}
+
+func (s PragmaState) clone() PragmaState {
+	next := PragmaState{Strict: s.Strict, Warnings: s.Warnings, Features: make(map[string]bool, len(s.Features))}
+	for f := range s.Features {
+		next.Features[f] = true
+	}
+	if len(s.WarningCategories) > 0 {
+		next.WarningCategories = make(map[string]bool, len(s.WarningCategories))
+		for c, on := range s.WarningCategories {
+			next.WarningCategories[c] = on
+		}
+	}
+	return next
+}
+
+// setWarnings applies a use or no warnings list. An empty list, or "all",
+// switches every category.
+func (s *PragmaState) setWarnings(categories []string, on bool) {
+	named := false
+	for _, c := range categories {
+		switch c {
+		case "FATAL", "NONFATAL":
+			continue
+		case "all":
+			s.Warnings = on
+			s.WarningCategories = nil
+		default:
+			if s.WarningCategories == nil {
+				s.WarningCategories = make(map[string]bool)
+			}
+			s.WarningCategories[c] = on
+		}
+		named = true
+	}
+	if !named {
+		s.Warnings = on
+		s.WarningCategories = nil
+	}
+}
+
+// warningParents maps warning categories to the category that contains
+// them.
+var warningParents = map[string]string{
+	"ambiguous": "syntax", "bareword": "syntax", "digit": "syntax",
+	"illegalproto": "syntax", "parenthesis": "syntax", "precedence": "syntax",
+	"printf": "syntax", "prototype": "syntax", "qw": "syntax",
+	"reserved": "syntax", "semicolon": "syntax",
+}
+
+// WarningEnabled reports whether warnings of category are on.
+func (s PragmaState) WarningEnabled(category string) bool {
+	for c := category; c != ""; c = warningParents[c] {
+		if on, ok := s.WarningCategories[c]; ok {
+			return on
+		}
+	}
+	return s.Warnings
+}
+
+// setFeature enables or disables a feature, a bundle such as ":5.10", or
+// every feature with ":all".
+func (s *PragmaState) setFeature(name string, on bool) {
+	switch {
+	case name == ":all":
+		if !on {
+			s.Features = make(map[string]bool)
+			return
+		}
+		for f := range knownFeatures {
+			s.Features[f] = true
+		}
+	case strings.HasPrefix(name, ":"):
+		if _, minor, _, ok := parsePerlVersion(name[1:]); ok {
+			for f := range bundleFeatures(minor) {
+				s.setFeature(f, on)
+			}
+		}
+	case name == "postderef":
+		s.setFeature("postderef_qq", on)
+	case knownFeatures[name]:
+		if on {
+			s.Features[name] = true
+		} else {
+			delete(s.Features, name)
+		}
+	}
+}
+
+// FeatureList returns the enabled features, sorted.
+func (s PragmaState) FeatureList() []string {
+	out := make([]string, 0, len(s.Features))
+	for f := range s.Features {
+		out = append(out, f)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// bundlePragmas lists other modules that enable pragmas in the code that
+// uses them.
+var bundlePragmas = map[string][]string{
+	"perl5i::2":               {"strict", "warnings", ":5.10"},
+	"perl5i::latest":          {"strict", "warnings", ":5.10"},
+	"strictures":              {"strict", "warnings"},
+	"Test2::V0":               {"strict", "warnings"},
+	"Test2::Bundle::Extended": {"strict", "warnings"},
+	"Test::Most":              {"strict", "warnings"},
+	"Test::Modern":            {"strict", "warnings"},
+	"Test::Class::Moose":      {"strict", "warnings"},
+	"Dancer":                  {"strict", "warnings"},
+	"Dancer2":                 {"strict", "warnings"},
+	"Role::Tiny":              {"strict", "warnings"},
+}
+
+// modulePragmas returns the pragmas a use statement of a module enables,
+// in the vocabulary of setFeature plus "strict": the class builders, the
+// Modern::Perl and common::sense bundles and bundlePragmas.
+func modulePragmas(n *ppi.Node) []string {
+	switch n.Name {
+	case "Modern::Perl":
+		minor := 10
+		for _, item := range importWords(n.ImportItems) {
+			if m, ok := modernPerlYears[item]; ok {
+				minor = m
+			}
+		}
+		return []string{"strict", "warnings", ":5." + strconv.Itoa(minor)}
+	case "common::sense":
+		return []string{"strict", "warnings", "say", "state", "switch", "current_sub", "fc", "evalbytes"}
+	}
+	if pragmas, ok := bundlePragmas[n.Name]; ok {
+		return pragmas
+	}
+	return BuilderPragmas(n)
+}
+
+// importWords unquotes the import items of a use statement.
+func importWords(items []string) []string {
+	var out []string
+	for _, item := range items {
+		if word := unquote(strings.TrimSpace(item)); word != "" {
+			out = append(out, word)
+		}
+	}
+	return out
+}
+
+// FeatureDiagnostic reports syntax that needs a feature that is not
+// enabled where it is used.
+type FeatureDiagnostic struct {
+	Message string
+	Offset  int
+	Feature string
+}
+
+var signatureVar = regexp.MustCompile(`[$@%][A-Za-z_]`)
+
+var postderefInString = regexp.MustCompile(`->(?:[@%]\*|\$#\*|@[\[{])`)
+
+// FeatureDiagnostics reports say, sub signatures, the isa operator and
+// postfix dereference in strings used where their feature is not enabled.
+func FeatureDiagnostics(doc *ppi.Document) []FeatureDiagnostic {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	localSubs := make(map[string]bool)
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n != nil && n.Kind == "statement::sub" && n.Name != "" {
+			localSubs[n.Name] = true
+		}
+	})
+	var out []FeatureDiagnostic
+	report := func(offset int, feature, what, enable string) {
+		if PragmasAt(doc, offset).Features[feature] {
+			return
+		}
+		out = append(out, FeatureDiagnostic{
+			Message: what + " used without the " + feature + " feature (" + enable + ")",
+			Offset:  offset,
+			Feature: feature,
+		})
+	}
+	tokens := doc.Tokens
+	for i, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenWord:
+			prev := prevNonTrivia(tokens, i-1)
+			next := nextNonTrivia(tokens, i+1)
+			if prev >= 0 && tokens[prev].Type == ppi.TokenOperator && tokens[prev].Value == "->" {
+				continue
+			}
+			if next >= 0 && tokens[next].Type == ppi.TokenOperator && tokens[next].Value == "=>" {
+				continue
+			}
+			switch tok.Value {
+			case "say":
+				if localSubs["say"] || isHashKeyWord(tokens, prev, next) {
+					continue
+				}
+				report(tok.Start, "say", "say", "use feature 'say' or use v5.10")
+			case "isa":
+				if prev < 0 || !isOperandEnd(tokens[prev]) || next < 0 || tokens[next].Type == ppi.TokenOperator && tokens[next].Value == "(" {
+					continue
+				}
+				report(tok.Start, "isa", "isa operator", "use feature 'isa' or use v5.36")
+			case "sub":
+				proto := next
+				if proto >= 0 && tokens[proto].Type == ppi.TokenWord {
+					proto = nextNonTrivia(tokens, proto+1)
+				}
+				if proto >= 0 && tokens[proto].Type == ppi.TokenPrototype && signatureVar.MatchString(tokens[proto].Value) {
+					report(tokens[proto].Start, "signatures", "sub signature", "use feature 'signatures' or use v5.36")
+				}
+			}
+		case ppi.TokenQuote, ppi.TokenQuoteLike:
+			if !interpolates(tok.Value) {
+				continue
+			}
+			if loc := postderefInString.FindStringIndex(tok.Value); loc != nil {
+				report(tok.Start+loc[0], "postderef_qq", "postfix dereference in a string", "use feature 'postderef_qq' or use v5.24")
+			}
+		}
+	}
+	return out
+}
+
+// isHashKeyWord reports whether the word between prev and next is a
+// bareword hash subscript such as {say}.
+func isHashKeyWord(tokens []ppi.Token, prev, next int) bool {
+	return prev >= 0 && next >= 0 &&
+		tokens[prev].Type == ppi.TokenOperator && tokens[prev].Value == "{" &&
+		tokens[next].Type == ppi.TokenOperator && tokens[next].Value == "}"
+}
+
+// isOperandEnd reports whether tok can end the left operand of an infix
+// operator.
+func isOperandEnd(tok ppi.Token) bool {
+	switch tok.Type {
+	case ppi.TokenSymbol, ppi.TokenNumber, ppi.TokenQuote:
+		return true
+	case ppi.TokenOperator:
+		return tok.Value == ")" || tok.Value == "]" || tok.Value == "}"
+	}
+	return false
+}
+
+// interpolates reports whether a quote token interpolates variables.
+func interpolates(value string) bool {
+	switch {
+	case strings.HasPrefix(value, `"`), strings.HasPrefix(value, "qq"):
+		return true
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package analysis
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func TestPragmasAt(t *testing.T) {
+	src := `use v5.36;
+my $a1;
+{
+    no feature 'signatures';
+    use feature ':5.10';
+    my $a2;
+}
+my $a3;
+use experimental qw(try postderef);
+no strict;
+my $a4;
+use Modern::Perl '2023';
+my $a5;
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	at := func(marker string) PragmaState {
+		return PragmasAt(doc, strings.Index(src, marker))
+	}
+	if s := at("$a1"); !s.Strict || !s.Features["say"] || !s.Features["signatures"] || s.Features["switch"] || s.Features["indirect"] {
+		t.Fatalf("unexpected state after use v5.36: %+v", s)
+	}
+	if s := at("$a2"); s.Features["signatures"] || !s.Features["switch"] || !s.Features["isa"] {
+		t.Fatalf("unexpected state in block: %+v", s)
+	}
+	if s := at("$a3"); !s.Features["signatures"] || s.Features["switch"] {
+		t.Fatalf("block pragmas leaked: %+v", s)
+	}
+	if s := at("$a4"); s.Strict || !s.Features["try"] || !s.Features["postderef_qq"] {
+		t.Fatalf("unexpected state after no strict: %+v", s)
+	}
+	if s := at("$a5"); !s.Strict || !s.Features["signatures"] {
+		t.Fatalf("unexpected state after Modern::Perl: %+v", s)
+	}
+
+	doc = ppi.NewDocument("use v5.10;\nmy $x;\n")
+	doc.ParseWithDiagnostics()
+	s := PragmasAt(doc, strings.Index(doc.Source, "$x"))
+	if want := []string{"bareword_filehandles", "indirect", "multidimensional", "say", "state", "switch"}; s.Strict || !reflect.DeepEqual(s.FeatureList(), want) {
+		t.Fatalf("expected %v without strict, got %+v", want, s)
+	}
+}
+
+func TestFeatureDiagnostics(t *testing.T) {
+	src := `use strict;
+say "hello";
+sub add ($x, $y) { $x + $y }
+sub proto($$) { }
+if ($obj isa Foo) { }
+$obj->isa('Foo');
+$obj->say;
+my %h = (say => 1);
+print "$ref->@*\n";
+print '$ref->@*';
+{
+    use v5.36;
+    say "ok";
+    sub mul ($x, $y) { $x * $y }
+    if ($obj isa Foo) { }
+    print "$ref->@*\n";
+}
+use feature 'say';
+say "ok";
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var got []string
+	for _, d := range FeatureDiagnostics(doc) {
+		line := strings.Count(src[:d.Offset], "\n") + 1
+		got = append(got, d.Feature+"@"+strconv.Itoa(line))
+	}
+	want := []string{"say@2", "signatures@3", "isa@5", "postderef_qq@9"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	diags := FeatureDiagnostics(doc)
+	if diags[0].Message != "say used without the say feature (use feature 'say' or use v5.10)" {
+		t.Fatalf("unexpected message: %q", diags[0].Message)
+	}
+
+	doc = ppi.NewDocument("use Mojo::Base -base, -signatures;\nsub run ($self) { say 'x' }\n")
+	doc.ParseWithDiagnostics()
+	if diags := FeatureDiagnostics(doc); len(diags) != 0 {
+		t.Fatalf("Mojo::Base enables signatures and say: %+v", diags)
+	}
+
+	for _, src := range []string{
+		"use Mojolicious::Lite -signatures;\nget '/' => sub ($c) { say 'x' };\n",
+		"use perl5i::2;\nsay 'x';\n",
+	} {
+		doc = ppi.NewDocument(src)
+		doc.ParseWithDiagnostics()
+		if diags := FeatureDiagnostics(doc); len(diags) != 0 {
+			t.Fatalf("expected no feature diagnostics for %q, got %+v", src, diags)
+		}
+	}
+}
@@ -36,6 +36,39 @@ bar();
 	}
 }
 
+func TestSigCallDiagnosticsOptional(t *testing.T) {
+	src := `
+# :SIG((any, hash[any]?) -> void)
+sub opt {
+}
+opt(1);
+opt(1, {});
+opt();
+opt(1, {}, 2);
+# :SIG((any, ...any) -> void)
+sub rest {
+}
+rest(1, 2, 3);
+rest();
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	diags := SigCallDiagnostics(doc)
+	var msgs []string
+	for _, d := range diags {
+		msgs = append(msgs, d.Message)
+	}
+	if len(msgs) != 3 {
+		t.Fatalf("expected 3 diags, got %v", msgs)
+	}
+	if !contains(msgs, "expected 1 to 2 args, got 0") || !contains(msgs, "expected 1 to 2 args, got 3") {
+		t.Fatalf("expected optional arity messages, got %v", msgs)
+	}
+	if !contains(msgs, "expected at least 1 args, got 0") {
+		t.Fatalf("expected slurpy arity message, got %v", msgs)
+	}
+}
+
 func contains(list []string, needle string) bool {
 	for _, item := range list {
 		if strings.Contains(item, needle) {
@@ -44,3 +77,315 @@ func contains(list []string, needle string) bool {
 	}
 	return false
 }
+
+func TestSigCallDiagnosticsArgTypes(t *testing.T) {
+	src := `package Animal;
+sub new { bless {}, shift }
+package Dog;
+use parent -norequire, 'Animal';
+package main;
+# :SIG((int, str, Animal, hash{name: str, age: int?}, code?) -> void)
+sub foo {
+}
+# :SIG(void -> Dog)
+sub make_dog {
+}
+# :SIG(str)
+my $name = "x";
+foo(1, "a", Dog->new, {name => 1}, sub { 1 });
+foo("1", 2, Animal->new(), {}, undef);
+foo(1.5, $name, make_dog(), [1]);
+foo(1, 'a', Other->new, {}, qr/x/);
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	diags := SigCallDiagnostics(doc)
+	var msgs []string
+	for _, d := range diags {
+		if !d.TypeMismatch {
+			t.Fatalf("unexpected count diagnostic: %s", d.Message)
+		}
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"arg 1 of foo: expected int, got str",
+		"arg 1 of foo: expected int, got num",
+		"arg 4 of foo: expected hash{name: str, age: int?}, got array[any]",
+		"arg 3 of foo: expected Animal, got Other",
+		"arg 5 of foo: expected code, got regexp",
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("expected %d diags, got %v", len(want), msgs)
+	}
+	for _, w := range want {
+		if !contains(msgs, w) {
+			t.Fatalf("expected %q, got %v", w, msgs)
+		}
+	}
+
+	diags = SigCallDiagnosticsWithOptions(doc, SigCheckOptions{SkipTypes: true})
+	if len(diags) != 0 {
+		t.Fatalf("expected no diags with SkipTypes, got %v", diags)
+	}
+}
+
+func TestSigCallDiagnosticsSignatureVarTypes(t *testing.T) {
+	src := `
+# :SIG(int -> void)
+sub takes_int {
+}
+# :SIG((str, int?) -> void)
+sub wrapper ($s, $n) {
+    takes_int($s);
+    takes_int($n);
+}
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	diags := SigCallDiagnostics(doc)
+	var msgs []string
+	for _, d := range diags {
+		msgs = append(msgs, d.Message)
+	}
+	if len(msgs) != 2 || !contains(msgs, "expected int, got str") || !contains(msgs, "expected int, got int|undef") {
+		t.Fatalf("unexpected diags: %v", msgs)
+	}
+}
+
+func TestSigCallDiagnosticsMethodCalls(t *testing.T) {
+	src := `package Animal;
+# :SIG((Animal, int) -> void)
+sub feed {
+}
+sub new { bless {}, shift }
+package Dog;
+use parent -norequire, 'Animal';
+# :SIG((Dog, str, int?) -> void)
+sub bark {
+}
+sub run {
+    my $self = shift;
+    $self->feed;
+    $self->bark("woof", 2);
+}
+package main;
+# :SIG(Dog)
+my $dog = Dog->new;
+$dog->feed(1);
+$dog->feed("x");
+$dog->bark;
+Dog->bark(1, 2, 3);
+Animal->feed(1, 2);
+$other->feed;
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var msgs []string
+	for _, d := range SigCallDiagnostics(doc) {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"call to Dog->feed: expected 1 args, got 0",
+		"arg 1 of Dog->feed: expected int, got str",
+		"call to Dog->bark: expected 1 to 2 args, got 0",
+		"call to Dog->bark: expected 1 to 2 args, got 3",
+		"call to Animal->feed: expected 1 args, got 2",
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("expected %d diags, got %v", len(want), msgs)
+	}
+	for _, w := range want {
+		if !contains(msgs, w) {
+			t.Fatalf("missing %q in %v", w, msgs)
+		}
+	}
+}
+
+func TestSigCallDiagnosticsMethodSubSig(t *testing.T) {
+	src := `package main;
+# :SIG(Child)
+my $c = Child->new;
+$c->greet("x");
+$c->plain(1, 2, 3);
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	opts := SigCheckOptions{
+		Parents: func(pkg string) []string {
+			if pkg == "Child" {
+				return []string{"Base"}
+			}
+			return nil
+		},
+		SubSig: func(pkg, name string) (string, bool) {
+			switch pkg + "::" + name {
+			case "Base::greet":
+				return "(Base, num) -> void", true
+			case "Base::plain":
+				return "", true
+			}
+			return "", false
+		},
+	}
+	diags := SigCallDiagnosticsWithOptions(doc, opts)
+	if len(diags) != 1 || diags[0].Message != "arg 1 of Child->greet: expected num, got str" {
+		t.Fatalf("unexpected diags: %v", diags)
+	}
+}
+
+func TestSigCallDiagnosticsFuncSig(t *testing.T) {
+	src := `use My::Util qw(make_client);
+sub local_sub {
+}
+make_client();
+make_client(1, 2);
+local_sub(1);
+# :SIG(int)
+my $n = make_client("x");
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	opts := SigCheckOptions{
+		FuncSig: func(name string) string {
+			switch name {
+			case "make_client":
+				return "str -> My::Client"
+			case "local_sub":
+				return "void -> void"
+			}
+			return ""
+		},
+	}
+	var msgs []string
+	for _, d := range SigCallDiagnosticsWithOptions(doc, opts) {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"call to make_client: expected 1 args, got 0",
+		"call to make_client: expected 1 args, got 2",
+	}
+	if len(msgs) != len(want) || msgs[0] != want[0] || msgs[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, msgs)
+	}
+}
+
+func TestSigCallDiagnosticsTypeAliases(t *testing.T) {
+	src := `# :TYPE(Config = hash{host: str, port: int})
+# :SIG(Config -> void)
+sub connect_to {
+}
+connect_to({host => "a", port => 1});
+connect_to([1]);
+connect_to(Other::Config->new);
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	opts := SigCheckOptions{
+		Aliases: func(full string) (TypeAlias, bool) {
+			if full == "Other::Config" {
+				return TypeAlias{Package: "Other", Name: "Config", Sig: "int"}, true
+			}
+			return TypeAlias{}, false
+		},
+	}
+	var msgs []string
+	for _, d := range SigCallDiagnosticsWithOptions(doc, opts) {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"arg 1 of connect_to: expected hash{host: str, port: int}, got array[any]",
+		"arg 1 of connect_to: expected hash{host: str, port: int}, got Other::Config",
+	}
+	if len(msgs) != len(want) || msgs[0] != want[0] || msgs[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, msgs)
+	}
+}
+
+func TestSigReturnDiagnostics(t *testing.T) {
+	src := `package main;
+# :SIG(int -> Foo)
+sub make {
+    my ($n) = @_;
+    return if $n < 0;
+    return (1, 2) if $n > 9;
+    return "x" if $n == 1;
+    return Foo->new;
+}
+# :SIG(void -> void)
+sub log_it {
+    return 1;
+}
+# :SIG(void -> (int, str))
+sub pair {
+    return (1, "a");
+}
+# :SIG(void -> int)
+sub count {
+    my @items = (1, 2);
+    return @items;
+}
+# :SIG(void -> int?)
+sub maybe {
+    return;
+}
+# :SIG(int -> int)
+sub falls {
+    my ($n) = @_;
+    if ($n) {
+        return 1;
+    }
+}
+# :SIG(int -> int)
+sub branches {
+    my ($n) = @_;
+    if ($n) { 1 } else { "no" }
+}
+# :SIG(void -> int)
+sub nested {
+    my $cb = sub { return "x", "y" };
+    die "unreachable";
+}
+# :SIG(int -> int)
+sub negated {
+    my ($n) = @_;
+    unless ($n) { return 1 } else { return 2 }
+}
+# :SIG(int -> int)
+sub negated_chain {
+    my ($n) = @_;
+    unless ($n) {
+        my $x = 1;
+        return $x;
+    } elsif ($n > 1) { return "two" } else { 3 }
+}
+# :SIG(int -> int)
+sub negated_falls {
+    my ($n) = @_;
+    unless ($n) { return 1 }
+}
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var msgs []string
+	for _, d := range SigReturnDiagnostics(doc) {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"return from make: expected 1 values, got 0",
+		"return from make: expected 1 values, got 2",
+		"return value 1 of make: expected Foo, got str",
+		"sub log_it is declared void but returns a value",
+		"sub falls can end without returning int",
+		"return value 1 of branches: expected int, got str",
+		"return value 1 of negated_chain: expected int, got str",
+		"sub negated_falls can end without returning int",
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, msgs)
+	}
+	for i := range want {
+		if msgs[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, msgs)
+		}
+	}
+}
@@ -12,6 +12,21 @@ func TestValidateSigType(t *testing.T) {
 		"array[any]",
 		"hash[int]",
 		"array[hash[any]]",
+		"int|undef",
+		"Foo|Bar::Baz",
+		"int?",
+		"maybe[Foo]",
+		"array[int|Foo]",
+		"hash[maybe[int]]",
+		"str",
+		"num|bool",
+		"regexp",
+		"glob|filehandle",
+		"code",
+		"code[(str, int?) -> bool]",
+		"hash{name: str, age: int?}",
+		"hash{'content-type': str, tags: array[str],}",
+		"array[hash{id: int}]",
 	}
 	for _, sig := range ok {
 		if err := ValidateSig(sig); err != nil {
@@ -28,6 +43,11 @@ func TestValidateSigFunc(t *testing.T) {
 		"(any) -> (any)",
 		"(any, int) -> any",
 		"(any, array[int]) -> (any, any)",
+		"(Foo, hash[any]?) -> void",
+		"(Foo, int?, int?) -> void",
+		"(Foo, ...any) -> void",
+		"(Foo, int?, ...any) -> int|undef",
+		"...int -> void",
 	}
 	for _, sig := range ok {
 		if err := ValidateSig(sig); err != nil {
@@ -41,7 +61,7 @@ func TestParseSigArgs(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ParseSigArgs error: %v", err)
 	}
-	if len(args) != 2 || args[0] != "any" || args[1] != "int" {
+	if len(args) != 2 || args[0].Type.String() != "any" || args[1].Type.String() != "int" {
 		t.Fatalf("unexpected args: %#v", args)
 	}
 
@@ -59,7 +79,7 @@ func TestParseSigReturn(t *testing.T) {
 	if err != nil {
 		t.Fatalf("ParseSigReturn error: %v", err)
 	}
-	if len(ret) != 1 || ret[0] != "App::Foo" {
+	if len(ret) != 1 || ret[0].Type.String() != "App::Foo" {
 		t.Fatalf("expected App::Foo, got %#v", ret)
 	}
 
@@ -89,3 +109,161 @@ func TestValidateSigInvalid(t *testing.T) {
 		}
 	}
 }
+
+func TestValidateSigOptionalInvalid(t *testing.T) {
+	bad := []string{
+		"(int?, int) -> void",
+		"(...any, int) -> void",
+		"(Foo, ...int?) -> void",
+		"array[...int]",
+		"int|",
+		"|int",
+		"int??",
+		"maybe[]",
+		"void|int",
+	}
+	for _, sig := range bad {
+		if err := ValidateSig(sig); err == nil {
+			t.Fatalf("expected invalid sig %q", sig)
+		}
+	}
+}
+
+func TestSigFuncArity(t *testing.T) {
+	cases := []struct {
+		sig      string
+		min, max int
+	}{
+		{"void -> void", 0, 0},
+		{"(Foo, int) -> void", 2, 2},
+		{"(Foo, hash[any]?) -> void", 1, 2},
+		{"(Foo, int?, ...any) -> void", 1, -1},
+		{"...any -> void", 0, -1},
+	}
+	for _, c := range cases {
+		fn, err := ParseSigFunc(c.sig)
+		if err != nil {
+			t.Fatalf("ParseSigFunc(%q): %v", c.sig, err)
+		}
+		if min, max := fn.Arity(); min != c.min || max != c.max {
+			t.Fatalf("Arity(%q) = %d, %d; want %d, %d", c.sig, min, max, c.min, c.max)
+		}
+	}
+}
+
+func TestParseSigCanonical(t *testing.T) {
+	cases := map[string]string{
+		"Foo::Bar":                            "Foo::Bar",
+		"array[ hash[ int ] ]":                "array[hash[int]]",
+		"maybe[Foo]":                          "Foo|undef",
+		"int | Foo?":                          "int|Foo|undef",
+		"int|int|undef":                       "int|undef",
+		"(void) -> (void)":                    "void -> void",
+		"(any) -> (Foo)":                      "any -> Foo",
+		"(Foo,int?,...any)->(int, Foo|undef)": "(Foo, int?, ...any) -> (int, Foo|undef)",
+	}
+	for sig, want := range cases {
+		got, err := ParseSig(sig)
+		if err != nil {
+			t.Fatalf("ParseSig(%q): %v", sig, err)
+		}
+		if got.String() != want {
+			t.Fatalf("ParseSig(%q) = %q, want %q", sig, got.String(), want)
+		}
+	}
+}
+
+func TestParseSigStructure(t *testing.T) {
+	got, err := ParseSig("(Foo, array[int]?) -> maybe[Bar]")
+	if err != nil {
+		t.Fatalf("ParseSig: %v", err)
+	}
+	fn, ok := got.(*FuncType)
+	if !ok || len(fn.Params) != 2 || len(fn.Returns) != 1 {
+		t.Fatalf("unexpected func: %#v", got)
+	}
+	if fn.Params[0].Type != (ClassType{Name: "Foo"}) {
+		t.Fatalf("unexpected first param: %#v", fn.Params[0])
+	}
+	if arr, ok := fn.Params[1].Type.(ArrayType); !ok || arr.Elem != (PrimType{Name: "int"}) || !fn.Params[1].Optional {
+		t.Fatalf("unexpected second param: %#v", fn.Params[1])
+	}
+	if class, ok := ClassName(fn.Returns[0].Type); !ok || class != "Bar" {
+		t.Fatalf("expected maybe[Bar] to name Bar, got %q", class)
+	}
+	if _, ok := ClassName(UnionType{Types: []Type{ClassType{Name: "A"}, ClassType{Name: "B"}}}); ok {
+		t.Fatalf("did not expect a class for A|B")
+	}
+}
+
+func TestParseSigErrorOffset(t *testing.T) {
+	cases := map[string]int{
+		"(any, int":           9,
+		"array[]":             6,
+		"(Foo, %) -> x":       6,
+		"(int?, int) -> void": 7,
+	}
+	for sig, want := range cases {
+		_, err := ParseSig(sig)
+		sigErr, ok := err.(*SigError)
+		if !ok {
+			t.Fatalf("ParseSig(%q): expected *SigError, got %v", sig, err)
+		}
+		if sigErr.Offset != want {
+			t.Fatalf("ParseSig(%q): offset %d, want %d (%s)", sig, sigErr.Offset, want, sigErr.Msg)
+		}
+	}
+}
+
+func TestParseSigShapesAndCode(t *testing.T) {
+	got, err := ParseSig("(Foo, hash{name: str, age: int?, cb: code[str -> void]}) -> bool")
+	if err != nil {
+		t.Fatalf("ParseSig: %v", err)
+	}
+	want := "(Foo, hash{name: str, age: int?, cb: code[str -> void]}) -> bool"
+	if got.String() != want {
+		t.Fatalf("got %q, want %q", got.String(), want)
+	}
+	shape, ok := got.(*FuncType).Params[1].Type.(ShapeType)
+	if !ok {
+		t.Fatalf("expected shape, got %#v", got.(*FuncType).Params[1].Type)
+	}
+	if f, ok := shape.Field("age"); !ok || !f.Optional || f.Type.String() != "int" {
+		t.Fatalf("unexpected age field: %#v", f)
+	}
+	if _, ok := shape.Field("nmae"); ok {
+		t.Fatalf("did not expect nmae field")
+	}
+}
+
+func TestParseSigUnknownType(t *testing.T) {
+	cases := map[string]string{
+		"strng":                `unknown type "strng" (did you mean "str"?)`,
+		"(Foo, itn) -> void":   `unknown type "itn" (did you mean "int"?)`,
+		"int -> voi":           `unknown type "voi" (did you mean "void"?)`,
+		"array":                "array needs an element type, e.g. array[any]",
+		"hash{}":               "hash{} needs at least one field",
+		"hash{a: int, a: str}": `duplicate field "a"`,
+	}
+	for sig, want := range cases {
+		_, err := ParseSig(sig)
+		if err == nil || err.Error() != want {
+			t.Fatalf("ParseSig(%q): got %v, want %q", sig, err, want)
+		}
+	}
+	want := `unknown type "widget" (class names must contain an uppercase letter or ::)`
+	if err := ValidateSig("(Foo, widget) -> void"); err == nil || err.Error() != want || err.(*SigError).Offset != 6 {
+		t.Fatalf("ValidateSig(widget): got %v, want %q", err, want)
+	}
+	voi := `unknown type "voi" (class names must contain an uppercase letter or ::)`
+	if err := ValidateSig("(Foo, voi) -> int"); err == nil || err.Error() != voi {
+		t.Fatalf("ValidateSig(voi): got %v, want %q", err, voi)
+	}
+	known := SigScope{Known: func(class string) bool { return class == "version" || class == "Foo" }}
+	if err := ValidateSigInScope("(version, str) -> version", known); err != nil {
+		t.Fatalf("expected a known lowercase package to be accepted, got %v", err)
+	}
+	if err := ValidateSigInScope("(widget) -> void", known); err == nil || err.Error() != want {
+		t.Fatalf("ValidateSigInScope(widget): got %v, want %q", err, want)
+	}
+}
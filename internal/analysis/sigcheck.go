@@ -0,0 +1,555 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// SigCheckOptions configures SigCallDiagnosticsWithOptions.
+type SigCheckOptions struct {
+	// Parents returns the parent classes of packages not declared in the
+	// document, for example from the workspace index.
+	Parents func(pkg string) []string
+	// FuncSig returns the :SIG text of a sub called by name that the
+	// document does not define, such as an imported one.
+	FuncSig func(name string) string
+	// SubSig returns the :SIG text of pkg::name when the sub is defined
+	// outside the document, and whether such a sub exists at all.
+	SubSig func(pkg, name string) (string, bool)
+	// Aliases looks up :TYPE aliases declared outside the document by
+	// their package-qualified name.
+	Aliases func(fullName string) (TypeAlias, bool)
+	// SkipTypes disables argument type checks, leaving only count checks.
+	SkipTypes bool
+}
+
+// typeChecker infers the types of simple expressions in a document and
+// checks them against :SIG parameter types.
+type typeChecker struct {
+	doc     *ppi.Document
+	index   *Index
+	inh     Inheritance
+	parents func(string) []string
+	sigs    map[string]*FuncType
+	methods map[string]*FuncType
+	// accessors holds the methods generated by "has" and by classes,
+	// classMethods the methods of classes and subs the named subs, by
+	// Package::name.
+	accessors    map[string]Accessor
+	classMethods map[string]ClassMethod
+	subs         map[string]*ppi.Node
+	packageAt    func(offset int) string
+	aliases      func(string) (TypeAlias, bool)
+	opts         SigCheckOptions
+}
+
+func newTypeChecker(doc *ppi.Document, opts SigCheckOptions) *typeChecker {
+	c := &typeChecker{
+		doc:     doc,
+		index:   IndexDocument(doc),
+		inh:     CollectInheritance(doc),
+		subs:    SubsByPackage(doc),
+		sigs:    make(map[string]*FuncType),
+		methods: make(map[string]*FuncType),
+		opts:    opts,
+	}
+	c.packageAt = PackageLookup(doc)
+	c.classMethods = make(map[string]ClassMethod)
+	for _, class := range CollectClasses(doc) {
+		for _, method := range class.Methods {
+			if _, ok := c.classMethods[class.Name+"::"+method.Name]; !ok {
+				c.classMethods[class.Name+"::"+method.Name] = method
+			}
+		}
+	}
+	c.accessors = make(map[string]Accessor)
+	for _, acc := range CollectAccessors(doc) {
+		if _, ok := c.accessors[acc.Package+"::"+acc.Name]; !ok {
+			c.accessors[acc.Package+"::"+acc.Name] = acc
+		}
+	}
+	c.aliases = DocumentAliases(doc, opts.Aliases)
+	c.parents = func(pkg string) []string {
+		if parents, ok := c.inh.Parents[pkg]; ok {
+			return parents
+		}
+		if opts.Parents != nil {
+			return opts.Parents(pkg)
+		}
+		return nil
+	}
+	return c
+}
+
+func (c *typeChecker) scope(pkg string) SigScope {
+	return SigScope{Package: pkg, Alias: c.aliases}
+}
+
+// parseFunc parses a function :SIG written in pkg and expands its type
+// aliases. It returns nil for invalid signatures.
+func (c *typeChecker) parseFunc(sig, pkg string) *FuncType {
+	fn, err := ParseSigFunc(sig)
+	if err != nil {
+		return nil
+	}
+	expanded, err := c.scope(pkg).expandFunc(fn, nil, "")
+	if err != nil {
+		return nil
+	}
+	return expanded
+}
+
+// subSig returns the :SIG function type of the named sub in the document,
+// or of a sub defined elsewhere when the document has none by that name.
+func (c *typeChecker) subSig(name string) *FuncType {
+	if fn, ok := c.sigs[name]; ok {
+		return fn
+	}
+	var fn *FuncType
+	if node := findSubNode(c.doc.Root, name); node != nil {
+		if start, ok := nodeFirstNonTriviaStart(node); ok {
+			if sig := sigCommentBeforeOffset(c.doc.Source, start); sig != "" {
+				fn = c.parseFunc(sig, c.doc.PackageAt(start))
+			}
+		}
+	} else if c.opts.FuncSig != nil {
+		if sig := c.opts.FuncSig(name); sig != "" {
+			fn = c.parseFunc(sig, "")
+		}
+	}
+	c.sigs[name] = fn
+	return fn
+}
+
+// methodSig walks the MRO of class and returns the :SIG function type of
+// the first package defining name, or nil when that sub has no :SIG.
+func (c *typeChecker) methodSig(class, name string) *FuncType {
+	key := class + "->" + name
+	if fn, ok := c.methods[key]; ok {
+		return fn
+	}
+	var fn *FuncType
+	for _, pkg := range Linearize(class, c.parents, c.inh.C3[class]) {
+		if node := c.subs[pkg+"::"+name]; node != nil {
+			if start, ok := nodeFirstNonTriviaStart(node); ok {
+				if sig := sigCommentBeforeOffset(c.doc.Source, start); sig != "" {
+					fn = c.parseFunc(sig, pkg)
+				}
+			}
+			break
+		}
+		if method, ok := c.classMethods[pkg+"::"+name]; ok {
+			if sig := sigCommentBeforeOffset(c.doc.Source, method.BodyStart); sig != "" {
+				fn = c.parseFunc(sig, pkg)
+			}
+			break
+		}
+		if acc, ok := c.accessors[pkg+"::"+name]; ok {
+			fn = c.parseFunc(acc.Sig, pkg)
+			break
+		}
+		if c.opts.SubSig == nil {
+			continue
+		}
+		if sig, ok := c.opts.SubSig(pkg, name); ok {
+			if sig != "" {
+				fn = c.parseFunc(sig, pkg)
+			}
+			break
+		}
+	}
+	c.methods[key] = fn
+	return fn
+}
+
+// SubsByPackage returns the first definition of every named sub of doc,
+// keyed by package and name as in "Foo::bar".
+func SubsByPackage(doc *ppi.Document) map[string]*ppi.Node {
+	out := make(map[string]*ppi.Node)
+	if doc == nil || doc.Root == nil {
+		return out
+	}
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement || n.Kind != "statement::sub" || n.Name == "" {
+			return
+		}
+		start, _, ok := nodeTokenRange(n)
+		if !ok {
+			return
+		}
+		p := doc.PackageAt(start)
+		if p == "" {
+			p = "main"
+		}
+		if key := p + "::" + n.Name; out[key] == nil {
+			out[key] = n
+		}
+	})
+	return out
+}
+
+// receiverClass returns the class of the invocant before the -> at
+// tokens[arrow]: a bare class name, __PACKAGE__, a variable with a class
+// :SIG, or a receiver such as $self that stands for the current package.
+func (c *typeChecker) receiverClass(tokens []ppi.Token, arrow int) (string, bool) {
+	recv := prevNonTrivia(tokens, arrow-1)
+	if recv < 0 {
+		return "", false
+	}
+	tok := tokens[recv]
+	if before := prevNonTrivia(tokens, recv-1); before >= 0 && tokens[before].Type == ppi.TokenOperator && tokens[before].Value == "->" {
+		return "", false
+	}
+	pkg := c.packageAt(tok.Start)
+	if pkg == "" {
+		pkg = "main"
+	}
+	switch tok.Type {
+	case ppi.TokenWord:
+		if tok.Value == "__PACKAGE__" {
+			return pkg, true
+		}
+		if isClassName(tok.Value) {
+			return tok.Value, true
+		}
+	case ppi.TokenSymbol:
+		if t, ok := c.varType(tok.Value, tok.Start); ok {
+			if class, ok := ClassName(t); ok {
+				return class, true
+			}
+		}
+		if _, ok := c.index.ReceiverNamesAt(tok.Start)[tok.Value]; ok {
+			return pkg, true
+		}
+	}
+	return "", false
+}
+
+// checkMethodCall checks a call of the method named at tokens[idx]. The
+// first :SIG parameter is the invocant, so counts and argument numbers in
+// messages refer to the explicit arguments only. A call without
+// parentheses passes no arguments.
+func (c *typeChecker) checkMethodCall(tokens []ppi.Token, arrow, idx int) []CallDiagnostic {
+	name := tokens[idx].Value
+	if !isIdent(name) {
+		return nil
+	}
+	class, ok := c.receiverClass(tokens, arrow)
+	if !ok {
+		return nil
+	}
+	fn := c.methodSig(class, name)
+	if fn == nil || len(fn.Params) == 0 {
+		return nil
+	}
+	var args [][]ppi.Token
+	if next := nextNonTrivia(tokens, idx+1); next >= 0 && tokens[next].Type == ppi.TokenOperator && tokens[next].Value == "(" {
+		args, ok = parseSimpleCallArgs(tokens, next)
+		if !ok {
+			return nil
+		}
+	}
+	params := fn.Params[1:]
+	if fn.Params[0].Slurpy {
+		params = fn.Params
+	}
+	method := &FuncType{Params: params, Returns: fn.Returns}
+	label := class + "->" + name
+	minArgs, maxArgs := method.Arity()
+	if len(args) < minArgs || (maxArgs >= 0 && len(args) > maxArgs) {
+		msg := "call to " + label + ": expected " + arityText(minArgs, maxArgs) + " args, got " + itoa(len(args))
+		return []CallDiagnostic{{Message: msg, Offset: tokens[idx].Start}}
+	}
+	if c.opts.SkipTypes {
+		return nil
+	}
+	return c.checkArgs(label, params, args)
+}
+
+func (c *typeChecker) checkArgs(name string, params []Param, args [][]ppi.Token) []CallDiagnostic {
+	var diags []CallDiagnostic
+	for i, arg := range args {
+		var param Param
+		switch {
+		case i < len(params):
+			param = params[i]
+		case len(params) > 0 && params[len(params)-1].Slurpy:
+			param = params[len(params)-1]
+		default:
+			return diags
+		}
+		actual, ok := c.exprType(arg)
+		if !ok {
+			continue
+		}
+		expected := param.Type
+		if param.Optional {
+			expected = param.VarType()
+		}
+		if c.assignable(actual, expected) {
+			continue
+		}
+		offset := 0
+		if pos := nextNonTrivia(arg, 0); pos >= 0 {
+			offset = arg[pos].Start
+		}
+		diags = append(diags, CallDiagnostic{
+			Message:      "arg " + itoa(i+1) + " of " + name + ": expected " + param.Type.String() + ", got " + actual.String(),
+			Offset:       offset,
+			TypeMismatch: true,
+		})
+	}
+	return diags
+}
+
+// exprType infers the type of a simple expression: literals, anonymous
+// array/hash/sub constructors, Class->new, calls to subs and methods with
+// a :SIG return type, and variables whose declaration has a :SIG.
+func (c *typeChecker) exprType(tokens []ppi.Token) (Type, bool) {
+	var ts []ppi.Token
+	for _, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenWhitespace, ppi.TokenComment, ppi.TokenHereDocContent:
+			continue
+		}
+		ts = append(ts, tok)
+	}
+	if len(ts) == 0 {
+		return nil, false
+	}
+	first, last := ts[0], ts[len(ts)-1]
+	if len(ts) == 1 {
+		switch first.Type {
+		case ppi.TokenNumber:
+			return numberType(first.Value), true
+		case ppi.TokenQuote, ppi.TokenHereDoc:
+			return PrimType{Name: "str"}, true
+		case ppi.TokenQuoteLike:
+			switch {
+			case strings.HasPrefix(first.Value, "qr"):
+				return PrimType{Name: "regexp"}, true
+			case strings.HasPrefix(first.Value, "qw"), strings.HasPrefix(first.Value, "qx"):
+			case strings.HasPrefix(first.Value, "q"):
+				return PrimType{Name: "str"}, true
+			}
+		case ppi.TokenWord:
+			if first.Value == "undef" {
+				return PrimType{Name: "undef"}, true
+			}
+		case ppi.TokenSymbol:
+			return c.varType(first.Value, first.Start)
+		}
+		return nil, false
+	}
+	if first.Type == ppi.TokenOperator && last.Type == ppi.TokenOperator && closesAt(ts, 0) == len(ts)-1 {
+		switch first.Value {
+		case "[":
+			return ArrayType{Elem: AnyType{}}, true
+		case "{":
+			return HashType{Elem: AnyType{}}, true
+		}
+	}
+	if first.Type == ppi.TokenWord && first.Value == "sub" && ts[1].Type == ppi.TokenOperator && ts[1].Value == "{" && closesAt(ts, 1) == len(ts)-1 {
+		return CodeType{}, true
+	}
+	if len(ts) == 2 && first.Type == ppi.TokenUnknown && first.Value == `\` && ts[1].Type == ppi.TokenSymbol && strings.HasPrefix(ts[1].Value, "&") {
+		return CodeType{}, true
+	}
+	if len(ts) >= 3 && ts[1].Type == ppi.TokenOperator && ts[1].Value == "->" && ts[2].Type == ppi.TokenWord &&
+		(len(ts) == 3 || (ts[3].Value == "(" && closesAt(ts, 3) == len(ts)-1)) {
+		if class, ok := c.receiverClass(ts, 1); ok {
+			if fn := c.methodSig(class, ts[2].Value); fn != nil && len(fn.Returns) == 1 && !fn.Returns[0].Slurpy {
+				return fn.Returns[0].VarType(), true
+			}
+		}
+		if first.Type == ppi.TokenWord && isClassName(first.Value) && ts[2].Value == "new" {
+			return ClassType{Name: first.Value}, true
+		}
+	}
+	if first.Type == ppi.TokenWord && ts[1].Type == ppi.TokenOperator && ts[1].Value == "(" && closesAt(ts, 1) == len(ts)-1 {
+		if fn := c.subSig(first.Value); fn != nil && len(fn.Returns) == 1 && !fn.Returns[0].Slurpy {
+			return fn.Returns[0].VarType(), true
+		}
+	}
+	return nil, false
+}
+
+// closesAt returns the index of the token closing the bracket at open.
+func closesAt(ts []ppi.Token, open int) int {
+	depth := 0
+	for i := open; i < len(ts); i++ {
+		if ts[i].Type != ppi.TokenOperator {
+			continue
+		}
+		switch ts[i].Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+func numberType(value string) Type {
+	v := strings.TrimLeft(value, "+-")
+	if strings.HasPrefix(v, "0x") || strings.HasPrefix(v, "0X") || strings.HasPrefix(v, "0b") || strings.HasPrefix(v, "0B") {
+		return PrimType{Name: "int"}
+	}
+	if strings.ContainsAny(v, ".eE") {
+		return PrimType{Name: "num"}
+	}
+	return PrimType{Name: "int"}
+}
+
+// varType returns the :SIG type of a scalar variable. The :SIG comment may
+// be on the declaration itself or, for signature variables, on the sub.
+func (c *typeChecker) varType(name string, offset int) (Type, bool) {
+	if !strings.HasPrefix(name, "$") {
+		return nil, false
+	}
+	sym, ok := c.index.VarDefinitionAt(name, offset)
+	if !ok {
+		return nil, false
+	}
+	sig := sigCommentBeforeOffset(c.doc.Source, sym.Start)
+	if sig == "" {
+		return nil, false
+	}
+	t, err := ParseSig(sig)
+	if err != nil {
+		return nil, false
+	}
+	if t, err = c.scope(c.doc.PackageAt(sym.Start)).Expand(t); err != nil {
+		return nil, false
+	}
+	fn, isFunc := t.(*FuncType)
+	if !isFunc {
+		return t, true
+	}
+	var sub *ppi.Node
+	walkNodes(c.doc.Root, func(n *ppi.Node) {
+		if sub != nil || n == nil || n.Kind != "statement::sub" {
+			return
+		}
+		if start, end, ok := nodeTokenRange(n); ok && sym.Start >= start && sym.Start < end {
+			sub = n
+		}
+	})
+	if sub == nil {
+		return nil, false
+	}
+	for i, v := range sub.SubSigVars {
+		if v == name && i < len(fn.Params) {
+			return fn.Params[i].VarType(), true
+		}
+	}
+	return nil, false
+}
+
+// assignable reports whether a value of type actual can be passed where
+// expected is declared.
+func (c *typeChecker) assignable(actual, expected Type) bool {
+	if _, ok := expected.(AnyType); ok {
+		return true
+	}
+	if _, ok := actual.(AnyType); ok {
+		return true
+	}
+	if u, ok := actual.(UnionType); ok {
+		for _, member := range u.Types {
+			if !c.assignable(member, expected) {
+				return false
+			}
+		}
+		return true
+	}
+	if u, ok := expected.(UnionType); ok {
+		for _, member := range u.Types {
+			if c.assignable(actual, member) {
+				return true
+			}
+		}
+		return false
+	}
+	switch e := expected.(type) {
+	case PrimType:
+		a, ok := actual.(PrimType)
+		return ok && primAssignable(a.Name, e.Name)
+	case ClassType:
+		a, ok := actual.(ClassType)
+		return ok && c.isa(a.Name, e.Name)
+	case ArrayType:
+		a, ok := actual.(ArrayType)
+		return ok && c.assignable(a.Elem, e.Elem)
+	case HashType:
+		switch a := actual.(type) {
+		case HashType:
+			return c.assignable(a.Elem, e.Elem)
+		case ShapeType:
+			for _, f := range a.Fields {
+				if !c.assignable(f.Type, e.Elem) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case ShapeType:
+		switch a := actual.(type) {
+		case HashType:
+			return true
+		case ShapeType:
+			for _, f := range e.Fields {
+				af, ok := a.Field(f.Name)
+				if !ok {
+					if !f.Optional {
+						return false
+					}
+					continue
+				}
+				if !c.assignable(af.Type, f.Type) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	case CodeType:
+		_, ok := actual.(CodeType)
+		return ok
+	}
+	return false
+}
+
+func primAssignable(actual, expected string) bool {
+	if actual == expected {
+		return true
+	}
+	switch expected {
+	case "num":
+		return actual == "int"
+	case "str":
+		return actual == "int" || actual == "num"
+	case "bool":
+		return actual != "regexp" && actual != "glob" && actual != "filehandle"
+	case "glob":
+		return actual == "filehandle"
+	case "filehandle":
+		return actual == "glob"
+	}
+	return false
+}
+
+func (c *typeChecker) isa(class, parent string) bool {
+	for _, p := range Linearize(class, c.parents, false) {
+		if p == parent {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,347 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// SigReturnDiagnostics reports return statements and implicit last
+// expressions of :SIG-annotated subs that disagree with the declared
+// return types: the wrong number of values, a value returned from a void
+// sub, a value of the wrong type, or a path that ends without returning.
+func SigReturnDiagnostics(doc *ppi.Document) []CallDiagnostic {
+	return SigReturnDiagnosticsWithOptions(doc, SigCheckOptions{})
+}
+
+// SigReturnDiagnosticsWithOptions is SigReturnDiagnostics with options.
+func SigReturnDiagnosticsWithOptions(doc *ppi.Document, opts SigCheckOptions) []CallDiagnostic {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	doc = unlessAsIf(doc)
+	c := newTypeChecker(doc, opts)
+	var diags []CallDiagnostic
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement || n.Kind != "statement::sub" || n.Name == "" {
+			return
+		}
+		start, ok := nodeFirstNonTriviaStart(n)
+		if !ok {
+			return
+		}
+		sig := sigCommentBeforeOffset(doc.Source, start)
+		if sig == "" {
+			return
+		}
+		fn := c.parseFunc(sig, doc.PackageAt(start))
+		if fn == nil {
+			return
+		}
+		var body *ppi.Node
+		for _, child := range n.Children {
+			if child.Type == ppi.NodeBlock {
+				body = child
+			}
+		}
+		if body == nil {
+			return
+		}
+		diags = append(diags, c.checkReturns(n, fn, body)...)
+	})
+	return diags
+}
+
+// unlessAsIf returns doc reparsed with each unless that starts a statement
+// spelled as if, so that unless/elsif/else chains are walked like if
+// chains. go-ppi parses an if chain into blocks, but leaves the first
+// block of an unless flat. The keyword is padded to keep every offset,
+// and its negation does not change which paths return.
+func unlessAsIf(doc *ppi.Document) *ppi.Document {
+	var src []byte
+	for i, tok := range doc.Tokens {
+		if tok.Type != ppi.TokenWord || tok.Value != "unless" {
+			continue
+		}
+		if prev := prevNonTrivia(doc.Tokens, i-1); prev >= 0 && doc.Tokens[prev].Value != ";" && doc.Tokens[prev].Value != "{" && doc.Tokens[prev].Value != "}" {
+			continue
+		}
+		if src == nil {
+			src = []byte(doc.Source)
+		}
+		copy(src[tok.Start:tok.End], "if    ")
+	}
+	if src == nil {
+		return doc
+	}
+	out := ppi.NewDocument(string(src))
+	out.ParseWithDiagnostics()
+	return out
+}
+
+func (c *typeChecker) checkReturns(sub *ppi.Node, fn *FuncType, body *ppi.Node) []CallDiagnostic {
+	var diags []CallDiagnostic
+	var visit func(n *ppi.Node)
+	visit = func(n *ppi.Node) {
+		if n == nil {
+			return
+		}
+		if n.Type == ppi.NodeStatement {
+			if values, offset, ok := returnValues(n); ok {
+				diags = append(diags, c.checkReturnValues(sub.Name, fn, values, offset)...)
+				return
+			}
+			switch {
+			case n.Kind == "statement::control":
+			case strings.HasPrefix(n.Kind, "statement::"):
+				// Blocks inside expressions are anonymous subs, map/grep
+				// blocks and the like, whose returns are not ours.
+				return
+			}
+		}
+		for _, child := range n.Children {
+			visit(child)
+		}
+	}
+	visit(body)
+
+	tails, fallsOff := tailStatements(body)
+	if len(fn.Returns) == 0 {
+		return diags
+	}
+	for _, tail := range tails {
+		values, offset := tailValues(tail)
+		diags = append(diags, c.checkReturnValues(sub.Name, fn, values, offset)...)
+	}
+	if fallsOff {
+		if minRet, _ := paramArity(fn.Returns); minRet > 0 {
+			offset := 0
+			if start, _, ok := nodeNameRange(sub); ok {
+				offset = start
+			}
+			diags = append(diags, CallDiagnostic{
+				Message: "sub " + sub.Name + " can end without returning " + paramListString(fn.Returns),
+				Offset:  offset,
+			})
+		}
+	}
+	return diags
+}
+
+// returnValues returns the value tokens of a statement starting with
+// "return", including "return ... if ...;".
+func returnValues(n *ppi.Node) ([]ppi.Token, int, bool) {
+	pos := nextNonTrivia(n.Tokens, 0)
+	if pos < 0 || n.Tokens[pos].Type != ppi.TokenWord || n.Tokens[pos].Value != "return" {
+		return nil, 0, false
+	}
+	end := len(n.Tokens)
+	depth := 0
+	for i := pos + 1; i < len(n.Tokens); i++ {
+		tok := n.Tokens[i]
+		switch {
+		case tok.Type == ppi.TokenOperator && (tok.Value == "(" || tok.Value == "[" || tok.Value == "{"):
+			depth++
+		case tok.Type == ppi.TokenOperator && (tok.Value == ")" || tok.Value == "]" || tok.Value == "}"):
+			depth--
+		case depth == 0 && tok.Type == ppi.TokenOperator && tok.Value == ";":
+			end = i
+		case depth == 0 && n.Kind == "statement::postfix" && tok.Type == ppi.TokenWord && tok.Value == n.Keyword:
+			end = i
+		default:
+			continue
+		}
+		if end != len(n.Tokens) {
+			break
+		}
+	}
+	return n.Tokens[pos+1 : end], n.Tokens[pos].Start, true
+}
+
+// tailValues returns the value tokens of a statement that is the implicit
+// return value of a sub.
+func tailValues(n *ppi.Node) ([]ppi.Token, int) {
+	tokens := n.Tokens
+	if last := prevNonTrivia(tokens, len(tokens)-1); last >= 0 && tokens[last].Type == ppi.TokenOperator && tokens[last].Value == ";" {
+		tokens = tokens[:last]
+	}
+	offset := 0
+	if pos := nextNonTrivia(tokens, 0); pos >= 0 {
+		offset = tokens[pos].Start
+	}
+	return tokens, offset
+}
+
+// tailStatements returns the statements whose value a block evaluates to
+// on each path, and whether some path ends without such a statement, for
+// example after a loop or an if without else.
+func tailStatements(block *ppi.Node) ([]*ppi.Node, bool) {
+	var last *ppi.Node
+	for _, child := range block.Children {
+		if child.Type == ppi.NodeStatement && child.Kind == "statement::empty" {
+			continue
+		}
+		last = child
+	}
+	if last == nil {
+		return nil, true
+	}
+	if strings.HasPrefix(last.Kind, "chain::") {
+		var tails []*ppi.Node
+		fallsOff := true
+		for _, branch := range last.Children {
+			if branch.Keyword == "else" {
+				fallsOff = false
+			}
+			for _, child := range branch.Children {
+				if child.Type != ppi.NodeBlock {
+					continue
+				}
+				t, f := tailStatements(child)
+				tails = append(tails, t...)
+				fallsOff = fallsOff || f
+			}
+		}
+		return tails, fallsOff
+	}
+	if last.Type != ppi.NodeStatement {
+		return nil, false
+	}
+	if _, _, ok := returnValues(last); ok {
+		return nil, last.Kind == "statement::postfix"
+	}
+	switch last.Kind {
+	case "statement::expression":
+		switch last.Keyword {
+		case "die", "croak", "confess", "exit", "exec":
+			return nil, false
+		}
+		return []*ppi.Node{last}, false
+	case "statement::control", "statement::sub", "statement::package", "statement::include":
+		return nil, true
+	}
+	return nil, false
+}
+
+func (c *typeChecker) checkReturnValues(name string, fn *FuncType, tokens []ppi.Token, offset int) []CallDiagnostic {
+	values, known := c.splitReturnValues(tokens)
+	if len(fn.Returns) == 0 {
+		if len(values) > 0 {
+			return []CallDiagnostic{{Message: "sub " + name + " is declared void but returns a value", Offset: offset}}
+		}
+		return nil
+	}
+	if !known {
+		return nil
+	}
+	minRet, maxRet := paramArity(fn.Returns)
+	if len(values) == 0 && len(fn.Returns) == 1 && c.assignable(PrimType{Name: "undef"}, fn.Returns[0].VarType()) {
+		return nil
+	}
+	if len(values) < minRet || (maxRet >= 0 && len(values) > maxRet) {
+		msg := "return from " + name + ": expected " + arityText(minRet, maxRet) + " values, got " + itoa(len(values))
+		return []CallDiagnostic{{Message: msg, Offset: offset}}
+	}
+	if c.opts.SkipTypes {
+		return nil
+	}
+	var diags []CallDiagnostic
+	for _, d := range c.checkArgs(name, fn.Returns, values) {
+		d.Message = "return value" + strings.TrimPrefix(d.Message, "arg")
+		diags = append(diags, d)
+	}
+	return diags
+}
+
+// splitReturnValues splits a return expression on top-level commas. known
+// is false when the number of values cannot be told statically, such as
+// when an array or a call is returned.
+func (c *typeChecker) splitReturnValues(tokens []ppi.Token) ([][]ppi.Token, bool) {
+	var ts []ppi.Token
+	for _, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenWhitespace, ppi.TokenComment, ppi.TokenHereDocContent:
+			continue
+		}
+		ts = append(ts, tok)
+	}
+	if len(ts) == 0 {
+		return nil, true
+	}
+	if ts[0].Type == ppi.TokenOperator && ts[0].Value == "(" && closesAt(ts, 0) == len(ts)-1 {
+		ts = ts[1 : len(ts)-1]
+	}
+	var values [][]ppi.Token
+	var cur []ppi.Token
+	depth := 0
+	for _, tok := range ts {
+		if tok.Type == ppi.TokenOperator {
+			switch tok.Value {
+			case "(", "[", "{":
+				depth++
+			case ")", "]", "}":
+				depth--
+			case ",", "=>":
+				if depth == 0 {
+					values = append(values, cur)
+					cur = nil
+					continue
+				}
+			}
+		}
+		cur = append(cur, tok)
+	}
+	if len(cur) > 0 {
+		values = append(values, cur)
+	}
+	for _, v := range values {
+		if !c.isSingleValue(v) {
+			return values, false
+		}
+	}
+	return values, true
+}
+
+// isSingleValue reports whether an expression yields exactly one value:
+// an expression exprType understands, a reference to a variable, or a
+// scalar variable with optional subscripts.
+func (c *typeChecker) isSingleValue(ts []ppi.Token) bool {
+	if len(ts) == 0 {
+		return false
+	}
+	first := ts[0]
+	if first.Type == ppi.TokenSymbol && !strings.HasPrefix(first.Value, "$") {
+		return false
+	}
+	if _, ok := c.exprType(ts); ok {
+		return true
+	}
+	switch first.Type {
+	case ppi.TokenUnknown:
+		return first.Value == `\` && len(ts) == 2 && ts[1].Type == ppi.TokenSymbol
+	case ppi.TokenSymbol:
+		if strings.HasPrefix(first.Value, "$#") {
+			return false
+		}
+		for i := 1; i < len(ts); {
+			if ts[i].Type == ppi.TokenOperator && ts[i].Value == "->" {
+				i++
+			}
+			if i >= len(ts) || ts[i].Type != ppi.TokenOperator || (ts[i].Value != "[" && ts[i].Value != "{") {
+				return false
+			}
+			end := closesAt(ts, i)
+			if end < 0 {
+				return false
+			}
+			i = end + 1
+		}
+		return true
+	}
+	return false
+}
+
+// paramArity is FuncType.Arity for a return list.
+func paramArity(params []Param) (int, int) {
+	return (&FuncType{Params: params}).Arity()
+}
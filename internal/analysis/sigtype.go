@@ -0,0 +1,725 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Type is a parsed :SIG type. String returns its canonical spelling.
+type Type interface {
+	String() string
+	isType()
+}
+
+// AnyType is "any".
+type AnyType struct{}
+
+// PrimType is a builtin scalar type such as "int" or "undef".
+type PrimType struct {
+	Name string
+}
+
+// ClassType is a Perl package name such as Foo::Bar.
+type ClassType struct {
+	Name string
+}
+
+// ArrayType is array[Elem].
+type ArrayType struct {
+	Elem Type
+}
+
+// HashType is hash[Elem].
+type HashType struct {
+	Elem Type
+}
+
+// CodeType is code or code[Args -> Ret]. Func is nil for plain code.
+type CodeType struct {
+	Func *FuncType
+}
+
+// ShapeType is a hash reference with known keys: hash{name: str, age: int?}.
+type ShapeType struct {
+	Fields []Field
+}
+
+// Field is one key of a ShapeType. Optional keys may be missing.
+type Field struct {
+	Name     string
+	Type     Type
+	Optional bool
+}
+
+// UnionType is A|B. T? and maybe[T] are parsed as T|undef.
+type UnionType struct {
+	Types []Type
+}
+
+// FuncType is Params -> Returns. Empty lists are written as void.
+type FuncType struct {
+	Params  []Param
+	Returns []Param
+}
+
+// Param is one entry of an argument or return list.
+// Optional params (T?) may be omitted; a slurpy param (...T) takes the rest.
+type Param struct {
+	Type     Type
+	Optional bool
+	Slurpy   bool
+}
+
+func (AnyType) isType()   {}
+func (PrimType) isType()  {}
+func (ClassType) isType() {}
+func (ArrayType) isType() {}
+func (HashType) isType()  {}
+func (UnionType) isType() {}
+func (CodeType) isType()  {}
+func (ShapeType) isType() {}
+func (*FuncType) isType() {}
+
+func (AnyType) String() string     { return "any" }
+func (t PrimType) String() string  { return t.Name }
+func (t ClassType) String() string { return t.Name }
+func (t ArrayType) String() string { return "array[" + t.Elem.String() + "]" }
+func (t HashType) String() string  { return "hash[" + t.Elem.String() + "]" }
+
+func (t CodeType) String() string {
+	if t.Func == nil {
+		return "code"
+	}
+	return "code[" + t.Func.String() + "]"
+}
+
+func (t ShapeType) String() string {
+	parts := make([]string, len(t.Fields))
+	for i, f := range t.Fields {
+		name := f.Name
+		if !isIdent(name) {
+			name = "'" + name + "'"
+		}
+		parts[i] = name + ": " + f.Type.String()
+		if f.Optional {
+			parts[i] += "?"
+		}
+	}
+	return "hash{" + strings.Join(parts, ", ") + "}"
+}
+
+// Field returns the field named name.
+func (t ShapeType) Field(name string) (Field, bool) {
+	for _, f := range t.Fields {
+		if f.Name == name {
+			return f, true
+		}
+	}
+	return Field{}, false
+}
+
+func (t UnionType) String() string {
+	parts := make([]string, len(t.Types))
+	for i, member := range t.Types {
+		parts[i] = member.String()
+	}
+	return strings.Join(parts, "|")
+}
+
+func (t *FuncType) String() string {
+	return paramListString(t.Params) + " -> " + paramListString(t.Returns)
+}
+
+func (p Param) String() string {
+	switch {
+	case p.Slurpy:
+		return "..." + p.Type.String()
+	case p.Optional:
+		return p.Type.String() + "?"
+	default:
+		return p.Type.String()
+	}
+}
+
+// VarType is the type of the variable receiving the parameter: T|undef
+// for an optional parameter and array[T] for a slurpy one.
+func (p Param) VarType() Type {
+	switch {
+	case p.Slurpy:
+		return ArrayType{Elem: p.Type}
+	case p.Optional:
+		return unionOf(p.Type, PrimType{Name: "undef"})
+	default:
+		return p.Type
+	}
+}
+
+func paramListString(params []Param) string {
+	switch len(params) {
+	case 0:
+		return "void"
+	case 1:
+		return params[0].String()
+	}
+	parts := make([]string, len(params))
+	for i, p := range params {
+		parts[i] = p.String()
+	}
+	return "(" + strings.Join(parts, ", ") + ")"
+}
+
+// Arity returns the minimum and maximum number of arguments the function
+// accepts. max is -1 when the last parameter is slurpy.
+func (t *FuncType) Arity() (int, int) {
+	min := 0
+	for _, p := range t.Params {
+		if p.Slurpy {
+			return min, -1
+		}
+		if !p.Optional {
+			min++
+		}
+	}
+	return min, len(t.Params)
+}
+
+// ClassName returns the class named by t, looking through an optional
+// wrapper such as Foo? or maybe[Foo].
+func ClassName(t Type) (string, bool) {
+	switch t := t.(type) {
+	case ClassType:
+		return t.Name, true
+	case UnionType:
+		class := ""
+		for _, member := range t.Types {
+			switch m := member.(type) {
+			case PrimType:
+				if m.Name == "undef" {
+					continue
+				}
+				return "", false
+			case ClassType:
+				if class != "" {
+					return "", false
+				}
+				class = m.Name
+			default:
+				return "", false
+			}
+		}
+		return class, class != ""
+	}
+	return "", false
+}
+
+// walkSigType calls fn for t and every type nested in it.
+func walkSigType(t Type, fn func(Type)) {
+	fn(t)
+	walkParams := func(params []Param) {
+		for _, p := range params {
+			walkSigType(p.Type, fn)
+		}
+	}
+	switch t := t.(type) {
+	case ArrayType:
+		walkSigType(t.Elem, fn)
+	case HashType:
+		walkSigType(t.Elem, fn)
+	case UnionType:
+		for _, member := range t.Types {
+			walkSigType(member, fn)
+		}
+	case ShapeType:
+		for _, f := range t.Fields {
+			walkSigType(f.Type, fn)
+		}
+	case CodeType:
+		if t.Func != nil {
+			walkSigType(t.Func, fn)
+		}
+	case *FuncType:
+		walkParams(t.Params)
+		walkParams(t.Returns)
+	}
+}
+
+// SigError is a :SIG parse error. Offset is the byte offset into the
+// signature text where parsing failed.
+type SigError struct {
+	Offset int
+	Msg    string
+}
+
+func (e *SigError) Error() string {
+	return e.Msg
+}
+
+// ParseSig parses the contents of :SIG(...). Function signatures are
+// returned as *FuncType.
+func ParseSig(sig string) (Type, error) {
+	p := &sigParser{src: sig}
+	p.skipSpace()
+	if p.eof() {
+		return nil, p.errorf("empty signature")
+	}
+	left, list, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.consume("->") {
+		right, _, err := p.parseList()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.eof() {
+			return nil, p.errorf("unexpected %q", p.src[p.pos:])
+		}
+		return &FuncType{Params: left, Returns: right}, nil
+	}
+	if !p.eof() {
+		if p.peek(",") {
+			return nil, p.errorf("multiple types require parentheses")
+		}
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	if list {
+		return nil, p.errorf("expected ->")
+	}
+	param := left[0]
+	if param.Slurpy {
+		return nil, &SigError{Offset: 0, Msg: "slurpy type only allowed in a list"}
+	}
+	if param.Optional {
+		return unionOf(param.Type, PrimType{Name: "undef"}), nil
+	}
+	return param.Type, nil
+}
+
+type sigParser struct {
+	src string
+	pos int
+	// wholeList is set while the next base type is a whole argument or
+	// return list, the only place void is allowed.
+	wholeList bool
+}
+
+func (p *sigParser) errorf(format string, args ...any) error {
+	return &SigError{Offset: p.pos, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *sigParser) eof() bool {
+	return p.pos >= len(p.src)
+}
+
+func (p *sigParser) skipSpace() {
+	for !p.eof() {
+		switch p.src[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+func (p *sigParser) peek(s string) bool {
+	return strings.HasPrefix(p.src[p.pos:], s)
+}
+
+func (p *sigParser) consume(s string) bool {
+	if p.peek(s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+// consumeVoid consumes the keyword void when it is not part of a longer name.
+func (p *sigParser) consumeVoid() bool {
+	if !p.peek("void") {
+		return false
+	}
+	end := p.pos + len("void")
+	if end < len(p.src) && (isSigIdentChar(p.src[end]) || p.src[end] == ':') {
+		return false
+	}
+	p.pos = end
+	return true
+}
+
+// parseList parses an argument or return list. The second result reports
+// whether the list was written as void or in parentheses.
+func (p *sigParser) parseList() ([]Param, bool, error) {
+	p.skipSpace()
+	if p.consumeVoid() {
+		return []Param{}, true, nil
+	}
+	if !p.consume("(") {
+		p.wholeList = true
+		param, err := p.parseParam()
+		p.wholeList = false
+		if err != nil {
+			return nil, false, err
+		}
+		return []Param{param}, false, nil
+	}
+	p.skipSpace()
+	if p.consumeVoid() {
+		p.skipSpace()
+		if !p.consume(")") {
+			return nil, true, p.errorf("expected )")
+		}
+		return []Param{}, true, nil
+	}
+	var params []Param
+	optional := false
+	for {
+		p.skipSpace()
+		start := p.pos
+		param, err := p.parseParam()
+		if err != nil {
+			return nil, true, err
+		}
+		if len(params) > 0 && params[len(params)-1].Slurpy {
+			return nil, true, &SigError{Offset: start, Msg: "slurpy type must be last"}
+		}
+		if param.Optional {
+			optional = true
+		} else if optional && !param.Slurpy {
+			return nil, true, &SigError{Offset: start, Msg: fmt.Sprintf("required type %q after optional type", param.String())}
+		}
+		params = append(params, param)
+		p.skipSpace()
+		if p.consume(",") {
+			continue
+		}
+		if p.consume(")") {
+			return params, true, nil
+		}
+		if p.eof() {
+			return nil, true, p.errorf("expected )")
+		}
+		return nil, true, p.errorf("expected , or ) before %q", p.src[p.pos:])
+	}
+}
+
+func (p *sigParser) parseParam() (Param, error) {
+	p.skipSpace()
+	var param Param
+	param.Slurpy = p.consume("...")
+	t, err := p.parseUnion()
+	if err != nil {
+		return Param{}, err
+	}
+	param.Type = t
+	p.skipSpace()
+	if p.peek("?") {
+		if param.Slurpy {
+			return Param{}, p.errorf("slurpy type cannot be optional")
+		}
+		p.pos++
+		param.Optional = true
+		p.skipSpace()
+		if p.peek("?") {
+			return Param{}, p.errorf("duplicate ?")
+		}
+	}
+	return param, nil
+}
+
+// parseType parses a type in a nested position, where T? means T|undef.
+func (p *sigParser) parseType() (Type, error) {
+	t, err := p.parseUnion()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.consume("?") {
+		p.skipSpace()
+		if p.peek("?") {
+			return nil, p.errorf("duplicate ?")
+		}
+		return unionOf(t, PrimType{Name: "undef"}), nil
+	}
+	return t, nil
+}
+
+func (p *sigParser) parseUnion() (Type, error) {
+	first, err := p.parseBase()
+	if err != nil {
+		return nil, err
+	}
+	members := []Type{first}
+	for {
+		p.skipSpace()
+		if !p.consume("|") {
+			break
+		}
+		next, err := p.parseBase()
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, next)
+	}
+	if len(members) == 1 {
+		return first, nil
+	}
+	return unionOf(members...), nil
+}
+
+func (p *sigParser) parseBase() (Type, error) {
+	p.skipSpace()
+	start := p.pos
+	wholeList := p.wholeList
+	p.wholeList = false
+	name := p.className()
+	if name == "" {
+		if p.eof() {
+			return nil, p.errorf("expected type")
+		}
+		return nil, p.errorf("expected type before %q", p.src[p.pos:])
+	}
+	switch name {
+	case "any":
+		return AnyType{}, nil
+	case "int", "num", "str", "bool", "undef", "regexp", "glob", "filehandle":
+		return PrimType{Name: name}, nil
+	case "void":
+		return nil, &SigError{Offset: start, Msg: "void not allowed here"}
+	case "code":
+		if !p.consume("[") {
+			return CodeType{}, nil
+		}
+		fn, err := p.parseFunc()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume("]") {
+			return nil, p.errorf("expected ] to close code[")
+		}
+		return CodeType{Func: fn}, nil
+	case "hash":
+		if p.consume("{") {
+			return p.parseShape()
+		}
+		fallthrough
+	case "array", "maybe":
+		if !p.consume("[") {
+			return nil, &SigError{Offset: start, Msg: fmt.Sprintf("%s needs an element type, e.g. %s[any]", name, name)}
+		}
+		p.skipSpace()
+		if p.peek("]") {
+			return nil, p.errorf("%s[] missing type", name)
+		}
+		inner, err := p.parseType()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		if !p.consume("]") {
+			return nil, p.errorf("expected ] to close %s[", name)
+		}
+		switch name {
+		case "array":
+			return ArrayType{Elem: inner}, nil
+		case "hash":
+			return HashType{Elem: inner}, nil
+		default:
+			return unionOf(inner, PrimType{Name: "undef"}), nil
+		}
+	}
+	// Other lowercase names may be packages such as version; ValidateSig
+	// reports those that are not.
+	if !strings.Contains(name, "::") && strings.ToLower(name) == name {
+		if suggestion := suggestSigType(name, wholeList); suggestion != "" {
+			return nil, &SigError{Offset: start, Msg: fmt.Sprintf("unknown type %q (did you mean %q?)", name, suggestion)}
+		}
+	}
+	return ClassType{Name: name}, nil
+}
+
+// parseFunc parses Args -> Ret.
+func (p *sigParser) parseFunc() (*FuncType, error) {
+	params, _, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.consume("->") {
+		return nil, p.errorf("expected ->")
+	}
+	returns, _, err := p.parseList()
+	if err != nil {
+		return nil, err
+	}
+	return &FuncType{Params: params, Returns: returns}, nil
+}
+
+// parseShape parses the fields of hash{key: T, ...} after the opening brace.
+func (p *sigParser) parseShape() (Type, error) {
+	shape := ShapeType{}
+	seen := make(map[string]struct{})
+	p.skipSpace()
+	if p.peek("}") {
+		return nil, p.errorf("hash{} needs at least one field")
+	}
+	for {
+		p.skipSpace()
+		start := p.pos
+		key, ok := p.shapeKey()
+		if !ok {
+			return nil, p.errorf("expected field name")
+		}
+		if _, dup := seen[key]; dup {
+			return nil, &SigError{Offset: start, Msg: fmt.Sprintf("duplicate field %q", key)}
+		}
+		seen[key] = struct{}{}
+		p.skipSpace()
+		if !p.consume(":") {
+			return nil, p.errorf("expected : after field %q", key)
+		}
+		param, err := p.parseParam()
+		if err != nil {
+			return nil, err
+		}
+		if param.Slurpy {
+			return nil, &SigError{Offset: start, Msg: "slurpy type not allowed in hash{}"}
+		}
+		shape.Fields = append(shape.Fields, Field{Name: key, Type: param.Type, Optional: param.Optional})
+		p.skipSpace()
+		if p.consume(",") {
+			p.skipSpace()
+			if p.consume("}") {
+				return shape, nil
+			}
+			continue
+		}
+		if p.consume("}") {
+			return shape, nil
+		}
+		return nil, p.errorf("expected , or } in hash{")
+	}
+}
+
+// shapeKey reads a bare or quoted field name.
+func (p *sigParser) shapeKey() (string, bool) {
+	if p.eof() {
+		return "", false
+	}
+	if q := p.src[p.pos]; q == '\'' || q == '"' {
+		end := strings.IndexByte(p.src[p.pos+1:], q)
+		if end < 0 {
+			return "", false
+		}
+		key := p.src[p.pos+1 : p.pos+1+end]
+		p.pos += end + 2
+		return key, key != ""
+	}
+	start := p.pos
+	for !p.eof() && (isSigIdentChar(p.src[p.pos]) || p.src[p.pos] == '-') {
+		p.pos++
+	}
+	return p.src[start:p.pos], p.pos > start
+}
+
+// sigTypeNames are the builtin type names offered as suggestions.
+var sigTypeNames = []string{
+	"any", "int", "num", "str", "bool", "undef", "void",
+	"regexp", "glob", "filehandle", "code", "array", "hash", "maybe",
+}
+
+// suggestSigType returns the builtin type closest to name, if any. void is
+// only suggested where it is allowed, for a whole list.
+func suggestSigType(name string, voidOK bool) string {
+	best := ""
+	bestDist := 3
+	for _, candidate := range sigTypeNames {
+		if candidate == "void" && !voidOK {
+			continue
+		}
+		if d := editDistance(name, candidate); d < bestDist {
+			best, bestDist = candidate, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+// className reads Ident { "::" Ident }. It returns "" and leaves the
+// position unchanged if no identifier starts here.
+func (p *sigParser) className() string {
+	start := p.pos
+	for {
+		identStart := p.pos
+		if p.eof() || !isSigIdentStart(p.src[p.pos]) {
+			p.pos = identStart
+			break
+		}
+		for !p.eof() && isSigIdentChar(p.src[p.pos]) {
+			p.pos++
+		}
+		if !p.peek("::") || p.pos+2 >= len(p.src) || !isSigIdentStart(p.src[p.pos+2]) {
+			break
+		}
+		p.pos += 2
+	}
+	return p.src[start:p.pos]
+}
+
+func isSigIdentStart(ch byte) bool {
+	return ch == '_' || (ch >= 'A' && ch <= 'Z') || (ch >= 'a' && ch <= 'z')
+}
+
+func isSigIdentChar(ch byte) bool {
+	return isSigIdentStart(ch) || (ch >= '0' && ch <= '9')
+}
+
+// unionOf builds a union, flattening nested unions and dropping duplicates.
+func unionOf(types ...Type) Type {
+	var members []Type
+	seen := make(map[string]struct{})
+	var add func(Type)
+	add = func(t Type) {
+		if u, ok := t.(UnionType); ok {
+			for _, m := range u.Types {
+				add(m)
+			}
+			return
+		}
+		key := t.String()
+		if _, ok := seen[key]; ok {
+			return
+		}
+		seen[key] = struct{}{}
+		members = append(members, t)
+	}
+	for _, t := range types {
+		add(t)
+	}
+	if len(members) == 1 {
+		return members[0]
+	}
+	return UnionType{Types: members}
+}
@@ -15,6 +15,9 @@ type VarDiagnostic struct {
 type CallDiagnostic struct {
 	Message string
 	Offset  int
+	// TypeMismatch is set for argument type errors, as opposed to
+	// argument count errors.
+	TypeMismatch bool
 }
 
 // StrictVarDiagnostics reports undeclared variable usages under "use strict".
@@ -199,48 +202,68 @@ func StrictVarDiagnosticsWithExtra(doc *ppi.Document, extra map[string]struct{})
 	return diags
 }
 
-// SigCallDiagnostics reports argument count mismatches for calls to subroutines
-// that have a :SIG(...) function signature. This only checks simple calls.
+// SigCallDiagnostics reports argument count and argument type mismatches
+// for calls to subroutines that have a :SIG(...) function signature, and
+// for method calls on receivers whose class is known. This only checks
+// simple calls.
 func SigCallDiagnostics(doc *ppi.Document) []CallDiagnostic {
+	return SigCallDiagnosticsWithOptions(doc, SigCheckOptions{})
+}
+
+// SigCallDiagnosticsWithOptions is SigCallDiagnostics with options.
+func SigCallDiagnosticsWithOptions(doc *ppi.Document, opts SigCheckOptions) []CallDiagnostic {
 	if doc == nil || doc.Root == nil {
 		return nil
 	}
+	checker := newTypeChecker(doc, opts)
 	var diags []CallDiagnostic
 	tokens := doc.Tokens
 	for i, tok := range tokens {
 		if tok.Type != ppi.TokenWord || tok.Value == "" {
 			continue
 		}
-		name := tok.Value
-		node := findSubNode(doc.Root, name)
-		if node == nil {
-			continue
-		}
-		start, ok := nodeFirstNonTriviaStart(node)
-		if !ok {
-			continue
-		}
-		sig := sigCommentBeforeOffset(doc.Source, start)
-		if sig == "" || !strings.Contains(sig, "->") {
+		if prev := prevNonTrivia(tokens, i-1); prev >= 0 && tokens[prev].Type == ppi.TokenOperator && tokens[prev].Value == "->" {
+			diags = append(diags, checker.checkMethodCall(tokens, prev, i)...)
 			continue
 		}
-		args, err := ParseSigArgs(sig)
-		if err != nil {
+		name := tok.Value
+		fn := checker.subSig(name)
+		if fn == nil {
 			continue
 		}
 		callArgs, ok := parseSimpleCallArgs(tokens, i+1)
 		if !ok {
 			continue
 		}
-		if len(callArgs) != len(args) {
-			msg := "call to " + name + ": expected " + itoa(len(args)) + " args, got " + itoa(len(callArgs))
+		minArgs, maxArgs := fn.Arity()
+		if len(callArgs) < minArgs || (maxArgs >= 0 && len(callArgs) > maxArgs) {
+			msg := "call to " + name + ": expected " + arityText(minArgs, maxArgs) + " args, got " + itoa(len(callArgs))
 			diags = append(diags, CallDiagnostic{Message: msg, Offset: tok.Start})
+			continue
+		}
+		if opts.SkipTypes {
+			continue
 		}
+		diags = append(diags, checker.checkArgs(name, fn.Params, callArgs)...)
 	}
 	return diags
 }
 
-func parseSimpleCallArgs(tokens []ppi.Token, idx int) ([]string, bool) {
+func arityText(minArgs, maxArgs int) string {
+	switch {
+	case maxArgs < 0:
+		return "at least " + itoa(minArgs)
+	case minArgs == maxArgs:
+		return itoa(minArgs)
+	default:
+		return itoa(minArgs) + " to " + itoa(maxArgs)
+	}
+}
+
+// parseSimpleCallArgs returns the tokens of each argument of a
+// parenthesized call. Calls whose argument count cannot be known statically,
+// such as ones passing arrays or hashes, are rejected.
+func parseSimpleCallArgs(tokens []ppi.Token, idx int) ([][]ppi.Token, bool) {
 	i := nextNonTrivia(tokens, idx)
 	if i < 0 {
 		return nil, false
@@ -249,29 +272,35 @@ func parseSimpleCallArgs(tokens []ppi.Token, idx int) ([]string, bool) {
 		return nil, false
 	}
 	depth := 0
-	var count int
+	var args [][]ppi.Token
+	var cur []ppi.Token
 	var seen bool
 	var invalid bool
 	for j := i; j < len(tokens); j++ {
 		tok := tokens[j]
 		if tok.Type == ppi.TokenOperator {
 			switch tok.Value {
-			case "(":
+			case "(", "[", "{":
 				depth++
-			case ")":
+				if depth == 1 {
+					continue
+				}
+			case ")", "]", "}":
 				depth--
 				if depth == 0 {
 					if invalid {
 						return nil, false
 					}
 					if seen {
-						count++
+						args = append(args, cur)
 					}
-					return make([]string, count), true
+					return args, true
 				}
 			case ",":
 				if depth == 1 {
-					count++
+					args = append(args, cur)
+					cur = nil
+					continue
 				}
 			case "@", "%", "*", "..", "=>":
 				if depth == 1 {
@@ -284,10 +313,10 @@ func parseSimpleCallArgs(tokens []ppi.Token, idx int) ([]string, bool) {
 				invalid = true
 			}
 		}
+		if depth >= 1 {
+			cur = append(cur, tok)
+		}
 		if depth == 1 && tok.Type != ppi.TokenWhitespace && tok.Type != ppi.TokenComment && tok.Type != ppi.TokenHereDocContent {
-			if tok.Type == ppi.TokenOperator && (tok.Value == "(" || tok.Value == ",") {
-				continue
-			}
 			seen = true
 		}
 	}
@@ -463,55 +492,7 @@ func strictAt(root *ppi.Node, offset int) bool {
 	if root == nil {
 		return false
 	}
-	return strictAtNodes(root.Children, offset, false)
-}
-
-func strictAtNodes(nodes []*ppi.Node, offset int, strict bool) bool {
-	for _, n := range nodes {
-		if n == nil {
-			continue
-		}
-		start, end, ok := nodeTokenRange(n)
-		if ok && offset < start {
-			return strict
-		}
-		if blk := nodeBlockChild(n); blk != nil {
-			bs, be, ok := nodeTokenRange(blk)
-			if ok && offset >= bs && offset < be {
-				return strictAtNodes(blk.Children, offset, strict)
-			}
-		}
-		if isStrictToggle(n) {
-			if ok && offset < end {
-				return strict
-			}
-			strict = strictValue(n)
-		}
-	}
-	return strict
-}
-
-func isStrictToggle(n *ppi.Node) bool {
-	if n == nil || n.Kind != "statement::include" {
-		return false
-	}
-	if strings.ToLower(n.Keyword) == "use" && n.Version != "" && isStrictVersion(n.Version) {
-		return true
-	}
-	if strings.ToLower(n.Name) != "strict" {
-		return false
-	}
-	return strings.ToLower(n.Keyword) == "use" || strings.ToLower(n.Keyword) == "no"
-}
-
-func strictValue(n *ppi.Node) bool {
-	if n == nil {
-		return false
-	}
-	if strings.ToLower(n.Keyword) == "use" && n.Version != "" && isStrictVersion(n.Version) {
-		return true
-	}
-	return strings.ToLower(n.Keyword) == "use"
+	return pragmasAtNodes(root.Children, offset, PragmaState{Features: map[string]bool{}}).Strict
 }
 
 func hasUseModule(root *ppi.Node, name string) bool {
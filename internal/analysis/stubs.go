@@ -0,0 +1,107 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// StubExt is the extension of signature stub files. A stub declares the
+// subs of a module it does not own, such as
+//
+//	package Foo::Bar;
+//	use parent 'Foo::Base';
+//	sub new :SIG((str, int?) -> Foo::Bar);
+//	sub get :SIG((Foo::Bar, str) -> str|undef);
+//
+// and lives at Foo/Bar.psig under one of IndexOptions.SigRoots.
+const StubExt = ".psig"
+
+// indexStubs reads the stub files under roots into w.stubs.
+func (w *WorkspaceIndex) indexStubs(roots []string) error {
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		if _, err := os.Stat(root); err != nil {
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if filepath.Ext(path) != StubExt {
+				return nil
+			}
+			if w.stubs == nil {
+				w.stubs = newWorkspaceIndex()
+			}
+			if err := indexFileWithOptions(path, w.stubs, false); err != nil {
+				return err
+			}
+			w.stubs.Files++
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// withStubs merges stub definitions of the same name into defs. A stub
+// signature fills in a sub of the same package that has no :SIG of its
+// own, and the stub definitions stand in when nothing else defines the
+// name.
+func withStubs(defs, stubs []Definition) []Definition {
+	if len(stubs) == 0 {
+		return defs
+	}
+	if len(defs) == 0 {
+		return stubs
+	}
+	sigs := make(map[string]string)
+	for _, stub := range stubs {
+		if full := stub.fullName(); stub.Sig != "" && sigs[full] == "" {
+			sigs[full] = stub.Sig
+		}
+	}
+	if len(sigs) == 0 {
+		return defs
+	}
+	out := make([]Definition, len(defs))
+	for i, def := range defs {
+		if def.Sig == "" {
+			def.Sig = sigs[def.fullName()]
+		}
+		out[i] = def
+	}
+	return out
+}
+
+func (w *WorkspaceIndex) stubPackages(name string) []Definition {
+	if w.stubs == nil {
+		return nil
+	}
+	return w.stubs.Packages[name]
+}
+
+func (w *WorkspaceIndex) stubSubs(name string) []Definition {
+	if w.stubs == nil {
+		return nil
+	}
+	return w.stubs.SubsByName[name]
+}
+
+func (w *WorkspaceIndex) stubSubsFull(name string) []Definition {
+	if w.stubs == nil {
+		return nil
+	}
+	return w.stubs.SubsByFull[name]
+}
@@ -0,0 +1,311 @@
+package analysis
+
+import (
+	"fmt"
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// TypeAlias is a named type declared with a "# :TYPE(Name = type)" comment.
+// It is visible as Name in the package that declares it and as
+// Package::Name everywhere else.
+type TypeAlias struct {
+	Package string
+	Name    string
+	Sig     string
+	// Offset is the start of the declaring comment.
+	Offset int
+}
+
+// FullName returns the package-qualified alias name.
+func (a TypeAlias) FullName() string {
+	return a.Package + "::" + a.Name
+}
+
+// ParseTypeDecl parses the contents of :TYPE(...), "Name = type". sigStart
+// is the offset of the type within decl, and error offsets are relative
+// to decl.
+func ParseTypeDecl(decl string) (name, sig string, sigStart int, err error) {
+	eq := strings.IndexByte(decl, '=')
+	if eq < 0 {
+		return "", "", 0, &SigError{Offset: len(decl), Msg: "expected Name = type"}
+	}
+	name = strings.TrimSpace(decl[:eq])
+	nameStart := len(decl[:eq]) - len(strings.TrimLeft(decl[:eq], " \t"))
+	switch {
+	case !isIdent(name):
+		return "", "", 0, &SigError{Offset: nameStart, Msg: fmt.Sprintf("invalid type alias name %q", name)}
+	case strings.ToLower(name) == name:
+		return "", "", 0, &SigError{Offset: nameStart, Msg: fmt.Sprintf("type alias %q must contain an uppercase letter", name)}
+	}
+	rest := decl[eq+1:]
+	sigStart = eq + 1 + len(rest) - len(strings.TrimLeft(rest, " \t"))
+	sig = strings.TrimSpace(rest)
+	if _, err := ParseSig(sig); err != nil {
+		if sigErr, ok := err.(*SigError); ok {
+			return "", "", 0, &SigError{Offset: sigStart + sigErr.Offset, Msg: sigErr.Msg}
+		}
+		return "", "", 0, err
+	}
+	return name, sig, sigStart, nil
+}
+
+// typeDeclComment returns the contents of a "# :TYPE(...)" comment.
+func typeDeclComment(comment string) (string, bool) {
+	body, ok := strings.CutPrefix(strings.TrimSpace(comment), "#")
+	if !ok {
+		return "", false
+	}
+	body, ok = strings.CutPrefix(strings.TrimSpace(body), ":TYPE")
+	if !ok {
+		return "", false
+	}
+	body = strings.TrimSpace(body)
+	if !strings.HasPrefix(body, "(") || !strings.HasSuffix(body, ")") {
+		return "", false
+	}
+	return body[1 : len(body)-1], true
+}
+
+// CollectTypeAliases returns the valid :TYPE declarations of a document.
+func CollectTypeAliases(doc *ppi.Document) []TypeAlias {
+	if doc == nil {
+		return nil
+	}
+	var out []TypeAlias
+	for i, tok := range doc.Tokens {
+		if tok.Type != ppi.TokenComment {
+			continue
+		}
+		decl, ok := typeDeclComment(tok.Value)
+		if !ok {
+			continue
+		}
+		name, sig, _, err := ParseTypeDecl(decl)
+		if err != nil {
+			continue
+		}
+		out = append(out, TypeAlias{Package: commentPackage(doc, i), Name: name, Sig: sig, Offset: tok.Start})
+	}
+	return out
+}
+
+// CommentPackage returns the package a comment at offset is written in.
+func CommentPackage(doc *ppi.Document, offset int) string {
+	for i, tok := range doc.Tokens {
+		if tok.Type == ppi.TokenComment && offset >= tok.Start && offset < tok.End {
+			return commentPackage(doc, i)
+		}
+	}
+	pkg := doc.PackageAt(offset)
+	if pkg == "" {
+		pkg = "main"
+	}
+	return pkg
+}
+
+// commentPackage returns the package in effect at the comment
+// doc.Tokens[idx]. A comment directly above a package statement is parsed
+// as part of that statement but still belongs to the previous package.
+func commentPackage(doc *ppi.Document, idx int) string {
+	offset := doc.Tokens[idx].Start
+	if next := nextNonTrivia(doc.Tokens, idx+1); next >= 0 && doc.Tokens[next].Type == ppi.TokenWord && doc.Tokens[next].Value == "package" {
+		prev := prevNonTrivia(doc.Tokens, idx-1)
+		if prev < 0 {
+			return "main"
+		}
+		offset = doc.Tokens[prev].Start
+	}
+	pkg := doc.PackageAt(offset)
+	if pkg == "" {
+		pkg = "main"
+	}
+	return pkg
+}
+
+// SigScope resolves the names used in a :SIG written in package Package.
+type SigScope struct {
+	Package string
+	// Alias looks up a type alias by its package-qualified name.
+	Alias func(fullName string) (TypeAlias, bool)
+	// Known reports whether a class is defined anywhere. When set, names
+	// without :: that are neither aliases nor known classes are reported
+	// as unknown types.
+	Known func(class string) bool
+}
+
+// DocumentAliases returns an alias lookup over the :TYPE declarations of
+// doc, falling back to next (which may be nil) for other names.
+func DocumentAliases(doc *ppi.Document, next func(string) (TypeAlias, bool)) func(string) (TypeAlias, bool) {
+	local := make(map[string]TypeAlias)
+	for _, alias := range CollectTypeAliases(doc) {
+		if _, dup := local[alias.FullName()]; !dup {
+			local[alias.FullName()] = alias
+		}
+	}
+	return func(full string) (TypeAlias, bool) {
+		if alias, ok := local[full]; ok {
+			return alias, true
+		}
+		if next != nil {
+			return next(full)
+		}
+		return TypeAlias{}, false
+	}
+}
+
+func (s SigScope) lookup(name string) (TypeAlias, bool) {
+	if s.Alias == nil {
+		return TypeAlias{}, false
+	}
+	if strings.Contains(name, "::") {
+		return s.Alias(name)
+	}
+	pkg := s.Package
+	if pkg == "" {
+		pkg = "main"
+	}
+	return s.Alias(pkg + "::" + name)
+}
+
+// ValidateSigInScope is ValidateSig that also expands aliases, reporting
+// alias cycles and, when s.Known is set, unknown type names.
+func ValidateSigInScope(sig string, s SigScope) error {
+	t, err := ParseSig(sig)
+	if err != nil {
+		return err
+	}
+	if err := checkLowercaseClasses(t, sig, s.Known); err != nil {
+		return err
+	}
+	_, err = s.expand(t, nil, sig)
+	return err
+}
+
+// Expand replaces alias references in t by the types they stand for.
+func (s SigScope) Expand(t Type) (Type, error) {
+	return s.expand(t, nil, "")
+}
+
+// expand expands t. stack holds the full names of the aliases being
+// expanded; src, when set, is used to locate names for error offsets.
+func (s SigScope) expand(t Type, stack []string, src string) (Type, error) {
+	switch t := t.(type) {
+	case ClassType:
+		alias, ok := s.lookup(t.Name)
+		if !ok {
+			if s.Known != nil && len(stack) == 0 && !strings.Contains(t.Name, "::") && !s.Known(t.Name) {
+				return nil, &SigError{Offset: nameOffset(src, t.Name), Msg: fmt.Sprintf("unknown type %q", t.Name)}
+			}
+			return t, nil
+		}
+		full := alias.FullName()
+		for i, name := range stack {
+			if name == full {
+				cycle := append(append([]string(nil), stack[i:]...), full)
+				return nil, &SigError{Offset: nameOffset(src, t.Name), Msg: "type alias cycle: " + strings.Join(cycle, " -> ")}
+			}
+		}
+		target, err := ParseSig(alias.Sig)
+		if err != nil {
+			return nil, &SigError{Offset: nameOffset(src, t.Name), Msg: fmt.Sprintf("invalid type alias %s: %v", full, err)}
+		}
+		inner := SigScope{Package: alias.Package, Alias: s.Alias}
+		expanded, err := inner.expand(target, append(stack, full), "")
+		if err != nil {
+			if sigErr, ok := err.(*SigError); ok && len(stack) == 0 {
+				return nil, &SigError{Offset: nameOffset(src, t.Name), Msg: sigErr.Msg}
+			}
+			return nil, err
+		}
+		return expanded, nil
+	case ArrayType:
+		elem, err := s.expand(t.Elem, stack, src)
+		if err != nil {
+			return nil, err
+		}
+		return ArrayType{Elem: elem}, nil
+	case HashType:
+		elem, err := s.expand(t.Elem, stack, src)
+		if err != nil {
+			return nil, err
+		}
+		return HashType{Elem: elem}, nil
+	case UnionType:
+		members := make([]Type, len(t.Types))
+		for i, member := range t.Types {
+			expanded, err := s.expand(member, stack, src)
+			if err != nil {
+				return nil, err
+			}
+			members[i] = expanded
+		}
+		return unionOf(members...), nil
+	case ShapeType:
+		fields := make([]Field, len(t.Fields))
+		for i, f := range t.Fields {
+			expanded, err := s.expand(f.Type, stack, src)
+			if err != nil {
+				return nil, err
+			}
+			fields[i] = Field{Name: f.Name, Type: expanded, Optional: f.Optional}
+		}
+		return ShapeType{Fields: fields}, nil
+	case CodeType:
+		if t.Func == nil {
+			return t, nil
+		}
+		fn, err := s.expandFunc(t.Func, stack, src)
+		if err != nil {
+			return nil, err
+		}
+		return CodeType{Func: fn}, nil
+	case *FuncType:
+		return s.expandFunc(t, stack, src)
+	}
+	return t, nil
+}
+
+func (s SigScope) expandFunc(fn *FuncType, stack []string, src string) (*FuncType, error) {
+	expandParams := func(params []Param) ([]Param, error) {
+		out := make([]Param, len(params))
+		for i, p := range params {
+			expanded, err := s.expand(p.Type, stack, src)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = Param{Type: expanded, Optional: p.Optional, Slurpy: p.Slurpy}
+		}
+		return out, nil
+	}
+	params, err := expandParams(fn.Params)
+	if err != nil {
+		return nil, err
+	}
+	returns, err := expandParams(fn.Returns)
+	if err != nil {
+		return nil, err
+	}
+	return &FuncType{Params: params, Returns: returns}, nil
+}
+
+// nameOffset returns the offset of the first whole-word occurrence of name
+// in src, or 0.
+func nameOffset(src, name string) int {
+	for from := 0; from < len(src); {
+		i := strings.Index(src[from:], name)
+		if i < 0 {
+			break
+		}
+		i += from
+		end := i + len(name)
+		before := i == 0 || !isSigIdentChar(src[i-1]) && src[i-1] != ':'
+		after := end == len(src) || !isSigIdentChar(src[end]) && src[end] != ':'
+		if before && after {
+			return i
+		}
+		from = i + 1
+	}
+	return 0
+}
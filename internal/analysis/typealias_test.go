@@ -0,0 +1,83 @@
+package analysis
+
+import (
+	"errors"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func TestParseTypeDecl(t *testing.T) {
+	name, sig, start, err := ParseTypeDecl("ServerConfig = hash{host: str, port: int}")
+	if err != nil || name != "ServerConfig" || sig != "hash{host: str, port: int}" || start != 15 {
+		t.Fatalf("unexpected result: %q %q %d %v", name, sig, start, err)
+	}
+	cases := []struct {
+		decl   string
+		offset int
+	}{
+		{"ServerConfig", 12},
+		{"config = str", 0},
+		{"1x = str", 0},
+		{"Port = intt", 7},
+	}
+	for _, tc := range cases {
+		_, _, _, err := ParseTypeDecl(tc.decl)
+		var sigErr *SigError
+		if !errors.As(err, &sigErr) || sigErr.Offset != tc.offset {
+			t.Fatalf("%q: expected error at %d, got %v", tc.decl, tc.offset, err)
+		}
+	}
+}
+
+func TestSigScopeAliases(t *testing.T) {
+	src := `package My::Types;
+# :TYPE(ServerConfig = hash{host: str, port: Port, tls: bool?})
+# :TYPE(Port = int)
+# :TYPE(Loop = array[Loop])
+# :TYPE(Ping = Pong|undef)
+# :TYPE(Pong = Ping)
+package main;
+# :TYPE(Configs = array[My::Types::ServerConfig])
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	if n := len(CollectTypeAliases(doc)); n != 6 {
+		t.Fatalf("expected 6 aliases, got %d", n)
+	}
+	aliases := DocumentAliases(doc, nil)
+	known := func(class string) bool { return class == "Known" }
+	types := SigScope{Package: "My::Types", Alias: aliases, Known: known}
+	main := SigScope{Package: "main", Alias: aliases, Known: known}
+
+	fn, err := ParseSig("ServerConfig -> Port")
+	if err != nil {
+		t.Fatalf("ParseSig: %v", err)
+	}
+	expanded, err := types.Expand(fn)
+	if err != nil || expanded.String() != "hash{host: str, port: int, tls: bool?} -> int" {
+		t.Fatalf("unexpected expansion: %v %v", expanded, err)
+	}
+	if err := ValidateSigInScope("Configs -> Known", main); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	cases := []struct {
+		scope  SigScope
+		sig    string
+		msg    string
+		offset int
+	}{
+		{types, "(int, Loop) -> void", "type alias cycle: My::Types::Loop -> My::Types::Loop", 6},
+		{types, "Ping", "type alias cycle: My::Types::Ping -> My::Types::Pong -> My::Types::Ping", 0},
+		{main, "ServerConfig", `unknown type "ServerConfig"`, 0},
+		{main, "array[Known|Nope]", `unknown type "Nope"`, 12},
+	}
+	for _, tc := range cases {
+		err := ValidateSigInScope(tc.sig, tc.scope)
+		var sigErr *SigError
+		if !errors.As(err, &sigErr) || sigErr.Msg != tc.msg || sigErr.Offset != tc.offset {
+			t.Fatalf("%q: expected %q at %d, got %#v", tc.sig, tc.msg, tc.offset, err)
+		}
+	}
+}
@@ -0,0 +1,204 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// BareCall is a call of an unqualified sub by name: "name(...)" or "&name".
+type BareCall struct {
+	Name    string
+	Package string
+	Start   int
+	End     int
+}
+
+// callKeywords are the words that may be followed by a parenthesis without
+// being a sub call.
+var callKeywords = map[string]bool{
+	"if": true, "elsif": true, "unless": true, "while": true, "until": true,
+	"for": true, "foreach": true, "given": true, "when": true, "return": true,
+	"my": true, "our": true, "state": true, "local": true, "field": true,
+	"and": true, "or": true, "not": true, "xor": true, "x": true,
+	"lt": true, "gt": true, "le": true, "ge": true, "eq": true, "ne": true, "cmp": true,
+	"sub": true, "method": true, "do": true, "eval": true,
+	"try": true, "catch": true, "finally": true, "defer": true,
+	"qw": true, "q": true, "qq": true, "qr": true, "qx": true, "m": true, "s": true, "tr": true, "y": true,
+	"__PACKAGE__": true, "__SUB__": true, "__FILE__": true, "__LINE__": true,
+}
+
+// BareCalls returns the calls of unqualified subs in doc. Only the forms
+// that are certainly calls count: a name followed by a parenthesis, and
+// &name. Method calls, declarations and keywords are skipped.
+func BareCalls(doc *ppi.Document) []BareCall {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	pkgAt := PackageLookup(doc)
+	var out []BareCall
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement || n.Kind == "statement::include" || n.Kind == "statement::package" {
+			return
+		}
+		tokens := n.Tokens
+		for i, tok := range tokens {
+			name := ""
+			switch tok.Type {
+			case ppi.TokenSymbol:
+				var ok bool
+				if name, ok = strings.CutPrefix(tok.Value, "&"); !ok {
+					continue
+				}
+				// \&name and defined &name do not need the sub to exist.
+				if prev := prevNonTrivia(tokens, i-1); prev >= 0 {
+					switch tokens[prev].Value {
+					case "\\", "defined", "exists":
+						continue
+					}
+				}
+			case ppi.TokenWord:
+				next := nextNonTrivia(tokens, i+1)
+				if next < 0 || tokens[next].Type != ppi.TokenOperator || tokens[next].Value != "(" {
+					continue
+				}
+				if prev := prevNonTrivia(tokens, i-1); prev >= 0 {
+					switch tokens[prev].Value {
+					case "->", "sub", "method":
+						continue
+					}
+				}
+				name = tok.Value
+			default:
+				continue
+			}
+			if !isIdent(name) || callKeywords[name] {
+				continue
+			}
+			pkg := pkgAt(tok.Start)
+			if pkg == "" {
+				pkg = "main"
+			}
+			out = append(out, BareCall{Name: name, Package: pkg, Start: tok.Start, End: tok.End})
+		}
+	})
+	return out
+}
+
+// DefinedSubNames returns the names of the subs doc defines in any
+// package: sub declarations, including forward ones, constants, "use subs"
+// and glob assignments such as "*name = sub { ... }".
+func DefinedSubNames(doc *ppi.Document) map[string]bool {
+	out := make(map[string]bool)
+	if doc == nil || doc.Root == nil {
+		return out
+	}
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement {
+			return
+		}
+		switch {
+		case n.Kind == "statement::sub" && n.Name != "":
+			out[n.Name[strings.LastIndex(n.Name, "::")+1:]] = true
+		case n.Kind == "statement::include" && n.Keyword == "use" && (n.Name == "constant" || n.Name == "subs"):
+			for _, name := range constantNames(n) {
+				out[name] = true
+			}
+		default:
+			for i, tok := range n.Tokens {
+				if tok.Type != ppi.TokenSymbol || len(tok.Value) < 2 || tok.Value[0] != '*' {
+					continue
+				}
+				if next := nextNonTrivia(n.Tokens, i+1); next >= 0 && n.Tokens[next].Value == "=" {
+					name := tok.Value[1:]
+					out[name[strings.LastIndex(name, "::")+1:]] = true
+				}
+			}
+		}
+	})
+	for _, class := range CollectClasses(doc) {
+		for _, m := range class.Methods {
+			out[m.Name] = true
+		}
+	}
+	return out
+}
+
+// constantNames returns the names a "use constant" or "use subs" statement
+// declares: "NAME => value", "{ A => 1, B => 2 }" or a qw list.
+func constantNames(n *ppi.Node) []string {
+	ts := significantTokens(n.Tokens)
+	if len(ts) < 3 {
+		return nil
+	}
+	var out []string
+	depth := 0
+	for i := 2; i < len(ts); i++ {
+		tok := ts[i]
+		switch {
+		case tok.Type == ppi.TokenOperator && (tok.Value == "(" || tok.Value == "[" || (tok.Value == "{" && i > 2)):
+			depth++
+		case tok.Type == ppi.TokenOperator && (tok.Value == ")" || tok.Value == "]" || (tok.Value == "}" && depth > 0)):
+			depth--
+		case tok.Type == ppi.TokenQuoteLike && depth == 0:
+			out = append(out, splitQWNames(tok.Value)...)
+		case depth == 0 && i+1 < len(ts) && ts[i+1].Value == "=>" && (i == 2 || ts[i-1].Value == "," || ts[i-1].Value == "{"):
+			if name := unquote(tok.Value); isIdent(name) {
+				out = append(out, name)
+			}
+		}
+	}
+	return out
+}
+
+// DynamicPackages returns the packages of doc whose subs cannot all be seen
+// statically: those defining AUTOLOAD, asked about with can or assigning
+// to a glob, and the Moose, Moo and Mouse classes, whose base class is
+// implicit.
+func DynamicPackages(doc *ppi.Document) map[string]bool {
+	out := usingPackages(doc, mooseModules)
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement {
+			return
+		}
+		start, _, ok := nodeTokenRange(n)
+		if !ok {
+			return
+		}
+		if n.Kind == "statement::sub" && n.Name == "AUTOLOAD" {
+			out[packageOrMain(doc, start)] = true
+			return
+		}
+		for i, tok := range n.Tokens {
+			switch {
+			case tok.Type == ppi.TokenWord && tok.Value == "can":
+				// Class->can asks about Class, not the calling package.
+				if arrow := prevNonTrivia(n.Tokens, i-1); arrow >= 0 && n.Tokens[arrow].Value == "->" {
+					if recv := prevNonTrivia(n.Tokens, arrow-1); recv >= 0 && n.Tokens[recv].Type == ppi.TokenWord && n.Tokens[recv].Value != "__PACKAGE__" && isClassName(n.Tokens[recv].Value) {
+						out[n.Tokens[recv].Value] = true
+						continue
+					}
+				}
+			case tok.Type == ppi.TokenSymbol && strings.HasPrefix(tok.Value, "*") && isGlobAssignment(n.Tokens, i):
+			default:
+				continue
+			}
+			out[packageOrMain(doc, tok.Start)] = true
+		}
+	})
+	return out
+}
+
+// isGlobAssignment reports whether the glob at tokens[idx], "*name" or
+// "*{...}", is assigned to.
+func isGlobAssignment(tokens []ppi.Token, idx int) bool {
+	next := nextNonTrivia(tokens, idx+1)
+	if next >= 0 && tokens[idx].Value == "*" && tokens[next].Value == "{" {
+		closeIdx := closesAt(tokens, next)
+		if closeIdx < 0 {
+			return false
+		}
+		next = nextNonTrivia(tokens, closeIdx+1)
+	}
+	return next >= 0 && tokens[next].Type == ppi.TokenOperator && tokens[next].Value == "="
+}
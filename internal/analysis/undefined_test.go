@@ -0,0 +1,67 @@
+package analysis
+
+import (
+	"reflect"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func TestBareCallsAndDefinedSubNames(t *testing.T) {
+	src := `package Foo;
+use constant PI => 3;
+use constant { E => 2, TAU => 6 };
+use subs qw(later);
+sub declared;
+*glob_sub = sub { 1 };
+sub run {
+    my $self = shift;
+    helper(1);
+    &amp_call;
+    my $ref = \&not_a_call;
+    print "x" if defined &maybe;
+    $self->method(1);
+    if (1) { return (2) }
+    PI();
+}
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var calls []string
+	for _, call := range BareCalls(doc) {
+		calls = append(calls, call.Package+"::"+call.Name)
+	}
+	if want := []string{"Foo::helper", "Foo::amp_call", "Foo::PI"}; !reflect.DeepEqual(calls, want) {
+		t.Fatalf("expected calls %v, got %v", want, calls)
+	}
+	defined := DefinedSubNames(doc)
+	for _, name := range []string{"PI", "E", "TAU", "later", "declared", "glob_sub", "run"} {
+		if !defined[name] {
+			t.Fatalf("expected %s to be defined: %v", name, defined)
+		}
+	}
+	if defined["helper"] {
+		t.Fatalf("helper is not defined")
+	}
+}
+
+func TestDynamicPackages(t *testing.T) {
+	src := `package A;
+sub AUTOLOAD { 1 }
+package B;
+*{"B::x"} = sub { 1 };
+package C;
+my $ok = D->can('x');
+package E;
+use Moo;
+package F;
+local *STDOUT;
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	got := DynamicPackages(doc)
+	want := map[string]bool{"A": true, "B": true, "D": true, "E": true}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
@@ -0,0 +1,449 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// Unused is a declaration nothing in the file uses: a lexical variable, an
+// imported name or a private sub. Start and End span its name, and Fix
+// removes the declaration, or is nil when that is not safe.
+type Unused struct {
+	// Kind is variable, import or sub.
+	Kind    string
+	Name    string
+	Message string
+	Start   int
+	End     int
+	Fix     *Edit
+}
+
+// Edit replaces the text from Start to End with NewText.
+type Edit struct {
+	Start   int
+	End     int
+	NewText string
+}
+
+// declKeywords are the words that declare the variables after them.
+var declKeywords = map[string]bool{"my": true, "our": true, "state": true, "field": true, "has": true}
+
+// UnusedVariables reports my and state variables declared at the start of
+// a statement that are never read. A plain assignment is not a read, but
+// a variable assigned elsewhere gets no fix, as removing its declaration
+// would break the assignment. Names starting with "_", such as $_ and
+// $_unused, are never reported.
+func UnusedVariables(doc *ppi.Document) []Unused {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	index := IndexDocument(doc)
+	if index == nil {
+		return nil
+	}
+	read, written := lexicalUses(doc, index.Root)
+	var out []Unused
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement {
+			return
+		}
+		ts := significantTokens(n.Tokens)
+		if len(ts) < 2 || ts[0].Type != ppi.TokenWord || (ts[0].Value != "my" && ts[0].Value != "state") {
+			return
+		}
+		for _, tok := range n.Tokens {
+			if tok.Type == ppi.TokenHereDoc {
+				return
+			}
+		}
+		for _, tok := range declaredNames(ts[1:]) {
+			if len(tok.Value) < 2 || tok.Value[1] == '_' || read[tok.Start] {
+				continue
+			}
+			var fix *Edit
+			if !written[tok.Start] {
+				e := removeDeclaredName(doc.Source, n, ts, tok)
+				fix = &e
+			}
+			out = append(out, Unused{
+				Kind:    "variable",
+				Name:    tok.Value,
+				Message: tok.Value + " is declared but never used",
+				Start:   tok.Start,
+				End:     tok.End,
+				Fix:     fix,
+			})
+		}
+	})
+	return out
+}
+
+// removeDeclaredName removes tok from its my declaration: the name and its
+// comma when it is the last one of a list, "undef" in its place when names
+// follow it, so that they still get the same values, and otherwise the
+// declaration. An initializer other than a literal or a variable may have
+// side effects, so only "my $x =" goes and the expression stays.
+func removeDeclaredName(source string, n *ppi.Node, ts []ppi.Token, tok ppi.Token) Edit {
+	for i := 1; i+1 < len(ts); i++ {
+		if ts[i].Start != tok.Start {
+			continue
+		}
+		prev, next := ts[i-1], ts[i+1]
+		switch {
+		case prev.Value == "(" && next.Value == ")":
+		case next.Value == ")" && prev.Value == ",":
+			return Edit{Start: prev.Start, End: tok.End}
+		case prev.Value == "(" || prev.Value == ",":
+			return Edit{Start: tok.Start, End: tok.End, NewText: "undef"}
+		}
+	}
+	for i := 1; i+1 < len(ts); i++ {
+		if ts[i].Type != ppi.TokenOperator || ts[i].Value != "=" {
+			continue
+		}
+		init := ts[i+1:]
+		if init[len(init)-1].Value == ";" {
+			init = init[:len(init)-1]
+		}
+		if len(init) > 1 || (len(init) == 1 && init[0].Type != ppi.TokenNumber && init[0].Type != ppi.TokenQuote && init[0].Type != ppi.TokenSymbol) {
+			return Edit{Start: ts[0].Start, End: init[0].Start}
+		}
+		break
+	}
+	start, end := StatementSpan(source, n)
+	start, end = RemovalRange(source, start, end)
+	return Edit{Start: start, End: end}
+}
+
+// lexicalUses returns the starts of the variable declarations that are
+// read somewhere, in code or interpolated into a string, and of those that
+// are assigned to after their declaration.
+func lexicalUses(doc *ppi.Document, root *Scope) (map[int]bool, map[int]bool) {
+	tokens := doc.Tokens
+	r := newDeclResolver(tokens, root)
+	decls := r.decls
+	read := make(map[int]bool)
+	written := make(map[int]bool)
+	mark := func(name string, offset int) {
+		if sym, ok := r.resolve(name, offset); ok {
+			read[sym.Start] = true
+		}
+	}
+	for i, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenSymbol:
+			if decls[tok.Start] {
+				continue
+			}
+			names := symbolReads(tokens, i)
+			if len(names) == 0 {
+				if sym, ok := r.resolve(tok.Value, tok.Start); ok {
+					written[sym.Start] = true
+				}
+			}
+			for _, name := range names {
+				mark(name, tok.Start)
+			}
+		case ppi.TokenQuote, ppi.TokenQuoteLike, ppi.TokenHereDocContent:
+			for _, name := range interpolatedNames(tok.Value) {
+				mark(name, tok.Start)
+			}
+		case ppi.TokenComment:
+			// "$#{$ref}" comes through as "$" and a comment.
+			if i > 0 && tokens[i-1].Value == "$" {
+				if name := parseHashSizeCommentVar(tok.Value); name != "" {
+					mark(name, tok.Start)
+				}
+			}
+		}
+	}
+	return read, written
+}
+
+// declResolver finds the declaration a use of a variable refers to.
+type declResolver struct {
+	root         *Scope
+	decls        map[int]bool
+	symbolStarts map[int]bool
+}
+
+func newDeclResolver(tokens []ppi.Token, root *Scope) *declResolver {
+	r := &declResolver{root: root, decls: declarationTokens(tokens), symbolStarts: make(map[int]bool)}
+	for _, tok := range tokens {
+		if tok.Type == ppi.TokenSymbol {
+			r.symbolStarts[tok.Start] = true
+		}
+	}
+	return r
+}
+
+// resolve returns the innermost, latest declaration of name before offset.
+func (r *declResolver) resolve(name string, offset int) (Symbol, bool) {
+	for cur := scopeForOffset(r.root, offset); cur != nil; cur = cur.Parent {
+		best := -1
+		for i, sym := range cur.Symbols {
+			if sym.Kind != SymbolVar || sym.Name != name || sym.Start >= offset {
+				continue
+			}
+			// collectVariables also records the variables read in the
+			// initializer of a declaration; only real declarations count.
+			if r.symbolStarts[sym.Start] && !r.decls[sym.Start] {
+				continue
+			}
+			if best < 0 || sym.Start > cur.Symbols[best].Start {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return cur.Symbols[best], true
+		}
+	}
+	return Symbol{}, false
+}
+
+// declarationTokens returns the starts of the variables that my, our,
+// state, field and has declare.
+func declarationTokens(tokens []ppi.Token) map[int]bool {
+	out := make(map[int]bool)
+	for i, tok := range tokens {
+		if tok.Type != ppi.TokenWord || !declKeywords[tok.Value] {
+			continue
+		}
+		j := nextNonTrivia(tokens, i+1)
+		if j < 0 {
+			continue
+		}
+		if tokens[j].Type == ppi.TokenSymbol {
+			out[tokens[j].Start] = true
+			continue
+		}
+		if tokens[j].Type != ppi.TokenOperator || tokens[j].Value != "(" {
+			continue
+		}
+		for k := j + 1; k < len(tokens); k++ {
+			if tokens[k].Type == ppi.TokenOperator && tokens[k].Value == ")" {
+				break
+			}
+			if tokens[k].Type == ppi.TokenSymbol && len(tokens[k].Value) > 1 {
+				out[tokens[k].Start] = true
+			}
+		}
+	}
+	return out
+}
+
+// symbolReads returns the variables the symbol at tokens[idx] reads: "$x[0]"
+// reads @x and "$x{k}" reads %x. As it cannot tell which is meant, the
+// scalar is read as well.
+func symbolReads(tokens []ppi.Token, idx int) []string {
+	v := tokens[idx].Value
+	if strings.HasPrefix(v, "$#") {
+		if len(v) > 2 {
+			return []string{"@" + v[2:]}
+		}
+		return nil
+	}
+	if len(v) < 2 || strings.Contains(v, "::") {
+		return nil
+	}
+	nextOp := ""
+	next := nextNonTrivia(tokens, idx+1)
+	if next >= 0 && tokens[next].Type == ppi.TokenOperator {
+		nextOp = tokens[next].Value
+	}
+	if nextOp == "=" && (next+1 >= len(tokens) || tokens[next+1].Type != ppi.TokenOperator || tokens[next+1].Value != "~") {
+		return nil
+	}
+	name := v[1:]
+	switch {
+	case v[0] == '$' && nextOp == "[":
+		return []string{v, "@" + name}
+	case (v[0] == '$' || v[0] == '@') && nextOp == "{":
+		return []string{v, "%" + name}
+	case v[0] == '%' && nextOp == "[":
+		return []string{v, "@" + name}
+	}
+	return []string{v}
+}
+
+// interpolatedNames returns the variables a string or regexp may
+// interpolate. Single-quoted strings and qw lists have none.
+func interpolatedNames(value string) []string {
+	if strings.HasPrefix(value, "'") || strings.HasPrefix(value, "qw") ||
+		(strings.HasPrefix(value, "q") && len(value) > 1 && !isWordStart(value[1])) {
+		return nil
+	}
+	var out []string
+	for i := 0; i < len(value); i++ {
+		sigil := value[i]
+		if sigil != '$' && sigil != '@' {
+			continue
+		}
+		j := i + 1
+		lastIndex := sigil == '$' && j < len(value) && value[j] == '#'
+		if lastIndex {
+			sigil = '@'
+			j++
+		}
+		brace := j < len(value) && value[j] == '{'
+		if brace {
+			j++
+		}
+		start := j
+		for j < len(value) && (isWordStart(value[j]) || isDigit(value[j])) {
+			j++
+		}
+		if j == start || isDigit(value[start]) {
+			continue
+		}
+		name := value[start:j]
+		if brace {
+			if j >= len(value) || value[j] != '}' {
+				continue
+			}
+			j++
+		}
+		out = append(out, string(sigil)+name)
+		if j < len(value) && !lastIndex {
+			switch {
+			case sigil == '$' && value[j] == '[':
+				out = append(out, "@"+name)
+			case value[j] == '{':
+				out = append(out, "%"+name)
+			}
+		}
+		i = j - 1
+	}
+	return out
+}
+
+// UnusedPrivateSubs reports subs whose name starts with "_" that nothing in
+// their package refers to, by a call, a method call, a \&ref or a string
+// naming them. The _build_ and _trigger_ subs of attributes are used
+// implicitly and never reported.
+func UnusedPrivateSubs(doc *ppi.Document) []Unused {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	pkgAt := PackageLookup(doc)
+	implicit := make(map[string]bool)
+	for _, acc := range CollectAccessors(doc) {
+		implicit[acc.Package+"::_build_"+acc.Attribute] = true
+		implicit[acc.Package+"::_trigger_"+acc.Attribute] = true
+	}
+	type privateSub struct {
+		node *ppi.Node
+		pkg  string
+		name ppi.Token
+	}
+	var subs []privateSub
+	nameStarts := make(map[int]bool)
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::sub" || !strings.HasPrefix(n.Name, "_") || strings.HasPrefix(n.Name, "__") || strings.Contains(n.Name, "::") {
+			return
+		}
+		for _, tok := range n.Tokens {
+			if tok.Type == ppi.TokenWord && tok.Value == n.Name {
+				subs = append(subs, privateSub{node: n, pkg: pkgAt(tok.Start), name: tok})
+				nameStarts[tok.Start] = true
+				return
+			}
+		}
+	})
+	if len(subs) == 0 {
+		return nil
+	}
+	used := make(map[string]bool)
+	refer := func(name string, offset int) {
+		if strings.Contains(name, "::") {
+			used[name] = true
+			return
+		}
+		used[pkgAt(offset)+"::"+name] = true
+	}
+	for _, tok := range doc.Tokens {
+		if nameStarts[tok.Start] {
+			continue
+		}
+		switch tok.Type {
+		case ppi.TokenWord:
+			refer(tok.Value, tok.Start)
+		case ppi.TokenSymbol:
+			if name, ok := strings.CutPrefix(tok.Value, "&"); ok {
+				refer(name, tok.Start)
+			}
+		case ppi.TokenQuote:
+			refer(unquote(tok.Value), tok.Start)
+		case ppi.TokenQuoteLike:
+			for _, name := range splitQWNames(tok.Value) {
+				refer(name, tok.Start)
+			}
+		}
+	}
+	var out []Unused
+	for _, sub := range subs {
+		key := sub.pkg + "::" + sub.name.Value
+		if used[key] || implicit[key] {
+			continue
+		}
+		start, end := StatementSpan(doc.Source, sub.node)
+		start, end = RemovalRange(doc.Source, start, end)
+		out = append(out, Unused{
+			Kind:    "sub",
+			Name:    sub.name.Value,
+			Message: "sub " + sub.name.Value + " is never called in package " + sub.pkg,
+			Start:   sub.name.Start,
+			End:     sub.name.End,
+			Fix:     &Edit{Start: start, End: end},
+		})
+	}
+	return out
+}
+
+// StatementSpan returns the range of the statement n without the
+// whitespace around it.
+func StatementSpan(source string, n *ppi.Node) (int, int) {
+	start, end, ok := nodeTokenRange(n)
+	if !ok {
+		return 0, 0
+	}
+	for start < end && IsSpace(source[start]) {
+		start++
+	}
+	for end > start && IsSpace(source[end-1]) {
+		end--
+	}
+	return start, end
+}
+
+// RemovalRange widens the range from start to end to whole lines, with
+// their newline, when nothing else is on them, so that deleting it leaves
+// no blank line behind. Otherwise it takes the spaces after the range, if
+// there are spaces before it too.
+func RemovalRange(source string, start, end int) (int, int) {
+	lineStart, lineEnd := start, end
+	for lineStart > 0 && (source[lineStart-1] == ' ' || source[lineStart-1] == '\t') {
+		lineStart--
+	}
+	for lineEnd < len(source) && (source[lineEnd] == ' ' || source[lineEnd] == '\t' || source[lineEnd] == '\r') {
+		lineEnd++
+	}
+	if (lineStart > 0 && source[lineStart-1] != '\n') || (lineEnd < len(source) && source[lineEnd] != '\n') {
+		if lineStart < start {
+			for end < len(source) && (source[end] == ' ' || source[end] == '\t') {
+				end++
+			}
+		}
+		return start, end
+	}
+	if lineEnd < len(source) {
+		lineEnd++
+	}
+	return lineStart, lineEnd
+}
+
+// IsSpace reports whether ch is a space, tab or line break.
+func IsSpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n'
+}
@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func applyEdit(src string, e Edit) string {
+	return src[:e.Start] + e.NewText + src[e.End:]
+}
+
+func TestUnusedVariables(t *testing.T) {
+	src := `use strict;
+my $used = 1;
+my $unused = 2;
+my $_ignored = 3;
+my ($first, $second) = @_;
+my ($x, $y) = @_;
+print $used, $y;
+my @list;
+my %hash;
+print "$list[0] @hash{a}";
+my $assigned;
+$assigned = 4;
+my $conn = connect_db();
+my $re = qr/a/;
+print 1 if "b" =~ /$re/;
+my $outer = 1;
+{
+    my $outer = 2;
+    print $outer;
+}
+sub f ($arg) {
+    my $count = $arg;
+    return $count;
+}
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var names []string
+	fixed := map[string]string{}
+	for _, u := range UnusedVariables(doc) {
+		names = append(names, u.Name)
+		if u.Fix != nil {
+			fixed[u.Name] = applyEdit(src, *u.Fix)
+		}
+	}
+	want := []string{"$unused", "$first", "$second", "$x", "$assigned", "$conn", "$outer"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("expected %v, got %v", want, names)
+	}
+	for name, line := range map[string]string{
+		"$unused": "my $used = 1;\nmy $_ignored = 3;\n",
+		"$second": "my ($first) = @_;\n",
+		"$x":      "my (undef, $y) = @_;\n",
+		"$conn":   "$assigned = 4;\nconnect_db();\nmy $re",
+	} {
+		if !strings.Contains(fixed[name], line) {
+			t.Fatalf("fix for %s: expected %q in\n%s", name, line, fixed[name])
+		}
+	}
+	if _, ok := fixed["$assigned"]; ok {
+		t.Fatalf("expected no fix for $assigned, got\n%s", fixed["$assigned"])
+	}
+}
+
+func TestUnusedPrivateSubs(t *testing.T) {
+	src := `package Foo;
+use Moo;
+has name => (is => 'lazy');
+sub _build_name { 'x' }
+sub _called { 1 }
+sub _method { 1 }
+sub _by_name { 1 }
+sub _unused { 1 }
+sub public { _called() + shift->_method + __PACKAGE__->can('_by_name') }
+package Bar;
+sub _unused_too { 1 }
+sub run { Foo::_unused_too() }
+1;
+`
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	unused := UnusedPrivateSubs(doc)
+	var got []string
+	for _, u := range unused {
+		got = append(got, u.Message)
+	}
+	want := []string{"sub _unused is never called in package Foo", "sub _unused_too is never called in package Bar"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	if fixed := applyEdit(src, *unused[0].Fix); !strings.Contains(fixed, "sub _by_name { 1 }\nsub public") {
+		t.Fatalf("unexpected fix:\n%s", fixed)
+	}
+}
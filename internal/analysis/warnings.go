@@ -0,0 +1,320 @@
+package analysis
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// WarningDiagnostic is a warning perl -w would give, found statically.
+// Category is the warnings category that controls it.
+type WarningDiagnostic struct {
+	Message  string
+	Offset   int
+	Category string
+}
+
+// comparisonOps are the operators that bind tighter than the bitwise
+// operators, so that "$x & 1 == 0" means "$x & (1 == 0)".
+var comparisonOps = map[string]bool{
+	"==": true, "!=": true, "<": true, ">": true, "<=": true, ">=": true, "<=>": true,
+	"eq": true, "ne": true, "lt": true, "gt": true, "le": true, "ge": true, "cmp": true,
+}
+
+// WarningDiagnostics reports a "use strict" file that never enables
+// warnings, and a set of perl -w compile-time warnings: a my variable
+// masking an earlier one in the same scope, a constant in void context,
+// "=" in a conditional, a one-element slice written for an element, and
+// a comparison used as an operand of a bitwise operator. Each warning is
+// only reported where its category is enabled.
+func WarningDiagnostics(doc *ppi.Document) []WarningDiagnostic {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	var out []WarningDiagnostic
+	report := func(offset int, category, message string) {
+		if !PragmasAt(doc, offset).WarningEnabled(category) {
+			return
+		}
+		out = append(out, WarningDiagnostic{Message: message, Offset: offset, Category: category})
+	}
+	if offset, ok := strictWithoutWarnings(doc); ok {
+		out = append(out, WarningDiagnostic{Message: "use strict without use warnings", Offset: offset})
+	}
+	checkBlockStatements(doc, report)
+	checkTokenWarnings(doc.Tokens, report)
+	return out
+}
+
+// strictWithoutWarnings returns the offset of the first "use strict" of a
+// file that enables no warnings: no "use warnings", bundle or -w switch.
+func strictWithoutWarnings(doc *ppi.Document) (int, bool) {
+	if len(doc.Tokens) > 0 && strings.HasPrefix(doc.Tokens[0].Value, "#!") {
+		for _, arg := range strings.Fields(doc.Tokens[0].Value)[1:] {
+			if strings.HasPrefix(arg, "-") && strings.ContainsAny(arg, "wW") {
+				return 0, false
+			}
+		}
+	}
+	strict := -1
+	warnings := false
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::include" || strings.ToLower(n.Keyword) != "use" {
+			return
+		}
+		if n.Name == "strict" && strict < 0 {
+			if start, _, ok := nodeTokenRange(n); ok {
+				strict = start
+			}
+		}
+		if next, changed := applyPragma(PragmaState{}, n); changed && (next.Warnings || len(next.WarningCategories) > 0) {
+			warnings = true
+		}
+	})
+	return strict, strict >= 0 && !warnings
+}
+
+// checkBlockStatements looks at the statements directly in each block for
+// masking my declarations and constants in void context.
+func checkBlockStatements(doc *ppi.Document, report func(offset int, category, message string)) {
+	sigVars := make(map[*ppi.Node][]string)
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n != nil && n.Kind == "statement::sub" && len(n.SubSigVars) > 0 {
+			if blk := nodeBlockChild(n); blk != nil {
+				sigVars[blk] = n.SubSigVars
+			}
+		}
+	})
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || (n.Type != ppi.NodeBlock && n.Type != ppi.NodeDocument) {
+			return
+		}
+		declared := make(map[string]bool)
+		for _, name := range sigVars[n] {
+			declared[name] = true
+		}
+		last := -1
+		for i, child := range n.Children {
+			if child != nil && child.Type == ppi.NodeStatement && !isPodOrData(doc.Source, child) {
+				last = i
+			}
+		}
+		for i, child := range n.Children {
+			if child == nil || child.Type != ppi.NodeStatement {
+				continue
+			}
+			ts := significantTokens(child.Tokens)
+			if len(ts) == 0 {
+				continue
+			}
+			if ts[0].Type == ppi.TokenWord && (ts[0].Value == "my" || ts[0].Value == "state") {
+				for _, tok := range declaredNames(ts[1:]) {
+					if declared[tok.Value] {
+						report(tok.Start, "shadow", `"`+ts[0].Value+`" variable `+tok.Value+" masks earlier declaration in same scope")
+					}
+					declared[tok.Value] = true
+				}
+			}
+			if i != last && len(ts) == 2 && ts[1].Type == ppi.TokenOperator && ts[1].Value == ";" && isUselessConstant(ts[0]) {
+				report(ts[0].Start, "void", "Useless use of a constant ("+ts[0].Value+") in void context")
+			}
+		}
+	})
+}
+
+// isPodOrData reports whether the statement n is __END__ or __DATA__ and
+// the text after it, or POD. go-ppi has no POD tokens, so POD reads as a
+// statement starting with "=" and a word at the start of a line.
+func isPodOrData(src string, n *ppi.Node) bool {
+	ts := significantTokens(n.Tokens)
+	if len(ts) == 0 {
+		return false
+	}
+	if ts[0].Type == ppi.TokenSeparator || ts[0].Value == "__END__" || ts[0].Value == "__DATA__" {
+		return true
+	}
+	return len(ts) > 1 && ts[0].Value == "=" && (ts[0].Start == 0 || src[ts[0].Start-1] == '\n') &&
+		ts[1].Type == ppi.TokenWord && ts[1].Start == ts[0].End
+}
+
+// declaredNames returns the variables of a my declaration: "$x" or
+// "($x, @y)", up to the assignment.
+func declaredNames(ts []ppi.Token) []ppi.Token {
+	if len(ts) == 0 {
+		return nil
+	}
+	if ts[0].Type == ppi.TokenSymbol {
+		return ts[:1]
+	}
+	if ts[0].Type != ppi.TokenOperator || ts[0].Value != "(" {
+		return nil
+	}
+	var out []ppi.Token
+	for _, tok := range ts[1:] {
+		if tok.Type == ppi.TokenOperator && tok.Value == ")" {
+			break
+		}
+		if tok.Type == ppi.TokenSymbol && len(tok.Value) > 1 {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+// isUselessConstant reports whether tok is a constant perl warns about in
+// void context. 0 and 1, and strings starting with "di", "ds" or "ig", are
+// exempt, as they are used as no-ops.
+func isUselessConstant(tok ppi.Token) bool {
+	switch tok.Type {
+	case ppi.TokenNumber:
+		return tok.Value != "0" && tok.Value != "1"
+	case ppi.TokenQuote:
+		s := unquote(tok.Value)
+		return !strings.HasPrefix(s, "di") && !strings.HasPrefix(s, "ds") && !strings.HasPrefix(s, "ig")
+	}
+	return false
+}
+
+// checkTokenWarnings finds "=" in conditionals, one-element slices and
+// precedence problems on bitwise operators.
+func checkTokenWarnings(tokens []ppi.Token, report func(offset int, category, message string)) {
+	for i, tok := range tokens {
+		switch tok.Type {
+		case ppi.TokenWord:
+			switch tok.Value {
+			case "if", "elsif", "unless", "while", "until":
+			default:
+				continue
+			}
+			open := nextNonTrivia(tokens, i+1)
+			if open < 0 || tokens[open].Type != ppi.TokenOperator || tokens[open].Value != "(" {
+				continue
+			}
+			closeIdx := closesAt(tokens, open)
+			if closeIdx < 0 {
+				continue
+			}
+			ts := significantTokens(tokens[open+1 : closeIdx])
+			if len(ts) == 3 && ts[0].Type == ppi.TokenSymbol && ts[1].Type == ppi.TokenOperator && ts[1].Value == "=" && (ts[2].Type == ppi.TokenNumber || ts[2].Type == ppi.TokenQuote) {
+				report(ts[1].Start, "syntax", "Found = in conditional, should be ==")
+			}
+		case ppi.TokenSymbol:
+			// go-ppi reads a lone & as a symbol, even as an operator.
+			if tok.Value == "&" {
+				if prev := prevNonTrivia(tokens, i-1); prev >= 0 && isOperandEnd(tokens[prev]) && bitwiseNextToComparison(tokens, i) {
+					report(tok.Start, "precedence", "Possible precedence problem on bitwise & operator")
+				}
+				continue
+			}
+			if len(tok.Value) < 2 || tok.Value[0] != '@' {
+				continue
+			}
+			if msg, ok := scalarSlice(tokens, i); ok {
+				report(tok.Start, "syntax", msg)
+			}
+		case ppi.TokenOperator:
+			if tok.Value != "&" && tok.Value != "|" && tok.Value != "^" {
+				continue
+			}
+			if bitwiseNextToComparison(tokens, i) {
+				report(tok.Start, "precedence", "Possible precedence problem on bitwise "+tok.Value+" operator")
+			}
+		}
+	}
+}
+
+// scalarSlice reports "@x[0]" and "@x{key}" slices of a single element.
+func scalarSlice(tokens []ppi.Token, idx int) (string, bool) {
+	open := idx + 1
+	if open >= len(tokens) || tokens[open].Type != ppi.TokenOperator || (tokens[open].Value != "[" && tokens[open].Value != "{") {
+		return "", false
+	}
+	closeIdx := closesAt(tokens, open)
+	if closeIdx < 0 {
+		return "", false
+	}
+	ts := significantTokens(tokens[open+1 : closeIdx])
+	if len(ts) != 1 {
+		return "", false
+	}
+	switch ts[0].Type {
+	case ppi.TokenNumber, ppi.TokenQuote:
+	case ppi.TokenSymbol:
+		if !strings.HasPrefix(ts[0].Value, "$") {
+			return "", false
+		}
+	case ppi.TokenWord:
+		if tokens[open].Value != "{" {
+			return "", false
+		}
+	default:
+		return "", false
+	}
+	var b strings.Builder
+	for _, tok := range tokens[open : closeIdx+1] {
+		b.WriteString(tok.Value)
+	}
+	subscript := b.String()
+	name := tokens[idx].Value[1:]
+	return "Scalar value @" + name + subscript + " better written as $" + name + subscript, true
+}
+
+// bitwiseNextToComparison reports whether an operand of the bitwise
+// operator at tokens[idx] is an unparenthesized comparison: a comparison
+// operator at the same nesting depth before the next operator of lower
+// precedence on either side.
+func bitwiseNextToComparison(tokens []ppi.Token, idx int) bool {
+	for _, step := range []int{-1, 1} {
+		depth := 0
+		for i := idx + step; i >= 0 && i < len(tokens); i += step {
+			tok := tokens[i]
+			if tok.Type == ppi.TokenWord && comparisonOps[tok.Value] && depth == 0 {
+				return true
+			}
+			if tok.Type != ppi.TokenOperator {
+				if tok.Type == ppi.TokenWord && depth == 0 && (tok.Value == "and" || tok.Value == "or" || tok.Value == "not" || tok.Value == "xor") {
+					break
+				}
+				continue
+			}
+			switch tok.Value {
+			case "(", "[", "{":
+				if step > 0 {
+					depth++
+				} else {
+					depth--
+				}
+			case ")", "]", "}":
+				if step > 0 {
+					depth--
+				} else {
+					depth++
+				}
+			}
+			if depth < 0 {
+				break
+			}
+			if depth > 0 {
+				continue
+			}
+			if comparisonOps[tok.Value] {
+				return true
+			}
+			if isLowerThanBitwise(tok.Value) {
+				break
+			}
+		}
+	}
+	return false
+}
+
+// isLowerThanBitwise reports whether op binds looser than the bitwise
+// operators and so ends their operand.
+func isLowerThanBitwise(op string) bool {
+	switch op {
+	case "&&", "||", "//", "..", "...", "?", ":", ",", "=>", ";", "&", "|", "^",
+		"=", "+=", "-=", "*=", "/=", ".=", "%=", "x=", "&=", "|=", "^=", "<<=", ">>=", "&&=", "||=", "//=", "**=":
+		return true
+	}
+	return false
+}
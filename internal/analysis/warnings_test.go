@@ -0,0 +1,99 @@
+package analysis
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+func warningLines(src string) []string {
+	doc := ppi.NewDocument(src)
+	doc.ParseWithDiagnostics()
+	var out []string
+	for _, d := range WarningDiagnostics(doc) {
+		line := strings.Count(src[:d.Offset], "\n") + 1
+		out = append(out, strconv.Itoa(line)+": "+d.Message)
+	}
+	return out
+}
+
+func TestWarningDiagnostics(t *testing.T) {
+	src := `use strict;
+use warnings;
+my $x = 1;
+my $x = 2;
+"done";
+42;
+1;
+if ($x = 1) { }
+if ($x == 1) { }
+my @list = (1, 2);
+my %h;
+print @list[0], @h{'a'}, @list[0, 1], @h{qw(a b)};
+print $x & 1 == 0;
+print(($x & 1) == 0);
+print $x == 1 | 2;
+sub add ($n, $m) {
+    my $n = 3;
+    my ($m, $k);
+    "value";
+}
+{
+    no warnings 'shadow';
+    my $x = 3;
+    my $x = 4;
+    no warnings 'syntax';
+    if ($x = 2) { }
+    print $x & 1 == 0;
+}
+{
+    no warnings;
+    7;
+}
+1;
+`
+	want := []string{
+		`4: "my" variable $x masks earlier declaration in same scope`,
+		`5: Useless use of a constant ("done") in void context`,
+		`6: Useless use of a constant (42) in void context`,
+		`17: "my" variable $n masks earlier declaration in same scope`,
+		`18: "my" variable $m masks earlier declaration in same scope`,
+		`8: Found = in conditional, should be ==`,
+		`12: Scalar value @list[0] better written as $list[0]`,
+		`12: Scalar value @h{'a'} better written as $h{'a'}`,
+		`13: Possible precedence problem on bitwise & operator`,
+		`15: Possible precedence problem on bitwise | operator`,
+	}
+	if got := warningLines(src); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestWarningDiagnosticsMissingWarnings(t *testing.T) {
+	for _, tc := range []struct {
+		src  string
+		want []string
+	}{
+		{"use strict;\nmy $x;\n", []string{"1: use strict without use warnings"}},
+		{"use strict;\nuse warnings;\n", nil},
+		{"#!/usr/bin/perl -w\nuse strict;\n", nil},
+		{"use strict;\nuse Moo;\n", nil},
+		{"use strict;\nuse Test2::V0;\n", nil},
+		{"use strict;\nuse Dancer2;\n", nil},
+		{"use strict;\nuse Test::More;\n", []string{"1: use strict without use warnings"}},
+		{"use v5.36;\nuse strict;\n", nil},
+		{"use strict;\n{\n    use warnings 'void';\n}\n", nil},
+		{"use v5.12;\n42;\n1;\n", nil},
+		{"use warnings;\n42;\n__END__\nfoo\n", nil},
+		{"use warnings;\n\"true\";\n__DATA__\nfoo\n", nil},
+		{"use warnings;\n42;\n\n=head1 NAME\n\nFoo - bar\n\n=cut\n", nil},
+		{"use warnings;\n42;\n1;\n__END__\n", []string{"2: Useless use of a constant (42) in void context"}},
+	} {
+		if got := warningLines(tc.src); !reflect.DeepEqual(got, tc.want) {
+			t.Fatalf("%q: expected %v, got %v", tc.src, tc.want, got)
+		}
+	}
+}
@@ -9,66 +9,328 @@ import (
 )
 
 type Definition struct {
-	Name  string
-	Kind  SymbolKind
-	File  string
-	Start int
-	End   int
+	Name string
+	Kind SymbolKind
+	// Package is the package a sub is defined in, "" for main.
+	Package string
+	File    string
+	Start   int
+	End     int
+	// Library is set for definitions found under an @INC root.
+	Library bool
+	// Sig is the :SIG(...) annotation of a sub, without the :SIG( ) wrapper.
+	Sig string
+	// Stub is set for definitions read from a signature stub file.
+	Stub bool
+}
+
+// fullName returns the package-qualified name of a sub, or the name of a
+// package.
+func (d Definition) fullName() string {
+	if d.Package == "" {
+		return d.Name
+	}
+	return d.Package + "::" + d.Name
 }
 
 type WorkspaceIndex struct {
 	Packages   map[string][]Definition
 	SubsByName map[string][]Definition
 	SubsByFull map[string][]Definition
-	Files      int
+	// Parents holds the declared parent classes of each package, and C3
+	// the packages that use the C3 method resolution order.
+	Parents map[string][]string
+	C3      map[string]bool
+	// TypeAliases holds the :TYPE declarations by package-qualified name.
+	TypeAliases map[string]TypeAlias
+	Files       int
+	// Truncated is set when IndexOptions.MaxFiles stopped the walk early.
+	Truncated bool
+
+	modules *moduleCache
+	stubs   *WorkspaceIndex
 }
 
+// IndexOptions limits what BuildWorkspaceIndexWithOptions reads.
+type IndexOptions struct {
+	// INCRoots are library roots such as @INC. They are walked after the
+	// workspace roots, and their definitions are hidden whenever the same
+	// name is also defined under a workspace root.
+	INCRoots []string
+	// LazyRoots are library roots that are not walked. A module under them
+	// is parsed only when it is first looked up by package or qualified sub name.
+	LazyRoots []string
+	// CacheSize bounds the number of lazily parsed modules kept in memory.
+	CacheSize int
+	// MaxFileSize skips files larger than this many bytes. Zero means no limit.
+	MaxFileSize int64
+	// MaxFiles stops indexing after this many files. Zero means no limit.
+	MaxFiles int
+	// Exclude holds gitignore-style patterns of paths to skip, relative to
+	// ExcludeBase (or to each walked root when ExcludeBase is empty).
+	Exclude     []string
+	ExcludeBase string
+	// SigRoots are directories of signature stub files (see StubExt).
+	SigRoots []string
+}
+
+const defaultModuleCacheSize = 256
+
 func BuildWorkspaceIndex(roots []string) (*WorkspaceIndex, error) {
-	index := &WorkspaceIndex{
-		Packages:   make(map[string][]Definition),
-		SubsByName: make(map[string][]Definition),
-		SubsByFull: make(map[string][]Definition),
+	return BuildWorkspaceIndexWithOptions(roots, IndexOptions{})
+}
+
+func BuildWorkspaceIndexWithOptions(roots []string, opts IndexOptions) (*WorkspaceIndex, error) {
+	index := newWorkspaceIndex()
+	if len(opts.LazyRoots) > 0 {
+		size := opts.CacheSize
+		if size <= 0 {
+			size = defaultModuleCacheSize
+		}
+		index.modules = newModuleCache(opts.LazyRoots, size, opts.MaxFileSize)
 	}
-	for _, root := range roots {
-		if root == "" {
-			continue
+	if err := index.indexStubs(opts.SigRoots); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	walk := func(root string, library bool) error {
+		exclude := &ignoreMatcher{}
+		base := opts.ExcludeBase
+		if base == "" {
+			base = root
 		}
-		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		exclude.add(base, opts.Exclude)
+		gitignore := &ignoreMatcher{}
+		gitignore.addAncestors(root)
+		return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
 			if d.IsDir() {
-				if strings.HasPrefix(d.Name(), ".") && d.Name() != "." {
+				if path == root {
+					gitignore.addFile(path)
+					return nil
+				}
+				if strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				if exclude.match(path, true) || gitignore.match(path, true) {
 					return filepath.SkipDir
 				}
+				gitignore.addFile(path)
 				return nil
 			}
 			if filepath.Ext(path) != ".pm" {
 				return nil
 			}
-			if err := indexFile(path, index); err != nil {
+			if exclude.match(path, false) || gitignore.match(path, false) {
+				return nil
+			}
+			if _, ok := seen[path]; ok {
+				return nil
+			}
+			seen[path] = struct{}{}
+			if opts.MaxFiles > 0 && index.Files >= opts.MaxFiles {
+				index.Truncated = true
+				return filepath.SkipAll
+			}
+			if opts.MaxFileSize > 0 {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				if info.Size() > opts.MaxFileSize {
+					return nil
+				}
+			}
+			if err := indexFileWithOptions(path, index, library); err != nil {
 				return err
 			}
 			index.Files++
 			return nil
 		})
-		if err != nil {
+	}
+	for _, root := range roots {
+		if root == "" {
+			continue
+		}
+		if err := walk(root, false); err != nil {
+			return nil, err
+		}
+		if index.Truncated {
+			return index, nil
+		}
+	}
+	for _, root := range opts.INCRoots {
+		if root == "" {
+			continue
+		}
+		if err := walk(root, true); err != nil {
 			return nil, err
 		}
+		if index.Truncated {
+			return index, nil
+		}
 	}
 	return index, nil
 }
 
+func newWorkspaceIndex() *WorkspaceIndex {
+	return &WorkspaceIndex{
+		Packages:    make(map[string][]Definition),
+		SubsByName:  make(map[string][]Definition),
+		SubsByFull:  make(map[string][]Definition),
+		Parents:     make(map[string][]string),
+		C3:          make(map[string]bool),
+		TypeAliases: make(map[string]TypeAlias),
+	}
+}
+
 func (w *WorkspaceIndex) FindPackages(name string, exclude string) []Definition {
-	return filterDefinitions(w.Packages[name], exclude)
+	defs := w.Packages[name]
+	if len(defs) == 0 {
+		if mod := w.modules.load(name); mod != nil {
+			defs = mod.Packages[name]
+		}
+	}
+	return filterDefinitions(withStubs(preferWorkspace(defs), w.stubPackages(name)), exclude)
 }
 
 func (w *WorkspaceIndex) FindSubs(name string, exclude string) []Definition {
-	return filterDefinitions(w.SubsByName[name], exclude)
+	return filterDefinitions(withStubs(preferWorkspace(w.SubsByName[name]), w.stubSubs(name)), exclude)
 }
 
 func (w *WorkspaceIndex) FindSubsFull(name string, exclude string) []Definition {
-	return filterDefinitions(w.SubsByFull[name], exclude)
+	defs := w.SubsByFull[name]
+	if len(defs) == 0 {
+		if pkg, _, ok := splitFullName(name); ok {
+			if mod := w.modules.load(pkg); mod != nil {
+				defs = mod.SubsByFull[name]
+			}
+		}
+	}
+	return filterDefinitions(withStubs(preferWorkspace(defs), w.stubSubsFull(name)), exclude)
+}
+
+// FindTypeAlias returns the :TYPE alias with the given package-qualified
+// name.
+func (w *WorkspaceIndex) FindTypeAlias(fullName string) (TypeAlias, bool) {
+	if alias, ok := w.TypeAliases[fullName]; ok {
+		return alias, true
+	}
+	pkg, _, ok := splitFullName(fullName)
+	if !ok {
+		return TypeAlias{}, false
+	}
+	if len(w.Packages[pkg]) == 0 {
+		if mod := w.modules.load(pkg); mod != nil {
+			if alias, ok := mod.TypeAliases[fullName]; ok {
+				return alias, true
+			}
+		}
+	}
+	if w.stubs != nil {
+		alias, ok := w.stubs.TypeAliases[fullName]
+		return alias, ok
+	}
+	return TypeAlias{}, false
+}
+
+// PackageParents returns the direct parent classes of pkg.
+func (w *WorkspaceIndex) PackageParents(pkg string) []string {
+	var parents []string
+	if p, ok := w.Parents[pkg]; ok {
+		parents = p
+	} else if len(w.Packages[pkg]) == 0 {
+		if mod := w.modules.load(pkg); mod != nil {
+			parents = mod.Parents[pkg]
+		}
+	}
+	if len(parents) == 0 && w.stubs != nil {
+		parents = w.stubs.Parents[pkg]
+	}
+	return parents
+}
+
+// UsesC3 reports whether pkg declares "use mro 'c3'".
+func (w *WorkspaceIndex) UsesC3(pkg string) bool {
+	if w.C3[pkg] {
+		return true
+	}
+	if len(w.Packages[pkg]) > 0 {
+		return false
+	}
+	if mod := w.modules.load(pkg); mod != nil {
+		return mod.C3[pkg]
+	}
+	return w.stubs != nil && w.stubs.C3[pkg]
+}
+
+// MRO returns the method resolution order of pkg, starting with pkg itself.
+func (w *WorkspaceIndex) MRO(pkg string) []string {
+	return Linearize(pkg, w.PackageParents, w.UsesC3(pkg))
+}
+
+// PackageSubs returns the subs defined directly in pkg, keyed by sub name.
+func (w *WorkspaceIndex) PackageSubs(pkg string) map[string][]Definition {
+	out := make(map[string][]Definition)
+	collect := func(subs map[string][]Definition) {
+		prefix := pkg + "::"
+		for full, defs := range subs {
+			name, ok := strings.CutPrefix(full, prefix)
+			if !ok || name == "" || strings.Contains(name, "::") {
+				continue
+			}
+			out[name] = append(out[name], defs...)
+		}
+	}
+	collect(w.SubsByFull)
+	if len(out) == 0 {
+		if mod := w.modules.load(pkg); mod != nil {
+			collect(mod.SubsByFull)
+		}
+	}
+	for name, defs := range out {
+		out[name] = preferWorkspace(defs)
+	}
+	if w.stubs != nil {
+		for name, stubs := range w.stubs.PackageSubs(pkg) {
+			out[name] = withStubs(out[name], stubs)
+		}
+	}
+	return out
+}
+
+// preferWorkspace drops library definitions when a workspace definition
+// of the same name exists.
+func preferWorkspace(defs []Definition) []Definition {
+	hasWorkspace := false
+	hasLibrary := false
+	for _, def := range defs {
+		if def.Library {
+			hasLibrary = true
+		} else {
+			hasWorkspace = true
+		}
+	}
+	if !hasWorkspace || !hasLibrary {
+		return defs
+	}
+	out := make([]Definition, 0, len(defs))
+	for _, def := range defs {
+		if !def.Library {
+			out = append(out, def)
+		}
+	}
+	return out
+}
+
+func splitFullName(name string) (string, string, bool) {
+	idx := strings.LastIndex(name, "::")
+	if idx <= 0 || idx+2 >= len(name) {
+		return "", "", false
+	}
+	return name[:idx], name[idx+2:], true
 }
 
 func filterDefinitions(defs []Definition, exclude string) []Definition {
@@ -89,6 +351,10 @@ func filterDefinitions(defs []Definition, exclude string) []Definition {
 }
 
 func indexFile(path string, w *WorkspaceIndex) error {
+	return indexFileWithOptions(path, w, false)
+}
+
+func indexFileWithOptions(path string, w *WorkspaceIndex, library bool) error {
 	src, err := os.ReadFile(path)
 	if err != nil {
 		return err
@@ -96,24 +362,51 @@ func indexFile(path string, w *WorkspaceIndex) error {
 	doc := ppi.NewDocument(string(src))
 	doc.ParseWithDiagnostics()
 	defs := collectFileDefinitions(doc)
+	packageAt := PackageLookup(doc)
 	for _, def := range defs {
 		def.File = path
+		def.Library = library
+		def.Stub = filepath.Ext(path) == StubExt
 		switch def.Kind {
 		case SymbolPackage:
 			w.Packages[def.Name] = append(w.Packages[def.Name], def)
 		case SymbolSub:
-			pkg := doc.PackageAt(def.Start)
-			full := def.Name
-			if pkg != "" {
-				full = pkg + "::" + def.Name
-			}
+			def.Package = packageAt(def.Start)
+			full := def.fullName()
 			w.SubsByName[def.Name] = append(w.SubsByName[def.Name], def)
 			w.SubsByFull[full] = append(w.SubsByFull[full], def)
 		}
 	}
+	for _, alias := range CollectTypeAliases(doc) {
+		if _, ok := w.TypeAliases[alias.FullName()]; !ok {
+			w.TypeAliases[alias.FullName()] = alias
+		}
+	}
+	inh := CollectInheritance(doc)
+	for pkg, parents := range inh.Parents {
+		if library && w.hasWorkspacePackage(pkg) {
+			continue
+		}
+		addParents(w.Parents, pkg, parents, false)
+	}
+	for pkg := range inh.C3 {
+		if library && w.hasWorkspacePackage(pkg) {
+			continue
+		}
+		w.C3[pkg] = true
+	}
 	return nil
 }
 
+func (w *WorkspaceIndex) hasWorkspacePackage(pkg string) bool {
+	for _, def := range w.Packages[pkg] {
+		if !def.Library {
+			return true
+		}
+	}
+	return false
+}
+
 func collectFileDefinitions(doc *ppi.Document) []Definition {
 	if doc == nil || doc.Root == nil {
 		return nil
@@ -129,12 +422,19 @@ func collectFileDefinitions(doc *ppi.Document) []Definition {
 			if !ok || n.Name == "" {
 				return
 			}
-			defs = append(defs, Definition{
+			def := Definition{
 				Name:  n.Name,
 				Kind:  SymbolSub,
 				Start: start,
 				End:   end,
-			})
+			}
+			if first, ok := nodeFirstNonTriviaStart(n); ok {
+				def.Sig = sigCommentBeforeOffset(doc.Source, first)
+			}
+			if def.Sig == "" {
+				def.Sig = sigAttribute(n)
+			}
+			defs = append(defs, def)
 		case "statement::package":
 			start, end, ok := nodeNameRange(n)
 			if !ok || n.Name == "" {
@@ -148,9 +448,49 @@ func collectFileDefinitions(doc *ppi.Document) []Definition {
 			})
 		}
 	})
+	for _, class := range CollectClasses(doc) {
+		defs = append(defs, Definition{
+			Name:  class.Name,
+			Kind:  SymbolPackage,
+			Start: class.Start,
+			End:   class.End,
+		})
+		for _, method := range class.Methods {
+			defs = append(defs, Definition{
+				Name:  method.Name,
+				Kind:  SymbolSub,
+				Start: method.Start,
+				End:   method.End,
+				Sig:   sigCommentBeforeOffset(doc.Source, method.BodyStart),
+			})
+		}
+	}
+	for _, acc := range CollectAccessors(doc) {
+		defs = append(defs, Definition{
+			Name:  acc.Name,
+			Kind:  SymbolSub,
+			Start: acc.Start,
+			End:   acc.End,
+			Sig:   acc.Sig,
+		})
+	}
 	return defs
 }
 
+// sigAttribute returns the signature of a sub declared with a :SIG(...)
+// attribute, as stub files do.
+func sigAttribute(n *ppi.Node) string {
+	for _, tok := range n.Tokens {
+		if tok.Type != ppi.TokenAttribute {
+			continue
+		}
+		if body, ok := strings.CutPrefix(tok.Value, "SIG("); ok && strings.HasSuffix(body, ")") {
+			return strings.TrimSpace(strings.TrimSuffix(body, ")"))
+		}
+	}
+	return ""
+}
+
 func nodeNameRange(n *ppi.Node) (int, int, bool) {
 	if n == nil || n.Name == "" {
 		return 0, 0, false
@@ -0,0 +1,213 @@
+package analysis
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorkspaceIndexLazyRoots(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	inc := filepath.Join(tmp, "inc")
+	writeTestFile(t, filepath.Join(lib, "App.pm"), "package App;\nsub run {}\n1;\n")
+	writeTestFile(t, filepath.Join(inc, "Foo", "Bar.pm"), "package Foo::Bar;\nsub baz {}\n1;\n")
+	writeTestFile(t, filepath.Join(inc, "Foo", "Qux.pm"), "package Foo::Qux;\nsub quux {}\n1;\n")
+
+	index, err := BuildWorkspaceIndexWithOptions([]string{lib}, IndexOptions{LazyRoots: []string{inc}, CacheSize: 1})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndexWithOptions: %v", err)
+	}
+	if index.Files != 1 {
+		t.Fatalf("expected only workspace files to be indexed eagerly, got %d", index.Files)
+	}
+	if len(index.FindPackages("Foo::Bar", "")) != 1 {
+		t.Fatalf("expected Foo::Bar to be loaded lazily")
+	}
+	if len(index.FindSubsFull("Foo::Qux::quux", "")) != 1 {
+		t.Fatalf("expected Foo::Qux::quux to be loaded lazily")
+	}
+	if _, ok := index.PackageSubs("Foo::Bar")["baz"]; !ok {
+		t.Fatalf("expected baz in Foo::Bar subs")
+	}
+	if n := index.modules.len(); n != 1 {
+		t.Fatalf("expected cache to hold 1 module, got %d", n)
+	}
+	if len(index.FindPackages("No::Such", "")) != 0 {
+		t.Fatalf("did not expect unknown package")
+	}
+	if _, ok := index.modules.entries["Foo::Bar"]; !ok || index.modules.len() != 1 {
+		t.Fatalf("expected a missing module not to evict Foo::Bar")
+	}
+	if !index.modules.missing["No::Such"] {
+		t.Fatalf("expected No::Such to be remembered as missing")
+	}
+	if defs := index.FindPackages("Foo::Qux", ""); len(defs) != 1 || !defs[0].Library {
+		t.Fatalf("expected lazily loaded definitions to be library ones, got %+v", defs)
+	}
+}
+
+func TestWorkspaceIndexLimits(t *testing.T) {
+	tmp := t.TempDir()
+	writeTestFile(t, filepath.Join(tmp, "A.pm"), "package A;\n1;\n")
+	writeTestFile(t, filepath.Join(tmp, "B.pm"), "package B;\n1;\n")
+	writeTestFile(t, filepath.Join(tmp, "Big.pm"), "package Big;\n"+strings.Repeat("# generated\n", 100)+"1;\n")
+
+	index, err := BuildWorkspaceIndexWithOptions([]string{tmp}, IndexOptions{MaxFileSize: 100})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndexWithOptions: %v", err)
+	}
+	if index.Files != 2 || len(index.Packages["Big"]) != 0 {
+		t.Fatalf("expected Big.pm to be skipped, got %d files", index.Files)
+	}
+
+	index, err = BuildWorkspaceIndexWithOptions([]string{tmp}, IndexOptions{MaxFiles: 1})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndexWithOptions: %v", err)
+	}
+	if index.Files != 1 || !index.Truncated {
+		t.Fatalf("expected 1 file and truncation, got %d files truncated=%v", index.Files, index.Truncated)
+	}
+}
+
+func TestWorkspaceIndexIgnore(t *testing.T) {
+	tmp := t.TempDir()
+	if err := os.Mkdir(filepath.Join(tmp, ".git"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	writeTestFile(t, filepath.Join(tmp, ".gitignore"), "gen/\n*.bak.pm\n!Keep.bak.pm\n")
+	lib := filepath.Join(tmp, "lib")
+	writeTestFile(t, filepath.Join(lib, "App.pm"), "package App;\n1;\n")
+	writeTestFile(t, filepath.Join(lib, "Old.bak.pm"), "package Old;\n1;\n")
+	writeTestFile(t, filepath.Join(lib, "Keep.bak.pm"), "package Keep;\n1;\n")
+	writeTestFile(t, filepath.Join(lib, "gen", "Gen.pm"), "package Gen;\n1;\n")
+	writeTestFile(t, filepath.Join(lib, "sub", ".gitignore"), "Local.pm\n")
+	writeTestFile(t, filepath.Join(lib, "sub", "Local.pm"), "package Local;\n1;\n")
+	writeTestFile(t, filepath.Join(lib, "blib", "App.pm"), "package App;\n1;\n")
+
+	index, err := BuildWorkspaceIndexWithOptions([]string{lib}, IndexOptions{Exclude: []string{"blib/"}, ExcludeBase: lib})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndexWithOptions: %v", err)
+	}
+	for _, name := range []string{"Old", "Gen", "Local"} {
+		if len(index.Packages[name]) != 0 {
+			t.Fatalf("expected %s to be ignored", name)
+		}
+	}
+	if len(index.Packages["Keep"]) != 1 {
+		t.Fatalf("expected negated pattern to keep Keep")
+	}
+	if defs := index.Packages["App"]; len(defs) != 1 {
+		t.Fatalf("expected blib/ to be excluded, got %d App definitions", len(defs))
+	}
+}
+
+func TestWorkspaceIndexPrefersWorkspace(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	inc := filepath.Join(tmp, "inc")
+	writeTestFile(t, filepath.Join(lib, "Foo.pm"), "package Foo;\nsub run {}\n1;\n")
+	writeTestFile(t, filepath.Join(inc, "Foo.pm"), "package Foo;\nsub run {}\n1;\n")
+	writeTestFile(t, filepath.Join(inc, "Bar.pm"), "package Bar;\nsub run {}\n1;\n")
+
+	index, err := BuildWorkspaceIndexWithOptions([]string{lib}, IndexOptions{INCRoots: []string{inc, lib}})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndexWithOptions: %v", err)
+	}
+	if index.Files != 3 {
+		t.Fatalf("expected overlapping roots to be indexed once, got %d files", index.Files)
+	}
+	defs := index.FindPackages("Foo", "")
+	if len(defs) != 1 || defs[0].Library || defs[0].File != filepath.Join(lib, "Foo.pm") {
+		t.Fatalf("expected workspace Foo, got %#v", defs)
+	}
+	if defs := index.FindSubsFull("Foo::run", ""); len(defs) != 1 || defs[0].Library {
+		t.Fatalf("expected workspace Foo::run, got %#v", defs)
+	}
+	if defs := index.FindPackages("Bar", ""); len(defs) != 1 || !defs[0].Library {
+		t.Fatalf("expected library Bar, got %#v", defs)
+	}
+}
+
+func writeTestFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestWorkspaceIndexSubSig(t *testing.T) {
+	tmp := t.TempDir()
+	writeTestFile(t, filepath.Join(tmp, "Util.pm"), "package My::Util;\n# :SIG(str -> My::Client)\nsub make_client {}\nsub plain {}\n1;\n")
+
+	index, err := BuildWorkspaceIndex([]string{tmp})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndex: %v", err)
+	}
+	defs := index.FindSubsFull("My::Util::make_client", "")
+	if len(defs) != 1 || defs[0].Sig != "str -> My::Client" {
+		t.Fatalf("expected make_client sig, got %#v", defs)
+	}
+	defs = index.FindSubsFull("My::Util::plain", "")
+	if len(defs) != 1 || defs[0].Sig != "" {
+		t.Fatalf("expected no sig for plain, got %#v", defs)
+	}
+}
+
+func TestWorkspaceIndexStubs(t *testing.T) {
+	tmp := t.TempDir()
+	inc := filepath.Join(tmp, "inc")
+	sigs := filepath.Join(tmp, "sigs")
+	writeTestFile(t, filepath.Join(inc, "DBI.pm"), "package DBI;\nsub connect {}\nsub trace {}\n1;\n")
+	writeTestFile(t, filepath.Join(inc, "Other.pm"), "package Other;\nsub connect {}\n1;\n")
+	writeTestFile(t, filepath.Join(sigs, "DBI.psig"), "package DBI;\nsub connect :SIG((str, str, str?, str?) -> DBI::db);\n")
+	writeTestFile(t, filepath.Join(sigs, "LWP", "UserAgent.psig"), "package LWP::UserAgent;\nuse parent 'LWP::MemberMixin';\n# :SIG((LWP::UserAgent, str) -> HTTP::Response)\nsub get;\n")
+
+	index, err := BuildWorkspaceIndexWithOptions(nil, IndexOptions{INCRoots: []string{inc}, SigRoots: []string{sigs}})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndexWithOptions: %v", err)
+	}
+	defs := index.FindSubsFull("DBI::connect", "")
+	if len(defs) != 1 || defs[0].Stub || defs[0].Sig != "(str, str, str?, str?) -> DBI::db" {
+		t.Fatalf("expected DBI.pm connect with stub sig, got %#v", defs)
+	}
+	for _, def := range index.FindSubs("connect", "") {
+		if want := map[string]string{"DBI": "(str, str, str?, str?) -> DBI::db", "Other": ""}[def.Package]; def.Sig != want {
+			t.Fatalf("expected %s::connect to have sig %q, got %#v", def.Package, want, def)
+		}
+	}
+	if defs := index.FindPackages("LWP::UserAgent", ""); len(defs) != 1 || !defs[0].Stub {
+		t.Fatalf("expected stub package, got %#v", defs)
+	}
+	subs := index.PackageSubs("LWP::UserAgent")
+	if len(subs["get"]) != 1 || subs["get"][0].Sig != "(LWP::UserAgent, str) -> HTTP::Response" {
+		t.Fatalf("expected get from stub, got %#v", subs)
+	}
+	if subs := index.PackageSubs("DBI"); len(subs["trace"]) != 1 || subs["connect"][0].Sig == "" {
+		t.Fatalf("expected merged DBI subs, got %#v", subs)
+	}
+	if parents := index.PackageParents("LWP::UserAgent"); len(parents) != 1 || parents[0] != "LWP::MemberMixin" {
+		t.Fatalf("expected stub parents, got %v", parents)
+	}
+}
+
+func TestWorkspaceIndexTypeAliases(t *testing.T) {
+	tmp := t.TempDir()
+	writeTestFile(t, filepath.Join(tmp, "Types.pm"), "package My::Types;\n# :TYPE(Port = int)\n1;\n")
+
+	index, err := BuildWorkspaceIndex([]string{tmp})
+	if err != nil {
+		t.Fatalf("BuildWorkspaceIndex: %v", err)
+	}
+	alias, ok := index.FindTypeAlias("My::Types::Port")
+	if !ok || alias.Sig != "int" || alias.Package != "My::Types" {
+		t.Fatalf("expected Port alias, got %#v %v", alias, ok)
+	}
+	if _, ok := index.FindTypeAlias("main::Port"); ok {
+		t.Fatalf("did not expect main::Port")
+	}
+}
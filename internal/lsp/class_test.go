@@ -0,0 +1,97 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestClassFeature(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	writeFile(t, filepath.Join(lib, "Shape.pm"), "use v5.38;\nuse experimental 'class';\nclass Shape {\n    # :SIG(any -> str)\n    method kind { return 'shape' }\n}\n1;\n")
+	index, err := analysis.BuildWorkspaceIndex([]string{lib})
+	if err != nil {
+		t.Fatalf("workspace index: %v", err)
+	}
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	s.folders = []*workspaceFolder{{root: tmp, libRoots: []string{lib}, index: index}}
+
+	src := "use v5.38;\nuse experimental 'class';\nclass Point :isa(Shape) {\n    field $label :param :reader;\n    field $count = 0;\n    ADJUST {\n        $count++;\n    }\n    # :SIG((any, int) -> void)\n    method move ($dx) {\n        $count += $dx;\n        $self->kind;\n    }\n}\npackage main;\n# :SIG(Point -> void)\nsub run ($p) {\n    $p->move(1);\n    $p->label;\n    $p->\n}\n1;\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "app.pl")))
+	s.docs.set(string(uri), src, nil)
+	position := func(offset int) protocol.TextDocumentPositionParams {
+		return protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     positionFromOffset(src, offset),
+		}
+	}
+
+	offset := strings.Index(src, "$p->\n") + len("$p->")
+	got, err := s.completion(nil, &protocol.CompletionParams{TextDocumentPositionParams: position(offset)})
+	if err != nil {
+		t.Fatalf("completion error: %v", err)
+	}
+	list := got.(protocol.CompletionList)
+	for _, name := range []string{"move", "label", "new", "kind"} {
+		if !hasCompletionLabel(list.Items, name) {
+			t.Fatalf("expected %s completion, got %v", name, completionLabels(list.Items))
+		}
+	}
+
+	for word, file := range map[string]string{"$p->move": "app.pl", "$p->label": "app.pl", "$self->kind": "lib/Shape.pm"} {
+		offset := strings.Index(src, word) + len(word) - 1
+		got, err := s.definition(nil, &protocol.DefinitionParams{TextDocumentPositionParams: position(offset)})
+		if err != nil {
+			t.Fatalf("definition error: %v", err)
+		}
+		locs, ok := got.([]protocol.Location)
+		if !ok || len(locs) != 1 {
+			t.Fatalf("%s: expected one location, got %#v", word, got)
+		}
+		if want := protocol.DocumentUri(fileURI(filepath.Join(tmp, file))); locs[0].URI != want {
+			t.Fatalf("%s: expected %s, got %s", word, want, locs[0].URI)
+		}
+	}
+
+	for word, want := range map[string][]string{
+		"$p->move":    {"method move", "type: (any, int) -> void", "package: Point"},
+		"$p->label":   {"field $label :reader", "type: any -> any", "package: Point"},
+		"$self->kind": {"method kind", "type: any -> str", "package: Shape"},
+	} {
+		offset := strings.Index(src, word) + len(word) - 1
+		hover, err := s.hover(nil, &protocol.HoverParams{TextDocumentPositionParams: position(offset)})
+		if err != nil || hover == nil {
+			t.Fatalf("%s: hover: %v %v", word, hover, err)
+		}
+		content := hover.Contents.(protocol.MarkupContent).Value
+		for _, w := range want {
+			if !strings.Contains(content, w) {
+				t.Fatalf("%s: expected %q in hover %q", word, w, content)
+			}
+		}
+	}
+
+	outline, err := s.documentSymbol(nil, &protocol.DocumentSymbolParams{TextDocument: protocol.TextDocumentIdentifier{URI: uri}})
+	if err != nil {
+		t.Fatalf("documentSymbol error: %v", err)
+	}
+	var names []string
+	var walk func(prefix string, syms []protocol.DocumentSymbol)
+	walk = func(prefix string, syms []protocol.DocumentSymbol) {
+		for _, sym := range syms {
+			names = append(names, prefix+sym.Name)
+			walk(prefix+sym.Name+"/", sym.Children)
+		}
+	}
+	walk("", outline.([]protocol.DocumentSymbol))
+	want := "Point Point/$label Point/$count Point/ADJUST Point/move main main/run"
+	if got := strings.Join(names, " "); got != want {
+		t.Fatalf("expected outline %q, got %q", want, got)
+	}
+}
@@ -171,7 +171,7 @@ func newServerWithModule(t *testing.T) (*Server, string) {
 	}
 	logger := slog.New(slog.NewTextHandler(io.Discard, &slog.HandlerOptions{}))
 	s := NewServer(logger, "test")
-	s.workspaceIndex = index
+	s.folders = []*workspaceFolder{{root: tmp, index: index}}
 	return s, tmp
 }
 
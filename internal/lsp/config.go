@@ -0,0 +1,155 @@
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// folderConfigFile is an optional per-folder settings file at the folder root.
+// Its values override the client settings for that folder only.
+const folderConfigFile = ".perl-language-server.json"
+
+// config holds user settings. Zero values mean "use the default".
+type config struct {
+	// LibDirs are library directories relative to the folder root.
+	LibDirs []string `json:"libDirs,omitempty"`
+	// Perl is the perl interpreter path used when no plenv/perlbrew perl is found.
+	Perl string `json:"perl,omitempty"`
+	// INCIndexing is "eager" (default) to index all of @INC up front, or
+	// "lazy" to parse @INC modules only when they are first looked up.
+	INCIndexing string `json:"incIndexing,omitempty"`
+	// LazyCacheSize bounds the number of lazily parsed modules kept in memory.
+	LazyCacheSize int `json:"lazyCacheSize,omitempty"`
+	// MaxIndexFileSize skips files larger than this many bytes.
+	MaxIndexFileSize int64 `json:"maxIndexFileSize,omitempty"`
+	// MaxIndexFiles stops indexing a folder after this many files.
+	MaxIndexFiles int `json:"maxIndexFiles,omitempty"`
+	// Exclude holds gitignore-style patterns, relative to the folder root,
+	// of paths the index skips in addition to .gitignore.
+	Exclude []string `json:"exclude,omitempty"`
+	// TypeCheck is the severity of :SIG argument type mismatches:
+	// "error", "warning" (default), "information", "hint" or "off".
+	TypeCheck string `json:"typeCheck,omitempty"`
+	// SigPaths are directories, relative to the folder root, of .psig
+	// signature stub files for modules without :SIG annotations.
+	SigPaths []string `json:"sigPaths,omitempty"`
+}
+
+// parseConfig decodes client settings (initializationOptions or
+// workspace/didChangeConfiguration). Settings may be nested under the
+// server name, as editors usually send them per section.
+func parseConfig(settings any) (config, error) {
+	var cfg config
+	if settings == nil {
+		return cfg, nil
+	}
+	if m, ok := settings.(map[string]any); ok {
+		if section, ok := m[lsName]; ok {
+			settings = section
+		}
+	}
+	b, err := json.Marshal(settings)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+func loadFolderConfig(root string) (config, error) {
+	var cfg config
+	if root == "" {
+		return cfg, nil
+	}
+	b, err := os.ReadFile(filepath.Join(root, folderConfigFile))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+	if err := json.Unmarshal(b, &cfg); err != nil {
+		return config{}, err
+	}
+	return cfg, nil
+}
+
+// merge returns c with every non-zero field of o applied on top.
+func (c config) merge(o config) config {
+	if len(o.LibDirs) > 0 {
+		c.LibDirs = append([]string(nil), o.LibDirs...)
+	}
+	if o.Perl != "" {
+		c.Perl = o.Perl
+	}
+	if o.INCIndexing != "" {
+		c.INCIndexing = o.INCIndexing
+	}
+	if o.LazyCacheSize > 0 {
+		c.LazyCacheSize = o.LazyCacheSize
+	}
+	if o.MaxIndexFileSize > 0 {
+		c.MaxIndexFileSize = o.MaxIndexFileSize
+	}
+	if o.MaxIndexFiles > 0 {
+		c.MaxIndexFiles = o.MaxIndexFiles
+	}
+	if len(o.Exclude) > 0 {
+		c.Exclude = append([]string(nil), o.Exclude...)
+	}
+	if o.TypeCheck != "" {
+		c.TypeCheck = o.TypeCheck
+	}
+	if len(o.SigPaths) > 0 {
+		c.SigPaths = append([]string(nil), o.SigPaths...)
+	}
+	return c
+}
+
+func (c config) lazyINC() bool {
+	return c.INCIndexing == "lazy"
+}
+
+func (c config) libDirs() []string {
+	if len(c.LibDirs) > 0 {
+		return c.LibDirs
+	}
+	return []string{"lib", filepath.Join("local", "lib", "perl5")}
+}
+
+func (c config) exclude() []string {
+	if len(c.Exclude) > 0 {
+		return c.Exclude
+	}
+	return []string{"blib/", "_build/", "fatlib/"}
+}
+
+func (c config) sigPaths() []string {
+	if len(c.SigPaths) > 0 {
+		return c.SigPaths
+	}
+	return []string{"sigs"}
+}
+
+// typeCheckSeverity returns the severity of argument type diagnostics, or
+// false when type checks are turned off.
+func (c config) typeCheckSeverity() (protocol.DiagnosticSeverity, bool) {
+	switch c.TypeCheck {
+	case "off":
+		return 0, false
+	case "error":
+		return protocol.DiagnosticSeverityError, true
+	case "information":
+		return protocol.DiagnosticSeverityInformation, true
+	case "hint":
+		return protocol.DiagnosticSeverityHint, true
+	default:
+		return protocol.DiagnosticSeverityWarning, true
+	}
+}
@@ -120,7 +120,9 @@ func parseFile(t *testing.T, path string) *ppi.Document {
 func newTestServer() *Server {
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	srv := NewServer(logger, "test")
-	srv.workspaceRoots = []string{filepath.Join("testdata", "exports", "lib")}
-	srv.incRoots = []string{filepath.Join(string(filepath.Separator), "nonexistent")}
+	srv.folders = []*workspaceFolder{{
+		libRoots: []string{filepath.Join("testdata", "exports", "lib")},
+		incRoots: []string{filepath.Join(string(filepath.Separator), "nonexistent")},
+	}}
 	return srv
 }
@@ -0,0 +1,101 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestImportedSubSig(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	writeFile(t, filepath.Join(lib, "My", "Util.pm"), "package My::Util;\n# :SIG(str -> My::Client)\nsub make_client {}\n1;\n")
+	index, err := analysis.BuildWorkspaceIndex([]string{lib})
+	if err != nil {
+		t.Fatalf("workspace index: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	s.folders = []*workspaceFolder{{root: tmp, libRoots: []string{lib}, index: index}}
+
+	src := "use My::Util qw(make_client);\nmy $c = make_client(\"x\");\n$c;\nmake_client();\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "app.pl")))
+	doc := s.docs.set(string(uri), src, nil)
+
+	hoverAt := func(word string) string {
+		t.Helper()
+		hover, err := s.hover(nil, &protocol.HoverParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     positionFromOffset(src, strings.Index(src, word)+1),
+			},
+		})
+		if err != nil || hover == nil {
+			t.Fatalf("hover %s: %v %v", word, hover, err)
+		}
+		return hover.Contents.(protocol.MarkupContent).Value
+	}
+	if got := hoverAt("$c;"); got != "type: My::Client" {
+		t.Fatalf("unexpected $c hover: %q", got)
+	}
+	if got := hoverAt("make_client("); !strings.Contains(got, "type: str -> My::Client") {
+		t.Fatalf("unexpected make_client hover: %q", got)
+	}
+
+	diags := s.toSigCallDiagnostics(uri, src, doc.parsed)
+	if len(diags) != 1 || diags[0].Message != "call to make_client: expected 1 args, got 0" {
+		t.Fatalf("unexpected diagnostics: %#v", diags)
+	}
+}
+
+func TestStubSigs(t *testing.T) {
+	tmp := t.TempDir()
+	sigs := filepath.Join(tmp, "sigs")
+	writeFile(t, filepath.Join(sigs, "DBI.psig"), "package DBI;\nsub connect :SIG((str, str?, str?) -> DBI::db);\n")
+	writeFile(t, filepath.Join(sigs, "DBI", "db.psig"), "package DBI::db;\nsub prepare :SIG((DBI::db, str) -> DBI::st);\n")
+	writeFile(t, filepath.Join(sigs, "DBI", "st.psig"), "package DBI::st;\nsub execute :SIG((DBI::st, ...any) -> int);\n")
+	index, err := analysis.BuildWorkspaceIndexWithOptions(nil, analysis.IndexOptions{SigRoots: []string{sigs}})
+	if err != nil {
+		t.Fatalf("workspace index: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	s.folders = []*workspaceFolder{{root: tmp, index: index}}
+
+	src := "use DBI;\nmy $dbh = DBI->connect(\"dbi:SQLite:x\");\nmy $sth = $dbh->prepare(\"select 1\");\n$sth->\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "app.pl")))
+	s.docs.set(string(uri), src, nil)
+
+	offset := strings.Index(src, "$sth->") + len("$sth->")
+	got, err := s.completion(nil, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     positionFromOffset(src, offset),
+		},
+	})
+	if err != nil {
+		t.Fatalf("completion error: %v", err)
+	}
+	if list := got.(protocol.CompletionList); !hasCompletionLabel(list.Items, "execute") {
+		t.Fatalf("expected execute completion, got %v", completionLabels(list.Items))
+	}
+
+	loc, err := s.typeDefinition(nil, &protocol.TypeDefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     positionFromOffset(src, strings.Index(src, "$dbh->")+1),
+		},
+	})
+	if err != nil {
+		t.Fatalf("typeDefinition error: %v", err)
+	}
+	locs, ok := loc.([]protocol.Location)
+	if want := protocol.DocumentUri(fileURI(filepath.Join(sigs, "DBI", "db.psig"))); !ok || len(locs) != 1 || locs[0].URI != want {
+		t.Fatalf("expected %s, got %#v", want, loc)
+	}
+}
@@ -0,0 +1,35 @@
+package lsp
+
+import (
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// toHashKeyDiagnostics warns about keys read from a lexical hash that are
+// never written to it but are close to a key that is, which are most
+// likely typos. :SIG shapes may use type aliases from the workspace.
+func (s *Server) toHashKeyDiagnostics(uri protocol.DocumentUri, doc *documentData) []protocol.Diagnostic {
+	if doc == nil || doc.parsed == nil {
+		return nil
+	}
+	var opts analysis.SigCheckOptions
+	if index := s.workspaceIndexFor(uri); index != nil {
+		opts.Aliases = index.FindTypeAlias
+	}
+	typos := analysis.HashKeyTyposWithOptions(doc.parsed, opts)
+	if len(typos) == 0 {
+		return nil
+	}
+	out := make([]protocol.Diagnostic, 0, len(typos))
+	source := "perl-lsp"
+	sev := protocol.DiagnosticSeverityWarning
+	for _, typo := range typos {
+		out = append(out, protocol.Diagnostic{
+			Range:    offsetRange(doc.text, typo.Start, typo.End),
+			Severity: &sev,
+			Source:   &source,
+			Message:  `hash key "` + typo.Key + `" is never set in ` + typo.Var + `, did you mean "` + typo.Suggestion + `"?`,
+		})
+	}
+	return out
+}
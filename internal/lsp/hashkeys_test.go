@@ -0,0 +1,27 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestHashKeyDiagnostics(t *testing.T) {
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	src := "my %cfg = (host => 'localhost', port => 80);\nprint $cfg{hsot};\n"
+	uri := protocol.DocumentUri("file:///hashkeys.pl")
+	d := s.docs.set(string(uri), src, nil)
+	diags := s.toHashKeyDiagnostics(uri, d)
+	if len(diags) != 1 {
+		t.Fatalf("expected one diagnostic, got %+v", diags)
+	}
+	diag := diags[0]
+	if diag.Message != `hash key "hsot" is never set in %cfg, did you mean "host"?` || *diag.Severity != protocol.DiagnosticSeverityWarning {
+		t.Fatalf("unexpected diagnostic: %+v", diag)
+	}
+	if diag.Range.Start != (protocol.Position{Line: 1, Character: 11}) || diag.Range.End != (protocol.Position{Line: 1, Character: 15}) {
+		t.Fatalf("unexpected range: %+v", diag.Range)
+	}
+}
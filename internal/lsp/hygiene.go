@@ -0,0 +1,101 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// hygieneIssues returns the module hygiene problems of a document. Only
+// .pm files are checked as modules, and only those in a lib root of the
+// workspace have a package their path names.
+func (s *Server) hygieneIssues(uri protocol.DocumentUri, doc *documentData) []analysis.HygieneIssue {
+	if doc == nil || doc.parsed == nil {
+		return nil
+	}
+	var opts analysis.HygieneOptions
+	if path, ok := uriToPath(uri); ok && filepath.Ext(path) == ".pm" {
+		opts.Module = true
+		opts.Package = s.packageForModulePath(path)
+	}
+	return analysis.ModuleHygiene(doc.parsed, opts)
+}
+
+// packageForModulePath returns the package the path of a .pm file names
+// relative to the innermost lib root containing it, or "".
+func (s *Server) packageForModulePath(path string) string {
+	path = filepath.Clean(path)
+	var roots []string
+	s.workspaceMu.RLock()
+	if folder := s.folderForPathLocked(path); folder != nil {
+		roots = append(roots, folder.libRoots...)
+	}
+	s.workspaceMu.RUnlock()
+	if base := s.projectBaseForFile(path); base != "" {
+		roots = append(roots, filepath.Join(base, "lib"))
+	}
+	best := ""
+	for _, root := range roots {
+		root = filepath.Clean(root)
+		if strings.HasPrefix(path, root+string(os.PathSeparator)) && len(root) > len(best) {
+			best = root
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	rel := strings.TrimSuffix(path[len(best)+1:], ".pm")
+	return strings.ReplaceAll(rel, string(os.PathSeparator), "::")
+}
+
+func (s *Server) toHygieneDiagnostics(uri protocol.DocumentUri, doc *documentData) []protocol.Diagnostic {
+	issues := s.hygieneIssues(uri, doc)
+	if len(issues) == 0 {
+		return nil
+	}
+	out := make([]protocol.Diagnostic, 0, len(issues))
+	for _, issue := range issues {
+		out = append(out, hygieneDiagnostic(doc.text, issue))
+	}
+	return out
+}
+
+func hygieneDiagnostic(text string, issue analysis.HygieneIssue) protocol.Diagnostic {
+	source := "perl-lsp"
+	sev := protocol.DiagnosticSeverityWarning
+	return protocol.Diagnostic{
+		Range:    offsetRange(text, issue.Start, issue.End),
+		Severity: &sev,
+		Source:   &source,
+		Message:  issue.Message,
+	}
+}
+
+// hygieneCodeActions returns the fixes of the hygiene problems in rng.
+func (s *Server) hygieneCodeActions(uri protocol.DocumentUri, doc *documentData, rng protocol.Range) []protocol.CodeAction {
+	var out []protocol.CodeAction
+	kind := protocol.CodeActionKindQuickFix
+	for _, issue := range s.hygieneIssues(uri, doc) {
+		if len(issue.Fix) == 0 {
+			continue
+		}
+		diag := hygieneDiagnostic(doc.text, issue)
+		if comparePosition(diag.Range.End, rng.Start) < 0 || comparePosition(rng.End, diag.Range.Start) < 0 {
+			continue
+		}
+		edits := make([]protocol.TextEdit, 0, len(issue.Fix))
+		for _, fix := range issue.Fix {
+			edits = append(edits, protocol.TextEdit{Range: offsetRange(doc.text, fix.Start, fix.End), NewText: fix.NewText})
+		}
+		out = append(out, protocol.CodeAction{
+			Title:       issue.FixTitle,
+			Kind:        &kind,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Edit:        &protocol.WorkspaceEdit{Changes: map[protocol.DocumentUri][]protocol.TextEdit{uri: edits}},
+		})
+	}
+	return out
+}
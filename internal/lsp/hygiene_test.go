@@ -0,0 +1,50 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestHygieneDiagnosticsAndCodeActions(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	path := filepath.Join(lib, "My", "App.pm")
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	src := "package My::Ap;\nsub run { 1 }\n"
+	if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	s.folders = []*workspaceFolder{{root: tmp, libRoots: []string{lib}}}
+	uri := protocol.DocumentUri("file://" + path)
+	d := s.docs.set(string(uri), src, nil)
+
+	var got []string
+	for _, diag := range s.toHygieneDiagnostics(uri, d) {
+		got = append(got, diag.Message)
+	}
+	if len(got) != 2 || got[0] != "package My::Ap does not match the file name, expected My::App" || got[1] != "module does not return a true value, add 1; at its end" {
+		t.Fatalf("unexpected diagnostics: %v", got)
+	}
+
+	rng := protocol.Range{Start: protocol.Position{Line: 0}, End: protocol.Position{Line: 0, Character: 10}}
+	actions := s.hygieneCodeActions(uri, d, rng)
+	if len(actions) != 1 || actions[0].Title != "Rename package to My::App" {
+		t.Fatalf("unexpected actions: %+v", actions)
+	}
+	edit := actions[0].Edit.Changes[uri][0]
+	if edit.NewText != "My::App" || edit.Range.Start != (protocol.Position{Line: 0, Character: 8}) {
+		t.Fatalf("unexpected edit: %+v", edit)
+	}
+
+	if scriptURI := protocol.DocumentUri("file://" + filepath.Join(tmp, "script.pl")); len(s.hygieneIssues(scriptURI, s.docs.set(string(scriptURI), "print 1;\npackage Foo;\n", nil))) != 0 {
+		t.Fatalf("scripts are not checked as modules")
+	}
+}
@@ -0,0 +1,320 @@
+package lsp
+
+import (
+	"os"
+	"strings"
+	"sync"
+
+	ppi "github.com/skaji/go-ppi"
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// methodTarget is a sub found by walking a class's method resolution order.
+// It is either in the current document (local, accessor for a method
+// generated by "has" or :reader, or classMethod for a method of the class
+// feature) or in the workspace index.
+type methodTarget struct {
+	pkg         string
+	local       *ppi.Node
+	accessor    *analysis.Accessor
+	classMethod *analysis.ClassMethod
+	defs        []analysis.Definition
+}
+
+// docTables are the inheritance, classes, accessors, subs and packages of
+// a document. Every method call in a document looks them up, so they are
+// collected once per text, on first use.
+type docTables struct {
+	once      sync.Once
+	inh       analysis.Inheritance
+	classes   []analysis.ClassDecl
+	accessors []analysis.Accessor
+	// subs holds the first definition of each sub by Package::name.
+	subs      map[string]*ppi.Node
+	packageAt func(offset int) string
+}
+
+// lookupTables returns the docTables of doc, which must be parsed.
+func (doc *documentData) lookupTables() *docTables {
+	t := doc.tables
+	if t == nil {
+		t = &docTables{}
+	}
+	t.once.Do(func() {
+		t.inh = analysis.CollectInheritance(doc.parsed)
+		t.classes = analysis.CollectClasses(doc.parsed)
+		t.accessors = analysis.CollectAccessors(doc.parsed)
+		t.subs = analysis.SubsByPackage(doc.parsed)
+		t.packageAt = analysis.PackageLookup(doc.parsed)
+	})
+	return t
+}
+
+// packageMRO returns the method resolution order of pkg. Parents declared
+// in the open document take precedence over the workspace index, which may
+// not have seen unsaved edits yet.
+func (s *Server) packageMRO(doc *documentData, uri protocol.DocumentUri, pkg string) []string {
+	var local analysis.Inheritance
+	if doc != nil && doc.parsed != nil {
+		local = doc.lookupTables().inh
+	}
+	index := s.workspaceIndexFor(uri)
+	parents := func(p string) []string {
+		if parents, ok := local.Parents[p]; ok {
+			return parents
+		}
+		if index == nil {
+			return nil
+		}
+		return index.PackageParents(p)
+	}
+	c3 := local.C3[pkg] || (index != nil && index.UsesC3(pkg))
+	return analysis.Linearize(pkg, parents, c3)
+}
+
+// methodCallAt returns the class and method name of a method call whose
+// name is at tokens[idx]. The class comes from the invocant: a bare class
+// name, __PACKAGE__, a variable with a class :SIG, or a receiver such as
+// $self that stands for the current package. SUPER:: starts the lookup at
+// the parents of the current package.
+func methodCallAt(doc *documentData, idx int, offset int) (class string, name string, super bool, ok bool) {
+	if doc == nil || doc.parsed == nil {
+		return "", "", false, false
+	}
+	tokens := doc.parsed.Tokens
+	if idx < 0 || idx >= len(tokens) || tokens[idx].Type != ppi.TokenWord {
+		return "", "", false, false
+	}
+	pkg := doc.lookupTables().packageAt(offset)
+	if pkg == "" {
+		pkg = "main"
+	}
+	name = tokens[idx].Value
+	if rest, found := strings.CutPrefix(name, "SUPER::"); found {
+		return pkg, rest, true, isIdent(rest)
+	}
+	if !isIdent(name) {
+		return "", "", false, false
+	}
+	arrow := prevNonTriviaToken(tokens, idx-1)
+	if arrow < 0 || tokens[arrow].Type != ppi.TokenOperator || tokens[arrow].Value != "->" {
+		return "", "", false, false
+	}
+	recv := prevNonTriviaToken(tokens, arrow-1)
+	if recv < 0 {
+		return "", "", false, false
+	}
+	switch tokens[recv].Type {
+	case ppi.TokenWord:
+		if tokens[recv].Value == "__PACKAGE__" {
+			return pkg, name, false, true
+		}
+		if isClassName(tokens[recv].Value) {
+			return tokens[recv].Value, name, false, true
+		}
+	case ppi.TokenSymbol:
+		if sig := varTypeSigAt(doc, offset, tokens[recv].Value); sig != "" {
+			if class, ok := classNameFromSig(sig); ok {
+				return class, name, false, true
+			}
+		}
+		if doc.index != nil {
+			if _, ok := doc.index.ReceiverNamesAt(offset)[tokens[recv].Value]; ok {
+				return pkg, name, false, true
+			}
+		}
+	}
+	return "", "", false, false
+}
+
+func prevNonTriviaToken(tokens []ppi.Token, idx int) int {
+	for i := idx; i >= 0; i-- {
+		if !isTriviaToken(tokens[i].Type) {
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveMethod walks the MRO of class and returns the first package that
+// defines name. With super set, class itself is skipped.
+func (s *Server) resolveMethod(doc *documentData, uri protocol.DocumentUri, class, name string, super bool) (methodTarget, bool) {
+	mro := s.packageMRO(doc, uri, class)
+	if super && len(mro) > 0 {
+		mro = mro[1:]
+	}
+	index := s.workspaceIndexFor(uri)
+	exclude := ""
+	if path, ok := uriToPath(uri); ok {
+		exclude = path
+	}
+	var tables *docTables
+	if doc != nil && doc.parsed != nil {
+		tables = doc.lookupTables()
+	}
+	for _, pkg := range mro {
+		if tables != nil {
+			if node := tables.subs[pkg+"::"+name]; node != nil {
+				return methodTarget{pkg: pkg, local: node}, true
+			}
+			if m, ok := findClassMethod(tables.classes, pkg, name); ok {
+				return methodTarget{pkg: pkg, classMethod: &m}, true
+			}
+			if acc, ok := findAccessor(tables.accessors, pkg, name); ok {
+				return methodTarget{pkg: pkg, accessor: &acc}, true
+			}
+		}
+		if index == nil {
+			continue
+		}
+		if defs := index.FindSubsFull(pkg+"::"+name, exclude); len(defs) > 0 {
+			return methodTarget{pkg: pkg, defs: defs}, true
+		}
+	}
+	return methodTarget{}, false
+}
+
+func findClassMethod(classes []analysis.ClassDecl, pkg, name string) (analysis.ClassMethod, bool) {
+	for _, class := range classes {
+		if class.Name != pkg {
+			continue
+		}
+		for _, m := range class.Methods {
+			if m.Name == name {
+				return m, true
+			}
+		}
+	}
+	return analysis.ClassMethod{}, false
+}
+
+func findAccessor(accessors []analysis.Accessor, pkg, name string) (analysis.Accessor, bool) {
+	for _, acc := range accessors {
+		if acc.Package == pkg && acc.Name == name {
+			return acc, true
+		}
+	}
+	return analysis.Accessor{}, false
+}
+
+// locations converts a method target into definition locations.
+func (t methodTarget) locations(text string, uri protocol.DocumentUri) []protocol.Location {
+	if t.accessor != nil {
+		rng := protocol.Range{
+			Start: positionFromOffset(text, t.accessor.Start),
+			End:   positionFromOffset(text, t.accessor.End),
+		}
+		return []protocol.Location{{URI: uri, Range: rng}}
+	}
+	if t.classMethod != nil {
+		rng := protocol.Range{
+			Start: positionFromOffset(text, t.classMethod.Start),
+			End:   positionFromOffset(text, t.classMethod.End),
+		}
+		return []protocol.Location{{URI: uri, Range: rng}}
+	}
+	if t.local != nil {
+		rng, ok := nodeNameRange(text, t.local)
+		if !ok {
+			return nil
+		}
+		return []protocol.Location{{URI: uri, Range: rng}}
+	}
+	locations := make([]protocol.Location, 0, len(t.defs))
+	for _, def := range t.defs {
+		rng, ok := rangeFromFile(def.File, def.Start, def.End)
+		if !ok {
+			continue
+		}
+		locations = append(locations, protocol.Location{
+			URI:   protocol.DocumentUri(fileURI(def.File)),
+			Range: rng,
+		})
+	}
+	return locations
+}
+
+// hoverContent renders the sub declaration of a method target and the
+// package it was found in. text is the current document, which holds the
+// :SIG comment of a local class method.
+func (t methodTarget) hoverContent(text string) string {
+	node := t.local
+	acc := t.accessor
+	if t.classMethod != nil {
+		return classMethodHover(*t.classMethod, text) + "\npackage: " + t.pkg
+	}
+	if node == nil && acc == nil && len(t.defs) > 0 {
+		src, err := os.ReadFile(t.defs[0].File)
+		if err != nil {
+			return ""
+		}
+		parsed := parseDocument(string(src))
+		node = findStatementForOffset(parsed.Root, t.defs[0].Start)
+		if m, ok := classMethodAt(parsed, t.defs[0].Start); ok {
+			return classMethodHover(m, string(src)) + "\npackage: " + t.pkg
+		}
+		if node != nil && node.Kind != "statement::sub" {
+			for _, a := range analysis.CollectAccessors(parsed) {
+				if a.Name == t.defs[0].Name && a.Start == t.defs[0].Start {
+					acc = &a
+					break
+				}
+			}
+		}
+	}
+	content := hoverContentForNode(node)
+	if acc != nil {
+		content = accessorHover(*acc)
+	}
+	if content == "" {
+		return ""
+	}
+	return content + "\npackage: " + t.pkg
+}
+
+// accessorHover renders a method generated by "has" or a field :reader.
+func accessorHover(acc analysis.Accessor) string {
+	sig := acc.Sig
+	if t, err := analysis.ParseSig(sig); err == nil {
+		sig = t.String()
+	}
+	return strings.Join([]string{"```perl", acc.Decl, "```", acc.Kind + ": " + acc.Name, "type: " + sig}, "\n")
+}
+
+// classMethodHover renders a method of the class feature and its :SIG.
+func classMethodHover(m analysis.ClassMethod, text string) string {
+	lines := []string{"```perl", "method " + m.Name, "```"}
+	if sig := sigCommentBeforeOffset(text, m.BodyStart); sig != "" {
+		if t, err := analysis.ParseSig(sig); err == nil {
+			sig = t.String()
+		}
+		lines = append(lines, "type: "+sig)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// classMethodAt returns the class method whose name starts at offset.
+func classMethodAt(doc *ppi.Document, offset int) (analysis.ClassMethod, bool) {
+	for _, class := range analysis.CollectClasses(doc) {
+		for _, m := range class.Methods {
+			if m.Start == offset {
+				return m, true
+			}
+		}
+	}
+	return analysis.ClassMethod{}, false
+}
+
+// methodsForClass returns the methods callable on class, including the
+// inherited ones, in MRO order.
+func (s *Server) methodsForClass(doc *documentData, uri protocol.DocumentUri, class string) []string {
+	var methods []string
+	for _, pkg := range s.packageMRO(doc, uri, class) {
+		if doc != nil {
+			methods = append(methods, methodsForPackage(doc.parsed, pkg)...)
+		}
+		methods = append(methods, s.methodsForPackageWorkspace(pkg, uri)...)
+	}
+	return methods
+}
@@ -0,0 +1,160 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func newInheritTestServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	writeFile(t, filepath.Join(lib, "Animal.pm"), "package Animal;\nsub new { bless {}, shift }\nsub speak ($self) {}\n# :SIG((Animal, int) -> void)\nsub feed {}\n1;\n")
+	writeFile(t, filepath.Join(lib, "Dog.pm"), "package Dog;\nuse parent 'Animal';\nsub fetch {}\n1;\n")
+	index, err := analysis.BuildWorkspaceIndex([]string{lib})
+	if err != nil {
+		t.Fatalf("workspace index: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	s.folders = []*workspaceFolder{{root: tmp, libRoots: []string{lib}, index: index}}
+	return s, tmp
+}
+
+func TestDefinitionInheritedMethod(t *testing.T) {
+	s, tmp := newInheritTestServer(t)
+	src := "package Puppy;\nuse parent -norequire, 'Dog';\nsub new {\n    my $self = shift;\n    $self->speak;\n    return $self->SUPER::new(@_);\n}\n1;\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "lib", "Puppy.pm")))
+	s.docs.set(string(uri), src, nil)
+
+	for _, word := range []string{"speak", "SUPER::new"} {
+		offset := strings.Index(src, word)
+		params := &protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     positionFromOffset(src, offset+1),
+			},
+		}
+		got, err := s.definition(nil, params)
+		if err != nil {
+			t.Fatalf("definition error: %v", err)
+		}
+		locs, ok := got.([]protocol.Location)
+		if !ok || len(locs) != 1 {
+			t.Fatalf("%s: expected one location, got %#v", word, got)
+		}
+		if want := protocol.DocumentUri(fileURI(filepath.Join(tmp, "lib", "Animal.pm"))); locs[0].URI != want {
+			t.Fatalf("%s: expected %s, got %s", word, want, locs[0].URI)
+		}
+	}
+
+	offset := strings.Index(src, "speak")
+	hover, err := s.hover(nil, &protocol.HoverParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     positionFromOffset(src, offset+1),
+		},
+	})
+	if err != nil || hover == nil {
+		t.Fatalf("hover: %v %v", hover, err)
+	}
+	content := hover.Contents.(protocol.MarkupContent).Value
+	if !strings.Contains(content, "sub speak") || !strings.Contains(content, "package: Animal") {
+		t.Fatalf("unexpected hover: %q", content)
+	}
+}
+
+func TestDefinitionBareCallIgnoresParents(t *testing.T) {
+	s, tmp := newInheritTestServer(t)
+	src := "package Puppy;\nuse parent -norequire, 'Dog';\nsub run {\n    speak();\n    fetch();\n}\n1;\n"
+	path := filepath.Join(tmp, "lib", "Puppy.pm")
+	writeFile(t, path, src)
+	index, err := analysis.BuildWorkspaceIndex([]string{filepath.Join(tmp, "lib")})
+	if err != nil {
+		t.Fatalf("workspace index: %v", err)
+	}
+	s.folders[0].index = index
+	uri := protocol.DocumentUri(fileURI(path))
+	s.docs.set(string(uri), src, nil)
+
+	for _, word := range []string{"speak", "fetch"} {
+		offset := strings.Index(src, word)
+		got, err := s.definition(nil, &protocol.DefinitionParams{
+			TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+				TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+				Position:     positionFromOffset(src, offset+1),
+			},
+		})
+		if err != nil {
+			t.Fatalf("definition error: %v", err)
+		}
+		if locs, ok := got.([]protocol.Location); ok && len(locs) > 0 {
+			t.Fatalf("%s: expected no definition for a plain call, got %v", word, locs)
+		}
+	}
+}
+
+func TestCompletionInheritedMethods(t *testing.T) {
+	s, tmp := newInheritTestServer(t)
+	src := "# :SIG(Dog -> void)\nsub walk ($dog) {\n    $dog->\n}\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "walk.pl")))
+	s.docs.set(string(uri), src, nil)
+
+	offset := strings.Index(src, "$dog->") + len("$dog->")
+	got, err := s.completion(nil, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     positionFromOffset(src, offset),
+		},
+	})
+	if err != nil {
+		t.Fatalf("completion error: %v", err)
+	}
+	list := got.(protocol.CompletionList)
+	for _, name := range []string{"fetch", "speak", "new"} {
+		if !hasCompletionLabel(list.Items, name) {
+			t.Fatalf("expected %s completion, got %v", name, completionLabels(list.Items))
+		}
+	}
+}
+
+func TestSigCallDiagnosticsInheritedMethod(t *testing.T) {
+	s, tmp := newInheritTestServer(t)
+	src := "# :SIG(Dog)\nmy $dog = Dog->new;\n$dog->feed(1);\n$dog->feed(\"x\");\n$dog->feed;\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "feed.pl")))
+	doc := parseDocument(src)
+	diags := s.toSigCallDiagnostics(uri, src, doc)
+	var msgs []string
+	for _, d := range diags {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"arg 1 of Dog->feed: expected int, got str",
+		"call to Dog->feed: expected 1 args, got 0",
+	}
+	if len(msgs) != len(want) || msgs[0] != want[0] || msgs[1] != want[1] {
+		t.Fatalf("expected %v, got %v", want, msgs)
+	}
+}
+
+func TestLookupTablesAreSharedByCopies(t *testing.T) {
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	uri := protocol.DocumentUri("file:///tables.pl")
+	d := s.docs.set(string(uri), "package Cat;\nsub meow { 1 }\npackage Kitten;\nuse parent -norequire, 'Cat';\nKitten->meow;\n", nil)
+	tables := d.lookupTables()
+	if got := s.withWorkspaceSigs(d, uri).lookupTables(); got != tables {
+		t.Fatalf("expected the copy to share the tables")
+	}
+	if tables.subs["Cat::meow"] == nil || len(tables.inh.Parents["Kitten"]) != 1 {
+		t.Fatalf("unexpected tables: %+v", tables)
+	}
+	if target, ok := s.resolveMethod(d, uri, "Kitten", "meow", false); !ok || target.pkg != "Cat" {
+		t.Fatalf("expected meow in Cat, got %+v", target)
+	}
+}
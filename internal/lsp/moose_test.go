@@ -0,0 +1,71 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestMooseAccessors(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	writeFile(t, filepath.Join(lib, "Role/Named.pm"), "package Role::Named;\nuse Moo::Role;\nhas name => (is => 'ro', isa => Str, predicate => 1);\n1;\n")
+	index, err := analysis.BuildWorkspaceIndex([]string{lib})
+	if err != nil {
+		t.Fatalf("workspace index: %v", err)
+	}
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	s.folders = []*workspaceFolder{{root: tmp, libRoots: []string{lib}, index: index}}
+
+	src := "package Person;\nuse Moo;\nwith 'Role::Named';\nhas age => (is => 'rw', isa => Int);\nsub greet {\n    my $self = shift;\n    $self->age;\n    $self->name;\n}\n# :SIG(Person -> void)\nsub walk ($p) {\n    $p->\n}\n1;\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "lib", "Person.pm")))
+	s.docs.set(string(uri), src, nil)
+	position := func(offset int) protocol.TextDocumentPositionParams {
+		return protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     positionFromOffset(src, offset),
+		}
+	}
+
+	offset := strings.Index(src, "$p->\n") + len("$p->")
+	got, err := s.completion(nil, &protocol.CompletionParams{TextDocumentPositionParams: position(offset)})
+	if err != nil {
+		t.Fatalf("completion error: %v", err)
+	}
+	list := got.(protocol.CompletionList)
+	for _, name := range []string{"age", "name", "has_name", "greet"} {
+		if !hasCompletionLabel(list.Items, name) {
+			t.Fatalf("expected %s completion, got %v", name, completionLabels(list.Items))
+		}
+	}
+
+	for word, file := range map[string]string{"->age": "Person.pm", "->name": "Role/Named.pm"} {
+		offset := strings.Index(src, word) + 3
+		got, err := s.definition(nil, &protocol.DefinitionParams{TextDocumentPositionParams: position(offset)})
+		if err != nil {
+			t.Fatalf("definition error: %v", err)
+		}
+		locs, ok := got.([]protocol.Location)
+		if !ok || len(locs) != 1 {
+			t.Fatalf("%s: expected one location, got %#v", word, got)
+		}
+		if want := protocol.DocumentUri(fileURI(filepath.Join(lib, file))); locs[0].URI != want {
+			t.Fatalf("%s: expected %s, got %s", word, want, locs[0].URI)
+		}
+	}
+
+	offset = strings.Index(src, "->name") + 3
+	hover, err := s.hover(nil, &protocol.HoverParams{TextDocumentPositionParams: position(offset)})
+	if err != nil || hover == nil {
+		t.Fatalf("hover: %v %v", hover, err)
+	}
+	content := hover.Contents.(protocol.MarkupContent).Value
+	if !strings.Contains(content, "has name") || !strings.Contains(content, "type: any -> str") || !strings.Contains(content, "package: Role::Named") {
+		t.Fatalf("unexpected hover: %q", content)
+	}
+}
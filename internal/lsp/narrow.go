@@ -0,0 +1,249 @@
+package lsp
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+)
+
+// narrowedTypeAt returns the type a scalar is known to have at offset
+// because an enclosing if/elsif condition tested it with "isa", ->isa or
+// ref(...) eq '...'. The innermost narrowing condition wins.
+func narrowedTypeAt(doc *documentData, offset int, name string) string {
+	if doc == nil || doc.parsed == nil || !strings.HasPrefix(name, "$") {
+		return ""
+	}
+	out := ""
+	walkNodes(doc.parsed.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement || n.Kind != "statement::control" {
+			return
+		}
+		if n.Keyword != "if" && n.Keyword != "elsif" {
+			return
+		}
+		inBlock := false
+		for _, child := range n.Children {
+			if child.Type != ppi.NodeBlock {
+				continue
+			}
+			if start, end, ok := nodeTokenRange(child); ok && offset >= start && offset < end {
+				inBlock = true
+			}
+		}
+		if !inBlock {
+			return
+		}
+		// walkNodes visits outer statements first, so later matches are
+		// more deeply nested.
+		if t := conditionType(n.Tokens, name); t != "" {
+			out = t
+		}
+	})
+	return out
+}
+
+// conditionType returns the type of name implied by a condition when it
+// holds. Only the terms of a top-level && / "and" chain are considered.
+func conditionType(tokens []ppi.Token, name string) string {
+	var ts []ppi.Token
+	for _, tok := range tokens {
+		if !isTriviaToken(tok.Type) {
+			ts = append(ts, tok)
+		}
+	}
+	if len(ts) < 2 || ts[1].Type != ppi.TokenOperator || ts[1].Value != "(" {
+		return ""
+	}
+	ts = ts[2:]
+	if len(ts) > 0 && ts[len(ts)-1].Type == ppi.TokenOperator && ts[len(ts)-1].Value == ")" {
+		ts = ts[:len(ts)-1]
+	}
+	out := ""
+	depth := 0
+	start := 0
+	for i := 0; i <= len(ts); i++ {
+		if i < len(ts) {
+			tok := ts[i]
+			if tok.Type != ppi.TokenOperator {
+				continue
+			}
+			switch tok.Value {
+			case "(", "[", "{":
+				depth++
+				continue
+			case ")", "]", "}":
+				depth--
+				continue
+			case "||", "or", "//":
+				if depth == 0 {
+					return ""
+				}
+				continue
+			case "&&", "and":
+				if depth != 0 {
+					continue
+				}
+			default:
+				continue
+			}
+		}
+		if t := termType(ts[start:i], name); t != "" {
+			out = t
+		}
+		start = i + 1
+	}
+	return out
+}
+
+// termType recognizes "$x isa Foo", "$x->isa('Foo')" and
+// "ref($x) eq 'HASH'" (or "ref $x eq ...").
+func termType(ts []ppi.Token, name string) string {
+	if len(ts) == 0 {
+		return ""
+	}
+	if ts[0].Type == ppi.TokenSymbol && ts[0].Value == name && len(ts) >= 3 {
+		if ts[1].Type == ppi.TokenWord && ts[1].Value == "isa" && len(ts) == 3 {
+			if class := ts[2].Value; ts[2].Type == ppi.TokenWord && isClassName(class) {
+				return class
+			}
+			if class := quotedValue(ts[2]); isClassName(class) {
+				return class
+			}
+		}
+		if ts[1].Type == ppi.TokenOperator && ts[1].Value == "->" && len(ts) == 6 &&
+			ts[2].Type == ppi.TokenWord && ts[2].Value == "isa" && ts[3].Value == "(" && ts[5].Value == ")" {
+			if class := quotedValue(ts[4]); isClassName(class) {
+				return class
+			}
+		}
+		return ""
+	}
+	if ts[0].Type != ppi.TokenWord || ts[0].Value != "ref" {
+		return ""
+	}
+	rest := ts[1:]
+	if len(rest) >= 3 && rest[0].Value == "(" && rest[2].Value == ")" {
+		rest = append([]ppi.Token{rest[1]}, rest[3:]...)
+	}
+	if len(rest) != 3 || rest[0].Type != ppi.TokenSymbol || rest[0].Value != name ||
+		rest[1].Type != ppi.TokenOperator || rest[1].Value != "eq" {
+		return ""
+	}
+	switch ref := quotedValue(rest[2]); ref {
+	case "HASH":
+		return "hash[any]"
+	case "ARRAY":
+		return "array[any]"
+	case "CODE":
+		return "code"
+	case "Regexp":
+		return "regexp"
+	case "GLOB":
+		return "glob"
+	case "SCALAR", "REF", "":
+		return ""
+	default:
+		if isClassName(ref) {
+			return ref
+		}
+	}
+	return ""
+}
+
+// quotedValue returns the contents of a '...', "...", q{...} or qq{...}
+// string token.
+func quotedValue(tok ppi.Token) string {
+	v := tok.Value
+	switch tok.Type {
+	case ppi.TokenQuote:
+	case ppi.TokenQuoteLike:
+		switch {
+		case strings.HasPrefix(v, "qq"):
+			v = strings.TrimSpace(v[2:])
+		case strings.HasPrefix(v, "q") && !strings.HasPrefix(v, "qw") && !strings.HasPrefix(v, "qr") && !strings.HasPrefix(v, "qx"):
+			v = strings.TrimSpace(v[1:])
+		default:
+			return ""
+		}
+	default:
+		return ""
+	}
+	if len(v) < 2 {
+		return ""
+	}
+	return v[1 : len(v)-1]
+}
+
+// blessTarget returns the class an assignment such as
+// "my $self = bless {}, $class" blesses into. A literal class name is used
+// as is; anything else ($class, shift, __PACKAGE__, or no second argument)
+// stands for the current package.
+func blessTarget(doc *documentData, start, end int) string {
+	tokens := doc.parsed.Tokens
+	i := nextNonTriviaTokenLocal(tokens, start)
+	if i < 0 || i >= end || tokens[i].Type != ppi.TokenWord || tokens[i].Value != "bless" {
+		return ""
+	}
+	pkg := doc.parsed.PackageAt(tokens[i].Start)
+	if pkg == "" {
+		pkg = "main"
+	}
+	base := 0
+	if open := nextNonTriviaTokenLocal(tokens, i+1); open >= 0 && open < end && tokens[open].Value == "(" {
+		base = 1
+	}
+	depth := 0
+	for j := i + 1; j < end; j++ {
+		tok := tokens[j]
+		if tok.Type != ppi.TokenOperator {
+			continue
+		}
+		switch tok.Value {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		case ",", "=>":
+			if depth != base {
+				continue
+			}
+			next := nextNonTriviaTokenLocal(tokens, j+1)
+			if next >= 0 && next < end {
+				if class := quotedValue(tokens[next]); class != "" {
+					if isClassName(class) {
+						return class
+					}
+					return ""
+				}
+			}
+			return pkg
+		}
+	}
+	return pkg
+}
+
+// blessedReturnClass returns the class a sub without a :SIG returns when
+// its body blesses a reference, as constructors do.
+func blessedReturnClass(doc *documentData, sub *ppi.Node) string {
+	start, end, ok := nodeTokenRange(sub)
+	if !ok {
+		return ""
+	}
+	tokens := doc.parsed.Tokens
+	for i, tok := range tokens {
+		if tok.Start < start {
+			continue
+		}
+		if tok.Start >= end {
+			break
+		}
+		if tok.Type == ppi.TokenWord && tok.Value == "bless" {
+			stmtEnd := i
+			for stmtEnd < len(tokens) && tokens[stmtEnd].Start < end && tokens[stmtEnd].Value != ";" {
+				stmtEnd++
+			}
+			return blessTarget(doc, i, stmtEnd)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,145 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestInferredVarTypes(t *testing.T) {
+	cases := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{
+			name: "constructor",
+			src:  "my $x = Foo::Bar->new(1);\n$x;\n",
+			want: "Foo::Bar",
+		},
+		{
+			name: "lowercase constructor",
+			src:  "my $x = version->new('1.0');\n$x;\n",
+			want: "version",
+		},
+		{
+			name: "package constructor",
+			src:  "package Foo;\nsub make { my $x = __PACKAGE__->new; $x; }\n",
+			want: "Foo",
+		},
+		{
+			name: "bless class var",
+			src:  "package Foo;\nsub new { my $class = shift; my $x = bless {}, $class; $x; }\n",
+			want: "Foo",
+		},
+		{
+			name: "bless literal",
+			src:  "package Foo;\nsub new { my $x = bless({ a => 1 }, 'Foo::Impl'); $x; }\n",
+			want: "Foo::Impl",
+		},
+		{
+			name: "blessing sub",
+			src:  "sub make { return bless {}, 'Widget' }\nmy $x = make();\n$x;\n",
+			want: "Widget",
+		},
+		{
+			name: "isa operator",
+			src:  "my $x = shift;\nif ($x isa Foo::Bar) {\n    $x;\n}\n",
+			want: "Foo::Bar",
+		},
+		{
+			name: "isa method",
+			src:  "my $x = shift;\nif (blessed $x && $x->isa('Foo')) {\n    $x;\n}\n",
+			want: "Foo",
+		},
+		{
+			name: "ref hash",
+			src:  "my $x = shift;\nif (1) {\n} elsif (ref($x) eq 'HASH') {\n    $x;\n}\n",
+			want: "hash[any]",
+		},
+		{
+			name: "innermost wins",
+			src:  "# :SIG(Animal)\nmy $x = shift;\nif ($x isa Dog) {\n    if (ref $x eq 'Puppy') {\n        $x;\n    }\n}\n",
+			want: "Puppy",
+		},
+		{
+			name: "or does not narrow",
+			src:  "my $x = shift;\nif ($x isa Foo || 1) {\n    $x;\n}\n",
+			want: "",
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			store := newDocumentStore()
+			d := store.set("file:///test.pl", tc.src, nil)
+			offset := strings.LastIndex(tc.src, "$x;")
+			if got := hoverVarSigType(d, offset, "$x", nil); got != tc.want {
+				t.Fatalf("expected %q, got %q", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestCompletionNarrowedType(t *testing.T) {
+	tmp := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	src := "package Dog;\nsub bark {}\npackage main;\nsub run {\n    my $x = shift;\n    if ($x isa Dog) {\n        $x->\n    }\n}\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "run.pl")))
+	s.docs.set(string(uri), src, nil)
+
+	offset := strings.Index(src, "$x->") + len("$x->")
+	got, err := s.completion(nil, &protocol.CompletionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     positionFromOffset(src, offset),
+		},
+	})
+	if err != nil {
+		t.Fatalf("completion error: %v", err)
+	}
+	if list, ok := got.(protocol.CompletionList); !ok || !hasCompletionLabel(list.Items, "bark") {
+		t.Fatalf("expected bark completion, got %#v", got)
+	}
+}
+
+func TestLowercaseClassMethodCall(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	pm := "package version;\n# :SIG((str, str) -> version)\nsub parse {}\nsub numify {}\n1;\n"
+	writeFile(t, filepath.Join(lib, "version.pm"), pm)
+	index, err := analysis.BuildWorkspaceIndex([]string{lib})
+	if err != nil {
+		t.Fatalf("workspace index: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	s.folders = []*workspaceFolder{{root: tmp, libRoots: []string{lib}, index: index}}
+	src := "my $v = version->parse('1.0');\n$v->numify;\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "v.pl")))
+	s.docs.set(string(uri), src, nil)
+
+	pmURI := protocol.DocumentUri(fileURI(filepath.Join(lib, "version.pm")))
+	if diags := sigDiagnostics(pm, s.sigScope(pmURI, parseDocument(pm))); len(diags) != 0 {
+		t.Fatalf("expected version to be a known class, got %v", diags)
+	}
+	offset := strings.Index(src, "numify")
+	got, err := s.definition(nil, &protocol.DefinitionParams{
+		TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+			TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+			Position:     positionFromOffset(src, offset+1),
+		},
+	})
+	if err != nil {
+		t.Fatalf("definition error: %v", err)
+	}
+	locs, ok := got.([]protocol.Location)
+	if !ok || len(locs) != 1 || locs[0].URI != protocol.DocumentUri(fileURI(filepath.Join(lib, "version.pm"))) {
+		t.Fatalf("expected version.pm, got %#v", got)
+	}
+}
@@ -0,0 +1,141 @@
+package lsp
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+const defaultPerl = "perl"
+
+// perlEnv is the perl interpreter and extra library directories used for a
+// workspace folder. The same interpreter runs perl -c and the @INC lookup,
+// so indexing and compile checks see the modules the application runs with.
+type perlEnv struct {
+	perl    string
+	source  string
+	libDirs []string
+}
+
+// detectPerlEnv finds the perl for a project rooted at root.
+// The interpreter is taken from, in order: .perl-version (plenv), perlbrew
+// environment variables, the configured interpreter path, and finally perl
+// in PATH. Library directories come from PERL5LIB, PERL_LOCAL_LIB_ROOT and
+// a carton local/ directory.
+func detectPerlEnv(root string, configured string, getenv func(string) string) perlEnv {
+	env := perlEnv{perl: defaultPerl, source: "PATH"}
+	if perl, ok := plenvPerl(root, getenv); ok {
+		env.perl, env.source = perl, "plenv"
+	} else if perl, ok := perlbrewPerl(getenv); ok {
+		env.perl, env.source = perl, "perlbrew"
+	} else if configured != "" {
+		env.perl, env.source = configured, "config"
+	}
+
+	for dir := range strings.SplitSeq(getenv("PERL5LIB"), string(os.PathListSeparator)) {
+		if dir != "" {
+			env.libDirs = append(env.libDirs, dir)
+		}
+	}
+	for dir := range strings.SplitSeq(getenv("PERL_LOCAL_LIB_ROOT"), string(os.PathListSeparator)) {
+		if dir != "" {
+			env.libDirs = append(env.libDirs, filepath.Join(dir, "lib", "perl5"))
+		}
+	}
+	if dir, ok := cartonLibDir(root); ok {
+		env.libDirs = append(env.libDirs, dir)
+	}
+	env.libDirs = uniqueStrings(env.libDirs)
+	return env
+}
+
+func plenvPerl(root string, getenv func(string) string) (string, bool) {
+	if root == "" {
+		return "", false
+	}
+	version := ""
+	for dir := filepath.Clean(root); ; dir = filepath.Dir(dir) {
+		if b, err := os.ReadFile(filepath.Join(dir, ".perl-version")); err == nil {
+			version = strings.TrimSpace(string(b))
+			break
+		}
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if version == "" || version == "system" {
+		return "", false
+	}
+	plenvRoot := getenv("PLENV_ROOT")
+	if plenvRoot == "" {
+		home := getenv("HOME")
+		if home == "" {
+			return "", false
+		}
+		plenvRoot = filepath.Join(home, ".plenv")
+	}
+	return existingFile(filepath.Join(plenvRoot, "versions", version, "bin", "perl"))
+}
+
+func perlbrewPerl(getenv func(string) string) (string, bool) {
+	name := getenv("PERLBREW_PERL")
+	if name == "" {
+		return "", false
+	}
+	brewRoot := getenv("PERLBREW_ROOT")
+	if brewRoot == "" {
+		home := getenv("HOME")
+		if home == "" {
+			return "", false
+		}
+		brewRoot = filepath.Join(home, "perl5", "perlbrew")
+	}
+	return existingFile(filepath.Join(brewRoot, "perls", name, "bin", "perl"))
+}
+
+func cartonLibDir(root string) (string, bool) {
+	if root == "" {
+		return "", false
+	}
+	if _, ok := existingFile(filepath.Join(root, "cpanfile.snapshot")); !ok {
+		if _, ok := existingFile(filepath.Join(root, "cpanfile")); !ok {
+			return "", false
+		}
+	}
+	dir := filepath.Join(root, "local", "lib", "perl5")
+	info, err := os.Stat(dir)
+	if err != nil || !info.IsDir() {
+		return "", false
+	}
+	return dir, true
+}
+
+func existingFile(path string) (string, bool) {
+	info, err := os.Stat(path)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	return path, true
+}
+
+func perlINCPaths(perl string) ([]string, error) {
+	if perl == "" {
+		perl = defaultPerl
+	}
+	cmd := exec.Command(perl, "-e", "print join(\"\\n\", @INC)")
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
+	var paths []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		paths = append(paths, line)
+	}
+	return paths, nil
+}
@@ -51,7 +51,7 @@ func TestCompileIncludePathsIncludesWorkspaceRoots(t *testing.T) {
 
 	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
 	s := NewServer(logger, "test")
-	s.workspaceRoots = []string{workspaceLib}
+	s.folders = []*workspaceFolder{{libRoots: []string{workspaceLib}}}
 
 	filePath := filepath.Join(tmp, "lib", "App", "cpm", "Builder", "EUMM.pm")
 	paths := s.compileIncludePathsWithBase(nil, filePath, "")
@@ -73,7 +73,7 @@ func TestUseLibPathsResolveAgainstWorkspaceRoot(t *testing.T) {
 	doc.ParseWithDiagnostics()
 
 	srv := newTestServer()
-	srv.projectRoots = []string{root}
+	srv.folders = []*workspaceFolder{{root: root}}
 	path := filepath.Join(root, "xt", "41_issue.t")
 
 	got := collectUseLibPathsWithBase(doc.Root, path, srv.projectBaseForFile(path))
@@ -99,8 +99,7 @@ func TestCompileIncludePathsUseWorkspaceRootBase(t *testing.T) {
 	doc.ParseWithDiagnostics()
 
 	srv := newTestServer()
-	srv.projectRoots = []string{root}
-	srv.workspaceRoots = []string{lib}
+	srv.folders = []*workspaceFolder{{root: root, libRoots: []string{lib}}}
 	path := filepath.Join(root, "xt", "41_issue.t")
 
 	got := srv.compileIncludePathsWithBase(doc.Root, path, "")
@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectPerlEnvPlenv(t *testing.T) {
+	tmp := t.TempDir()
+	root := filepath.Join(tmp, "project")
+	plenvPerl := filepath.Join(tmp, "plenv", "versions", "5.38.2", "bin", "perl")
+	writeFile(t, filepath.Join(root, ".perl-version"), "5.38.2\n")
+	writeFile(t, plenvPerl, "")
+	env := map[string]string{
+		"PLENV_ROOT":    filepath.Join(tmp, "plenv"),
+		"PERLBREW_PERL": "perl-5.36.0",
+	}
+
+	got := detectPerlEnv(root, "/opt/perl/bin/perl", mapGetenv(env))
+	if got.perl != plenvPerl || got.source != "plenv" {
+		t.Fatalf("expected plenv perl %q, got %+v", plenvPerl, got)
+	}
+}
+
+func TestDetectPerlEnvPerlbrewAndConfig(t *testing.T) {
+	tmp := t.TempDir()
+	brewPerl := filepath.Join(tmp, "brew", "perls", "perl-5.36.0", "bin", "perl")
+	writeFile(t, brewPerl, "")
+	env := map[string]string{
+		"PERLBREW_ROOT": filepath.Join(tmp, "brew"),
+		"PERLBREW_PERL": "perl-5.36.0",
+	}
+
+	got := detectPerlEnv(tmp, "/opt/perl/bin/perl", mapGetenv(env))
+	if got.perl != brewPerl || got.source != "perlbrew" {
+		t.Fatalf("expected perlbrew perl %q, got %+v", brewPerl, got)
+	}
+
+	got = detectPerlEnv(tmp, "/opt/perl/bin/perl", mapGetenv(nil))
+	if got.perl != "/opt/perl/bin/perl" || got.source != "config" {
+		t.Fatalf("expected configured perl, got %+v", got)
+	}
+
+	got = detectPerlEnv(tmp, "", mapGetenv(nil))
+	if got.perl != defaultPerl {
+		t.Fatalf("expected perl from PATH, got %+v", got)
+	}
+}
+
+func TestDetectPerlEnvLibDirs(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, "cpanfile"), "requires 'Moo';\n")
+	writeFile(t, filepath.Join(root, "local", "lib", "perl5", "Moo.pm"), "package Moo;\n1;\n")
+	env := map[string]string{
+		"PERL5LIB":            "/a/lib" + string(filepath.ListSeparator) + "/b/lib",
+		"PERL_LOCAL_LIB_ROOT": "/home/u/perl5",
+	}
+
+	got := detectPerlEnv(root, "", mapGetenv(env))
+	want := []string{"/a/lib", "/b/lib", filepath.Join("/home/u/perl5", "lib", "perl5"), filepath.Join(root, "local", "lib", "perl5")}
+	if len(got.libDirs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got.libDirs)
+	}
+	for i := range want {
+		if got.libDirs[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got.libDirs)
+		}
+	}
+}
+
+func mapGetenv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
@@ -0,0 +1,45 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestPragmaHoverAndDiagnostics(t *testing.T) {
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	src := "use strict;\nsay 'early';\nuse v5.36;\nsay 'late';\n"
+	uri := protocol.DocumentUri("file:///pragma.pl")
+	d := s.docs.set(string(uri), src, nil)
+
+	offset := strings.Index(src, "v5.36")
+	hover, err := s.hover(nil, &protocol.HoverParams{TextDocumentPositionParams: protocol.TextDocumentPositionParams{
+		TextDocument: protocol.TextDocumentIdentifier{URI: uri},
+		Position:     positionFromOffset(src, offset),
+	}})
+	if err != nil || hover == nil {
+		t.Fatalf("hover: %v %v", hover, err)
+	}
+	content := hover.Contents.(protocol.MarkupContent).Value
+	want := "features: bareword_filehandles, bitwise, current_sub, evalbytes, fc, isa, postderef_qq, say, signatures, state, unicode_eval, unicode_strings\nstrict: on\nwarnings: on"
+	if !strings.Contains(content, want) {
+		t.Fatalf("expected %q in hover %q", want, content)
+	}
+
+	diags := toFeatureDiagnostics(src, d.parsed)
+	if len(diags) != 1 || diags[0].Range.Start.Line != 1 || *diags[0].Severity != protocol.DiagnosticSeverityWarning {
+		t.Fatalf("unexpected diagnostics: %+v", diags)
+	}
+	diags = toWarningDiagnostics(src, d.parsed)
+	if len(diags) != 0 {
+		t.Fatalf("use v5.36 enables warnings: %+v", diags)
+	}
+	d = s.docs.set(string(uri), "use strict;\nmy $n = 1;\nmy $n = 2;\n", nil)
+	diags = toWarningDiagnostics(d.text, d.parsed)
+	if len(diags) != 1 || diags[0].Message != "use strict without use warnings" || diags[0].Range.Start.Line != 0 {
+		t.Fatalf("unexpected warning diagnostics: %+v", diags)
+	}
+}
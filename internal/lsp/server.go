@@ -10,6 +10,7 @@ import (
 	"os/exec"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
@@ -35,14 +36,15 @@ type Server struct {
 	logger  *slog.Logger
 	version string
 
-	workspaceMu          sync.RWMutex
-	projectRoots         []string
-	workspaceRoots       []string
-	incRoots             []string
-	extraRoots           map[string]struct{}
-	workspaceIndex       *analysis.WorkspaceIndex
-	workspaceBuildID     uint64
-	workspaceBuildCancel context.CancelFunc
+	workspaceMu sync.RWMutex
+	settings    config
+	folders     []*workspaceFolder
+	// createFiles is set when the client applies workspace edits that
+	// create files.
+	createFiles bool
+
+	incMu    sync.Mutex
+	incCache map[string][]string
 
 	compileMu          sync.RWMutex
 	compileDiagnostics map[string][]protocol.Diagnostic
@@ -71,6 +73,11 @@ func NewServer(logger *slog.Logger, version string) *Server {
 		TextDocumentDefinition:     s.definition,
 		TextDocumentTypeDefinition: s.typeDefinition,
 		TextDocumentCompletion:     s.completion,
+		TextDocumentDocumentSymbol: s.documentSymbol,
+		TextDocumentCodeAction:     s.codeAction,
+
+		WorkspaceDidChangeWorkspaceFolders: s.didChangeWorkspaceFolders,
+		WorkspaceDidChangeConfiguration:    s.didChangeConfiguration,
 	}
 	return s
 }
@@ -87,6 +94,16 @@ type documentData struct {
 	version *protocol.UInteger
 	parsed  *ppi.Document
 	index   *analysis.Index
+	// funcSig resolves the :SIG of subs the document calls but does not
+	// define, and methodSig the :SIG of a method found through the MRO of
+	// class. These are set per request by withWorkspaceSigs.
+	funcSig   func(name string) string
+	methodSig func(class, name string) string
+	// typeAlias looks up :TYPE aliases by package-qualified name.
+	typeAlias func(fullName string) (analysis.TypeAlias, bool)
+	// tables holds what method lookups need from the text, shared by the
+	// copies withWorkspaceSigs makes.
+	tables *docTables
 }
 
 type documentStore struct {
@@ -109,6 +126,7 @@ func (s *documentStore) set(uri string, text string, version *protocol.UInteger)
 		version: version,
 		parsed:  parsed,
 		index:   index,
+		tables:  &docTables{},
 	}
 	s.docs[uri] = doc
 	return doc
@@ -135,6 +153,9 @@ func parseDocument(text string) *ppi.Document {
 
 func (s *Server) initialize(_ *glsp.Context, params *protocol.InitializeParams) (any, error) {
 	s.logger.Debug("initialize request")
+	s.workspaceMu.Lock()
+	s.createFiles = canCreateFiles(params.Capabilities)
+	s.workspaceMu.Unlock()
 	s.initWorkspaceIndex(params)
 	capabilities := s.handler.CreateServerCapabilities()
 
@@ -150,6 +171,12 @@ func (s *Server) initialize(_ *glsp.Context, params *protocol.InitializeParams)
 	capabilities.CompletionProvider = &protocol.CompletionOptions{
 		TriggerCharacters: []string{"$", "@", "%", ">"},
 	}
+	capabilities.Workspace = &protocol.ServerCapabilitiesWorkspace{
+		WorkspaceFolders: &protocol.WorkspaceFoldersServerCapabilities{
+			Supported:           &protocol.True,
+			ChangeNotifications: &protocol.BoolOrString{Value: true},
+		},
+	}
 
 	return protocol.InitializeResult{
 		Capabilities: capabilities,
@@ -273,6 +300,7 @@ func (s *Server) hover(_ *glsp.Context, params *protocol.HoverParams) (*protocol
 		s.logger.Debug("hover skipped: no document")
 		return nil, nil
 	}
+	doc = s.withWorkspaceSigs(doc, params.TextDocument.URI)
 
 	offset := params.Position.IndexIn(doc.text)
 	tokenIdx := tokenIndexAtOffset(doc.parsed.Tokens, offset)
@@ -302,6 +330,19 @@ func (s *Server) hover(_ *glsp.Context, params *protocol.HoverParams) (*protocol
 	}
 	if content == "" {
 		content = hoverContentForNode(node)
+		if content != "" && analysis.IsPragmaStatement(node) {
+			content += "\n" + pragmaHover(doc.parsed, node)
+		}
+	}
+	if content == "" && token.Type == ppi.TokenWord {
+		if class, name, super, ok := methodCallAt(doc, tokenIdx, offset); ok {
+			if target, ok := s.resolveMethod(doc, params.TextDocument.URI, class, name, super); ok {
+				content = target.hoverContent(doc.text)
+			}
+		}
+	}
+	if content == "" && token.Type == ppi.TokenWord {
+		content = subSigHover(doc, token.Value)
 	}
 	if content == "" {
 		content = fmt.Sprintf("%s: %s", token.Type, token.Value)
@@ -322,6 +363,22 @@ func (s *Server) hover(_ *glsp.Context, params *protocol.HoverParams) (*protocol
 	}, nil
 }
 
+// subSigHover renders the :SIG of a called sub that is defined in another
+// file.
+func subSigHover(doc *documentData, name string) string {
+	if doc == nil || doc.funcSig == nil || findDefinition(doc.parsed.Root, name) != nil {
+		return ""
+	}
+	sig := doc.funcSig(name)
+	if sig == "" {
+		return ""
+	}
+	if t, err := analysis.ParseSig(sig); err == nil {
+		sig = t.String()
+	}
+	return strings.Join([]string{"```perl", "sub " + name, "```", "type: " + sig}, "\n")
+}
+
 func hoverVarSigType(doc *documentData, offset int, name string, logger *slog.Logger) string {
 	sig := varTypeSigAt(doc, offset, name)
 	if sig == "" {
@@ -333,9 +390,30 @@ func hoverVarSigType(doc *documentData, offset int, name string, logger *slog.Lo
 	if logger != nil {
 		logger.Debug("hover sig resolved", "name", name, "sig", sig)
 	}
+	if t, err := analysis.ParseSig(sig); err == nil {
+		sig = t.String()
+		if expanded := expandTypeAliases(doc, offset, t); expanded != sig {
+			sig += " = " + expanded
+		}
+	}
 	return sig
 }
 
+// expandTypeAliases returns t with its :TYPE aliases expanded, as seen from
+// offset, or "" when an alias cannot be expanded.
+func expandTypeAliases(doc *documentData, offset int, t analysis.Type) string {
+	aliases := doc.typeAlias
+	if aliases == nil {
+		aliases = analysis.DocumentAliases(doc.parsed, nil)
+	}
+	scope := analysis.SigScope{Package: analysis.PackageLookup(doc.parsed)(offset), Alias: aliases}
+	expanded, err := scope.Expand(t)
+	if err != nil {
+		return ""
+	}
+	return expanded.String()
+}
+
 func varTypeSigAt(doc *documentData, offset int, name string) string {
 	if doc == nil || doc.parsed == nil || doc.index == nil {
 		return ""
@@ -348,8 +426,11 @@ func varTypeSigAt(doc *documentData, offset int, name string) string {
 	default:
 		return ""
 	}
+	if narrowed := narrowedTypeAt(doc, offset, name); narrowed != "" {
+		return narrowed
+	}
 	sig := varSigTypeAt(doc, offset, name)
-	if sig != "" && strings.Contains(sig, "->") {
+	if sig != "" && isFuncSig(sig) {
 		if arg := sigArgTypeAt(doc, offset, name); arg != "" {
 			return arg
 		}
@@ -358,7 +439,7 @@ func varTypeSigAt(doc *documentData, offset int, name string) string {
 	if sig == "" {
 		sig = sigArgTypeAt(doc, offset, name)
 	}
-	if strings.Contains(sig, "->") {
+	if isFuncSig(sig) {
 		return ""
 	}
 	if sig == "" {
@@ -393,7 +474,7 @@ func sigArgTypeAt(doc *documentData, offset int, name string) string {
 		return ""
 	}
 	sig := sigCommentBeforeOffset(doc.text, start)
-	if sig == "" || !strings.Contains(sig, "->") {
+	if sig == "" || !isFuncSig(sig) {
 		return ""
 	}
 	args, err := analysis.ParseSigArgs(sig)
@@ -420,7 +501,7 @@ func sigArgTypeAt(doc *documentData, offset int, name string) string {
 			if subStart, subEnd, ok := subNodeRange(node); ok {
 				if ai, ok := argIndexFromAssignments(doc.parsed.Tokens, subStart, subEnd, offset, name); ok {
 					if ai >= 0 && ai < len(args) {
-						return args[ai]
+						return args[ai].VarType().String()
 					}
 				}
 			}
@@ -428,13 +509,13 @@ func sigArgTypeAt(doc *documentData, offset int, name string) string {
 		if len(args) > 0 && doc.index != nil {
 			if receivers := doc.index.ReceiverNamesAt(offset); receivers != nil {
 				if _, ok := receivers[name]; ok {
-					return args[0]
+					return args[0].VarType().String()
 				}
 			}
 		}
 		return ""
 	}
-	return args[idx]
+	return args[idx].VarType().String()
 }
 
 func argIndexFromAssignments(tokens []ppi.Token, start, end, offset int, name string) (int, bool) {
@@ -523,6 +604,17 @@ func varReturnTypeFromAssignment(doc *documentData, offset int, name string) str
 	if assignIdx < 0 {
 		return ""
 	}
+	if class, method, ok := methodCallFromAssignment(doc, assignIdx+1, endIdx, name); ok {
+		if ret := methodReturnType(doc, class, method); ret != "" {
+			return ret
+		}
+		if method == "new" {
+			return class
+		}
+	}
+	if class := blessTarget(doc, assignIdx+1, endIdx); class != "" {
+		return class
+	}
 	callName := callNameFromAssignment(doc.parsed.Tokens, assignIdx+1, endIdx)
 	if callName == "" {
 		return ""
@@ -530,6 +622,66 @@ func varReturnTypeFromAssignment(doc *documentData, offset int, name string) str
 	return subReturnType(doc, callName)
 }
 
+// methodCallFromAssignment returns the class and method of a right-hand
+// side such as Class->method(...), __PACKAGE__->method(...) or
+// $obj->method(...), where $obj has a known class. name is the variable
+// being assigned, which cannot be its own receiver.
+func methodCallFromAssignment(doc *documentData, start, end int, name string) (string, string, bool) {
+	tokens := doc.parsed.Tokens
+	i := nextNonTriviaTokenLocal(tokens, start)
+	if i < 0 || i >= end {
+		return "", "", false
+	}
+	arrow := nextNonTriviaTokenLocal(tokens, i+1)
+	if arrow < 0 || arrow >= end || tokens[arrow].Type != ppi.TokenOperator || tokens[arrow].Value != "->" {
+		return "", "", false
+	}
+	method := nextNonTriviaTokenLocal(tokens, arrow+1)
+	if method < 0 || method >= end || tokens[method].Type != ppi.TokenWord || !isIdent(tokens[method].Value) {
+		return "", "", false
+	}
+	recv := tokens[i]
+	switch recv.Type {
+	case ppi.TokenWord:
+		if recv.Value == "__PACKAGE__" {
+			pkg := analysis.PackageLookup(doc.parsed)(recv.Start)
+			if pkg == "" {
+				pkg = "main"
+			}
+			return pkg, tokens[method].Value, true
+		}
+		if isClassName(recv.Value) {
+			return recv.Value, tokens[method].Value, true
+		}
+	case ppi.TokenSymbol:
+		if recv.Value == name {
+			return "", "", false
+		}
+		if class, ok := classNameFromSig(varTypeSigAt(doc, recv.Start, recv.Value)); ok {
+			return class, tokens[method].Value, true
+		}
+	}
+	return "", "", false
+}
+
+func methodReturnType(doc *documentData, class, method string) string {
+	if doc.methodSig == nil {
+		return ""
+	}
+	sig := doc.methodSig(class, method)
+	if sig == "" || !isFuncSig(sig) {
+		return ""
+	}
+	ret, err := analysis.ParseSigReturn(sig)
+	if err != nil || len(ret) != 1 || ret[0].Slurpy {
+		return ""
+	}
+	if class, ok := analysis.ClassName(ret[0].Type); ok {
+		return class
+	}
+	return ""
+}
+
 func callNameFromAssignment(tokens []ppi.Token, start, end int) string {
 	i := nextNonTriviaTokenLocal(tokens, start)
 	if i < 0 || i >= end {
@@ -572,22 +724,25 @@ func subReturnType(doc *documentData, name string) string {
 			sub = n
 		}
 	})
-	if sub == nil {
-		return ""
-	}
-	start, ok := nodeFirstNonTriviaStart(sub)
-	if !ok {
-		return ""
+	sig := ""
+	if sub != nil {
+		if start, ok := nodeFirstNonTriviaStart(sub); ok {
+			sig = sigCommentBeforeOffset(doc.text, start)
+		}
+		if sig == "" {
+			return blessedReturnClass(doc, sub)
+		}
+	} else if doc.funcSig != nil {
+		sig = doc.funcSig(name)
 	}
-	sig := sigCommentBeforeOffset(doc.text, start)
-	if sig == "" || !strings.Contains(sig, "->") {
+	if sig == "" || !isFuncSig(sig) {
 		return ""
 	}
 	ret, err := analysis.ParseSigReturn(sig)
-	if err != nil || len(ret) != 1 {
+	if err != nil || len(ret) != 1 || ret[0].Slurpy {
 		return ""
 	}
-	if class, ok := classNameFromSig(ret[0]); ok {
+	if class, ok := analysis.ClassName(ret[0].Type); ok {
 		return class
 	}
 	return ""
@@ -877,6 +1032,7 @@ func (s *Server) definition(_ *glsp.Context, params *protocol.DefinitionParams)
 		s.logger.Debug("definition skipped: no document")
 		return nil, nil
 	}
+	doc = s.withWorkspaceSigs(doc, params.TextDocument.URI)
 	if path, ok := uriToPath(params.TextDocument.URI); ok {
 		s.ensureUseLibPaths(doc.parsed.Root, path)
 	}
@@ -915,6 +1071,15 @@ func (s *Server) definition(_ *glsp.Context, params *protocol.DefinitionParams)
 		return nil, nil
 	}
 
+	if class, name, super, ok := methodCallAt(doc, tokenIdx, offset); ok {
+		if target, ok := s.resolveMethod(doc, params.TextDocument.URI, class, name, super); ok {
+			if locations := target.locations(doc.text, params.TextDocument.URI); len(locations) > 0 {
+				s.logger.Debug("definition resolved (method)", "name", name, "class", class, "package", target.pkg)
+				return locations, nil
+			}
+		}
+	}
+
 	name, qualified := qualifiedNameAt(doc.parsed.Tokens, tokenIdx)
 	def := findDefinition(doc.parsed.Root, name)
 	if def == nil {
@@ -922,7 +1087,7 @@ func (s *Server) definition(_ *glsp.Context, params *protocol.DefinitionParams)
 			s.logger.Debug("definition resolved (module)", "name", name)
 			return []protocol.Location{loc}, nil
 		}
-		pkg := doc.parsed.PackageAt(offset)
+		pkg := analysis.PackageLookup(doc.parsed)(offset)
 		useImports := collectUseImports(doc.parsed.Root)
 		defs, err := s.findWorkspaceDefinitions(name, params.TextDocument.URI, pkg, useImports, qualified)
 		if err != nil {
@@ -973,6 +1138,7 @@ func (s *Server) typeDefinition(_ *glsp.Context, params *protocol.TypeDefinition
 		s.logger.Debug("typeDefinition skipped: no document")
 		return nil, nil
 	}
+	doc = s.withWorkspaceSigs(doc, params.TextDocument.URI)
 
 	offset := params.Position.IndexIn(doc.text)
 	tokenIdx := tokenIndexAtOffset(doc.parsed.Tokens, offset)
@@ -1022,6 +1188,7 @@ func (s *Server) completion(_ *glsp.Context, params *protocol.CompletionParams)
 		s.logger.Debug("completion skipped: no document")
 		return nil, nil
 	}
+	doc = s.withWorkspaceSigs(doc, params.TextDocument.URI)
 
 	offset := params.Position.IndexIn(doc.text)
 	if methodPrefix, start, recv, ok := methodPrefixAt(doc.text, offset); ok {
@@ -1032,8 +1199,7 @@ func (s *Server) completion(_ *glsp.Context, params *protocol.CompletionParams)
 			}
 		}
 		if pkg != "" {
-			methods := methodsForPackage(doc.parsed, pkg)
-			methods = append(methods, s.methodsForPackageWorkspace(pkg, params.TextDocument.URI)...)
+			methods := s.methodsForClass(doc, params.TextDocument.URI, pkg)
 			items := methodCompletionItems(methods, methodPrefix, doc.text, start, offset)
 			s.logger.Debug("completion resolved", "prefix", methodPrefix, "count", len(items), "method", true, "package", pkg, "receiver", recv)
 			return protocol.CompletionList{
@@ -1219,6 +1385,27 @@ func nodeTokenRange(n *ppi.Node) (int, int, bool) {
 	return start, end, found
 }
 
+// pragmaHover renders the pragmas in effect after the use or no statement
+// node.
+func pragmaHover(doc *ppi.Document, node *ppi.Node) string {
+	_, end, ok := nodeTokenRange(node)
+	if !ok {
+		return ""
+	}
+	state := analysis.PragmasAt(doc, end)
+	features := "none"
+	if list := state.FeatureList(); len(list) > 0 {
+		features = strings.Join(list, ", ")
+	}
+	onOff := func(on bool) string {
+		if on {
+			return "on"
+		}
+		return "off"
+	}
+	return "features: " + features + "\nstrict: " + onOff(state.Strict) + "\nwarnings: " + onOff(state.Warnings)
+}
+
 func hoverContentForNode(node *ppi.Node) string {
 	if node == nil {
 		return ""
@@ -1634,44 +1821,40 @@ func (s *Server) moduleSearchPathsWithOptions(root *ppi.Node, filePath, baseDir
 		base = s.projectBaseForFile(filePath)
 	}
 	paths := collectUseLibPathsWithBase(root, filePath, base)
+	var libRoots []string
 	s.workspaceMu.RLock()
-	workspaceRoots := append([]string{}, s.workspaceRoots...)
+	if folder := s.folderForPathLocked(filePath); folder != nil {
+		libRoots = append(libRoots, folder.libRoots...)
+	}
 	s.workspaceMu.RUnlock()
-	paths = append(paths, workspaceRoots...)
+	paths = append(paths, libRoots...)
 	if includePerlINC {
-		s.workspaceMu.RLock()
-		incRoots := append([]string{}, s.incRoots...)
-		s.workspaceMu.RUnlock()
-		if len(incRoots) == 0 {
-			roots, err := perlINCPaths()
-			if err != nil {
-				s.logger.Debug("perl @INC lookup failed", "error", err)
-			} else {
-				incRoots = roots
-			}
-		}
-		paths = append(paths, incRoots...)
+		paths = append(paths, s.incRootsForPath(filePath)...)
 	}
 	paths = filterExistingRoots(paths, s.logger)
 	return uniqueStrings(paths)
 }
 
-func findModuleFile(name string, roots []string) string {
-	if name == "" || len(roots) == 0 {
-		return ""
+// incRootsForPath returns the @INC of the perl of the folder containing
+// filePath, or nil when it cannot be found out. A folder without @INC of
+// its own asks perlINC, so that perl runs once per interpreter.
+func (s *Server) incRootsForPath(filePath string) []string {
+	var incRoots []string
+	perl := defaultPerl
+	s.workspaceMu.RLock()
+	if folder := s.folderForPathLocked(filePath); folder != nil {
+		incRoots = append(incRoots, folder.incRoots...)
+		perl = folder.perl.perl
 	}
-	rel := strings.ReplaceAll(name, "::", string(os.PathSeparator)) + ".pm"
-	for _, root := range roots {
-		if root == "" {
-			continue
-		}
-		path := filepath.Join(root, rel)
-		info, err := os.Stat(path)
-		if err == nil && !info.IsDir() {
-			return path
-		}
+	s.workspaceMu.RUnlock()
+	if len(incRoots) > 0 {
+		return incRoots
 	}
-	return ""
+	return s.perlINC(perl)
+}
+
+func findModuleFile(name string, roots []string) string {
+	return analysis.FindModuleFile(name, roots)
 }
 
 func hasDefaultTag(imports map[string]struct{}) bool {
@@ -1916,35 +2099,47 @@ func methodsForPackage(doc *ppi.Document, pkg string) []string {
 		seen[n.Name] = struct{}{}
 		out = append(out, n.Name)
 	})
+	for _, class := range analysis.CollectClasses(doc) {
+		if class.Name != pkg {
+			continue
+		}
+		for _, m := range class.Methods {
+			if _, ok := seen[m.Name]; ok {
+				continue
+			}
+			seen[m.Name] = struct{}{}
+			out = append(out, m.Name)
+		}
+	}
+	for _, acc := range analysis.CollectAccessors(doc) {
+		if acc.Package != pkg {
+			continue
+		}
+		if _, ok := seen[acc.Name]; ok {
+			continue
+		}
+		seen[acc.Name] = struct{}{}
+		out = append(out, acc.Name)
+	}
 	return out
 }
 
 func (s *Server) methodsForPackageWorkspace(pkg string, uri protocol.DocumentUri) []string {
-	s.workspaceMu.RLock()
-	index := s.workspaceIndex
-	s.workspaceMu.RUnlock()
+	index := s.workspaceIndexFor(uri)
 	if index == nil || pkg == "" {
 		return nil
 	}
-	prefix := pkg + "::"
 	seen := make(map[string]struct{})
 	out := []string{}
 	exclude := ""
 	if path, ok := uriToPath(uri); ok {
 		exclude = path
 	}
-	for full, defs := range index.SubsByFull {
-		if !strings.HasPrefix(full, prefix) {
-			continue
-		}
+	for name, defs := range index.PackageSubs(pkg) {
 		for _, def := range defs {
 			if exclude != "" && def.File == exclude {
 				continue
 			}
-			name := strings.TrimPrefix(full, prefix)
-			if name == "" {
-				continue
-			}
 			if _, ok := seen[name]; ok {
 				continue
 			}
@@ -2002,25 +2197,23 @@ func isMethodChar(ch byte) bool {
 		ch == '_'
 }
 
-func classNameFromSig(sig string) (string, bool) {
-	s := strings.TrimSpace(sig)
-	if s == "" {
-		return "", false
-	}
-	if strings.Contains(s, "->") {
-		return "", false
-	}
-	switch s {
-	case "any", "int", "undef", "void":
-		return "", false
+// isFuncSig reports whether sig is a function signature rather than a
+// value type such as code[A -> R].
+func isFuncSig(sig string) bool {
+	t, err := analysis.ParseSig(sig)
+	if err != nil {
+		return strings.Contains(sig, "->")
 	}
-	if strings.HasPrefix(s, "array[") || strings.HasPrefix(s, "hash[") {
+	_, ok := t.(*analysis.FuncType)
+	return ok
+}
+
+func classNameFromSig(sig string) (string, bool) {
+	t, err := analysis.ParseSig(sig)
+	if err != nil {
 		return "", false
 	}
-	if isClassName(s) {
-		return s, true
-	}
-	return "", false
+	return analysis.ClassName(t)
 }
 
 func isClassName(s string) bool {
@@ -2074,7 +2267,7 @@ func perlBuiltins() []string {
 		"closedir", "connect", "cos", "crypt", "dbmclose", "dbmopen", "defined",
 		"delete", "die", "do", "dump", "each", "endgrent", "endhostent",
 		"endnetent", "endprotoent", "endpwent", "endservent", "eof", "eval",
-		"exec", "exists", "exit", "exp", "fcntl", "fileno", "flock", "fork",
+		"evalbytes", "exec", "exists", "exit", "exp", "fc", "fcntl", "fileno", "flock", "fork",
 		"format", "formline", "getc", "getgrent", "getgrgid", "getgrnam",
 		"gethostbyaddr", "gethostbyname", "gethostent", "getlogin",
 		"getnetbyaddr", "getnetbyname", "getnetent", "getpeername",
@@ -2084,7 +2277,7 @@ func perlBuiltins() []string {
 		"getsockname", "getsockopt", "glob", "gmtime", "goto", "grep",
 		"hex", "index", "int", "ioctl", "join", "keys", "kill", "last",
 		"lc", "lcfirst", "length", "link", "listen", "local", "localtime",
-		"log", "lstat", "map", "mkdir", "msgctl", "msgget", "msgrcv",
+		"lock", "log", "lstat", "map", "mkdir", "msgctl", "msgget", "msgrcv",
 		"msgsnd", "my", "next", "oct", "open", "opendir", "ord", "pack",
 		"pipe", "pop", "pos", "print", "printf", "prototype", "push",
 		"quotemeta", "rand", "read", "readdir", "readline", "readlink",
@@ -2095,7 +2288,7 @@ func perlBuiltins() []string {
 		"setprotoent", "setpwent", "setservent", "setsockopt", "shift",
 		"shmctl", "shmget", "shmread", "shmwrite", "shutdown", "sin",
 		"sleep", "socket", "socketpair", "sort", "splice", "split", "sprintf",
-		"srand", "stat", "state", "study", "substr", "symlink", "syscall",
+		"sqrt", "srand", "stat", "state", "study", "substr", "symlink", "syscall",
 		"sysopen", "sysread", "sysseek", "system", "syswrite", "tell",
 		"telldir", "tie", "tied", "time", "times", "truncate", "uc",
 		"ucfirst", "umask", "undef", "unlink", "unpack", "unshift", "untie",
@@ -2121,8 +2314,15 @@ func (s *Server) publishDiagnostics(context *glsp.Context, uri protocol.Document
 		version = doc.version
 		diagnostics = toProtocolDiagnostics(doc.text, doc.parsed)
 		diagnostics = append(diagnostics, s.toStrictVarDiagnostics(uri, doc.text, doc.parsed)...)
-		diagnostics = append(diagnostics, sigDiagnostics(doc.text)...)
-		diagnostics = append(diagnostics, toSigCallDiagnostics(doc.text, doc.parsed)...)
+		diagnostics = append(diagnostics, toFeatureDiagnostics(doc.text, doc.parsed)...)
+		diagnostics = append(diagnostics, toWarningDiagnostics(doc.text, doc.parsed)...)
+		diagnostics = append(diagnostics, toUnusedDiagnostics(doc.text, doc.parsed)...)
+		diagnostics = append(diagnostics, s.toUndefinedDiagnostics(uri, doc)...)
+		diagnostics = append(diagnostics, s.toHashKeyDiagnostics(uri, doc)...)
+		diagnostics = append(diagnostics, s.toHygieneDiagnostics(uri, doc)...)
+		diagnostics = append(diagnostics, s.toUnresolvedModuleDiagnostics(uri, doc)...)
+		diagnostics = append(diagnostics, sigDiagnostics(doc.text, s.sigScope(uri, doc.parsed))...)
+		diagnostics = append(diagnostics, s.toSigCallDiagnostics(uri, doc.text, doc.parsed)...)
 	}
 	diagnostics = append(diagnostics, s.getCompileDiagnostics(string(uri))...)
 
@@ -2142,7 +2342,10 @@ func (s *Server) publishDiagnostics(context *glsp.Context, uri protocol.Document
 	}
 }
 
-func sigDiagnostics(text string) []protocol.Diagnostic {
+// sigDiagnostics validates the :SIG and :TYPE comments of text. scope,
+// when not nil, gives the alias and class scope at an offset, so that
+// aliases are expanded and unknown type names reported.
+func sigDiagnostics(text string, scope func(offset int) analysis.SigScope) []protocol.Diagnostic {
 	var out []protocol.Diagnostic
 	if text == "" {
 		return nil
@@ -2158,29 +2361,59 @@ func sigDiagnostics(text string) []protocol.Diagnostic {
 		}
 		line := text[lineStart:lineEnd]
 		trim := strings.TrimSpace(line)
+		report := func(start int, msg string) {
+			out = append(out, protocol.Diagnostic{
+				Range:    protocol.Range{Start: positionFromOffset(text, start), End: positionFromOffset(text, lineEnd)},
+				Severity: &sev,
+				Source:   &source,
+				Message:  msg,
+			})
+		}
 		if body, ok := strings.CutPrefix(trim, "#"); ok {
 			body = strings.TrimSpace(body)
-			if strings.HasPrefix(body, ":SIG") {
+			for _, kind := range []string{":SIG", ":TYPE"} {
+				if !strings.HasPrefix(body, kind) {
+					continue
+				}
 				open := strings.IndexByte(body, '(')
 				closeIdx := strings.LastIndexByte(body, ')')
 				if open < 0 || closeIdx < open+1 {
-					out = append(out, protocol.Diagnostic{
-						Range:    protocol.Range{Start: positionFromOffset(text, lineStart), End: positionFromOffset(text, lineEnd)},
-						Severity: &sev,
-						Source:   &source,
-						Message:  "invalid :SIG(...)",
-					})
+					report(lineStart, "invalid "+kind+"(...)")
+					break
+				}
+				raw := body[open+1 : closeIdx]
+				var err error
+				errStart := lineStart + strings.Index(line, body) + open + 1
+				if kind == ":SIG" {
+					sig := strings.TrimSpace(raw)
+					errStart += len(raw) - len(strings.TrimLeft(raw, " \t"))
+					if scope != nil {
+						err = analysis.ValidateSigInScope(sig, scope(lineStart+strings.IndexByte(line, '#')))
+					} else {
+						err = analysis.ValidateSig(sig)
+					}
 				} else {
-					sig := strings.TrimSpace(body[open+1 : closeIdx])
-					if err := analysis.ValidateSig(sig); err != nil {
-						out = append(out, protocol.Diagnostic{
-							Range:    protocol.Range{Start: positionFromOffset(text, lineStart), End: positionFromOffset(text, lineEnd)},
-							Severity: &sev,
-							Source:   &source,
-							Message:  "invalid :SIG(...): " + err.Error(),
-						})
+					var name, sig string
+					var sigStart int
+					name, sig, sigStart, err = analysis.ParseTypeDecl(raw)
+					if err == nil && scope != nil {
+						sc := scope(lineStart + strings.IndexByte(line, '#'))
+						if err = analysis.ValidateSigInScope(sig, sc); err != nil {
+							errStart += sigStart
+						} else if _, err = sc.Expand(analysis.ClassType{Name: name}); err != nil {
+							errStart += len(raw) - len(strings.TrimLeft(raw, " \t"))
+						}
+					}
+				}
+				if err != nil {
+					start := lineStart
+					var sigErr *analysis.SigError
+					if errors.As(err, &sigErr) {
+						start = min(errStart+sigErr.Offset, lineEnd)
 					}
+					report(start, "invalid "+kind+"(...): "+err.Error())
 				}
+				break
 			}
 		}
 		if lineEnd >= len(text) {
@@ -2191,18 +2424,69 @@ func sigDiagnostics(text string) []protocol.Diagnostic {
 	return out
 }
 
-func toSigCallDiagnostics(text string, doc *ppi.Document) []protocol.Diagnostic {
+// sigScope returns the :SIG name scope at each offset of doc: its :TYPE
+// aliases and, with a workspace index, those of other files and the set
+// of known classes.
+func (s *Server) sigScope(uri protocol.DocumentUri, doc *ppi.Document) func(offset int) analysis.SigScope {
+	index := s.workspaceIndexFor(uri)
+	var next func(string) (analysis.TypeAlias, bool)
+	var known func(string) bool
+	if index != nil {
+		next = index.FindTypeAlias
+		local := make(map[string]struct{})
+		walkNodes(doc.Root, func(n *ppi.Node) {
+			if n != nil && n.Kind == "statement::package" && n.Name != "" {
+				local[n.Name] = struct{}{}
+			}
+		})
+		for _, class := range analysis.CollectClasses(doc) {
+			local[class.Name] = struct{}{}
+		}
+		known = func(class string) bool {
+			if _, ok := local[class]; ok {
+				return true
+			}
+			return len(index.FindPackages(class, "")) > 0
+		}
+	}
+	aliases := analysis.DocumentAliases(doc, next)
+	return func(offset int) analysis.SigScope {
+		return analysis.SigScope{Package: analysis.CommentPackage(doc, offset), Alias: aliases, Known: known}
+	}
+}
+
+func (s *Server) toSigCallDiagnostics(uri protocol.DocumentUri, text string, doc *ppi.Document) []protocol.Diagnostic {
 	if doc == nil {
 		return nil
 	}
-	diags := analysis.SigCallDiagnostics(doc)
-	if len(diags) == 0 {
+	path, _ := uriToPath(uri)
+	var cfg config
+	var index *analysis.WorkspaceIndex
+	s.workspaceMu.RLock()
+	if folder := s.folderForPathLocked(path); folder != nil {
+		cfg = folder.config
+		index = folder.index
+	}
+	s.workspaceMu.RUnlock()
+	typeSev, typeCheck := cfg.typeCheckSeverity()
+	opts := analysis.SigCheckOptions{SkipTypes: !typeCheck}
+	if index != nil {
+		opts.Parents = index.PackageParents
+		opts.Aliases = index.FindTypeAlias
+		opts.SubSig = workspaceSubSig(index, path)
+		opts.FuncSig = s.workspaceFuncSig(uri, doc.Root)
+	}
+	diags := analysis.SigCallDiagnosticsWithOptions(doc, opts)
+	returns := analysis.SigReturnDiagnosticsWithOptions(doc, opts)
+	if len(diags) == 0 && len(returns) == 0 {
 		return nil
 	}
-	out := make([]protocol.Diagnostic, 0, len(diags))
+	out := make([]protocol.Diagnostic, 0, len(diags)+len(returns))
 	source := "perl-lsp"
-	sev := protocol.DiagnosticSeverityError
-	for _, diag := range diags {
+	add := func(diag analysis.CallDiagnostic, sev protocol.DiagnosticSeverity) {
+		if diag.TypeMismatch {
+			sev = typeSev
+		}
 		rng := diagnosticRange(text, diag.Offset)
 		out = append(out, protocol.Diagnostic{
 			Range:    rng,
@@ -2211,9 +2495,89 @@ func toSigCallDiagnostics(text string, doc *ppi.Document) []protocol.Diagnostic
 			Message:  diag.Message,
 		})
 	}
+	for _, diag := range diags {
+		add(diag, protocol.DiagnosticSeverityError)
+	}
+	// Return values that disagree with the :SIG are often intentional
+	// shortcuts, so they are only warnings.
+	for _, diag := range returns {
+		add(diag, protocol.DiagnosticSeverityWarning)
+	}
 	return out
 }
 
+// workspaceSubSig looks up subs in the workspace index, outside the file at
+// exclude, and returns the :SIG recorded for their definition.
+func workspaceSubSig(index *analysis.WorkspaceIndex, exclude string) func(pkg, name string) (string, bool) {
+	return func(pkg, name string) (string, bool) {
+		defs := index.FindSubsFull(pkg+"::"+name, exclude)
+		if len(defs) == 0 {
+			return "", false
+		}
+		return defs[0].Sig, true
+	}
+}
+
+// workspaceFuncSig returns a resolver for the :SIG of subs that are
+// imported into the document or called by their fully qualified name.
+func (s *Server) workspaceFuncSig(uri protocol.DocumentUri, root *ppi.Node) func(name string) string {
+	imports := collectUseImports(root)
+	cache := make(map[string]string)
+	return func(name string) string {
+		if sig, ok := cache[name]; ok {
+			return sig
+		}
+		sig := ""
+		defs, _ := s.findWorkspaceDefinitions(name, uri, "", imports, false)
+		for _, def := range defs {
+			if def.Kind == analysis.SymbolSub && def.Sig != "" {
+				sig = def.Sig
+				break
+			}
+		}
+		cache[name] = sig
+		return sig
+	}
+}
+
+// withWorkspaceSigs returns a copy of doc that resolves the :SIG of subs
+// and methods defined in other files through the workspace index.
+func (s *Server) withWorkspaceSigs(doc *documentData, uri protocol.DocumentUri) *documentData {
+	if doc == nil || doc.parsed == nil {
+		return doc
+	}
+	out := *doc
+	if index := s.workspaceIndexFor(uri); index != nil {
+		out.funcSig = s.workspaceFuncSig(uri, doc.parsed.Root)
+		out.typeAlias = analysis.DocumentAliases(doc.parsed, index.FindTypeAlias)
+	}
+	out.methodSig = func(class, name string) string {
+		target, ok := s.resolveMethod(doc, uri, class, name, false)
+		if !ok {
+			return ""
+		}
+		if target.accessor != nil {
+			return target.accessor.Sig
+		}
+		if target.classMethod != nil {
+			return sigCommentBeforeOffset(doc.text, target.classMethod.BodyStart)
+		}
+		if target.local != nil {
+			if start, ok := nodeFirstNonTriviaStart(target.local); ok {
+				return sigCommentBeforeOffset(doc.text, start)
+			}
+			return ""
+		}
+		for _, def := range target.defs {
+			if def.Sig != "" {
+				return def.Sig
+			}
+		}
+		return ""
+	}
+	return &out
+}
+
 func toProtocolDiagnostics(text string, doc *ppi.Document) []protocol.Diagnostic {
 	if doc == nil {
 		return nil
@@ -2267,6 +2631,46 @@ func (s *Server) toStrictVarDiagnostics(uri protocol.DocumentUri, text string, d
 	return out
 }
 
+// toFeatureDiagnostics reports syntax used without its feature enabled.
+func toFeatureDiagnostics(text string, doc *ppi.Document) []protocol.Diagnostic {
+	diags := analysis.FeatureDiagnostics(doc)
+	if len(diags) == 0 {
+		return nil
+	}
+	out := make([]protocol.Diagnostic, 0, len(diags))
+	source := "perl-lsp"
+	sev := protocol.DiagnosticSeverityWarning
+	for _, diag := range diags {
+		out = append(out, protocol.Diagnostic{
+			Range:    diagnosticRange(text, diag.Offset),
+			Severity: &sev,
+			Source:   &source,
+			Message:  diag.Message,
+		})
+	}
+	return out
+}
+
+// toWarningDiagnostics reports the perl -w warnings found statically.
+func toWarningDiagnostics(text string, doc *ppi.Document) []protocol.Diagnostic {
+	diags := analysis.WarningDiagnostics(doc)
+	if len(diags) == 0 {
+		return nil
+	}
+	out := make([]protocol.Diagnostic, 0, len(diags))
+	source := "perl-lsp"
+	sev := protocol.DiagnosticSeverityWarning
+	for _, diag := range diags {
+		out = append(out, protocol.Diagnostic{
+			Range:    diagnosticRange(text, diag.Offset),
+			Severity: &sev,
+			Source:   &source,
+			Message:  diag.Message,
+		})
+	}
+	return out
+}
+
 func diagnosticRange(text string, offset int) protocol.Range {
 	start := positionFromOffset(text, offset)
 	endOffset := offset
@@ -2285,30 +2689,38 @@ func toUIntegerPtr(version protocol.Integer) *protocol.UInteger {
 	return &u
 }
 
+// canCreateFiles reports whether the client applies workspace edits with
+// document changes that create files.
+func canCreateFiles(caps protocol.ClientCapabilities) bool {
+	if caps.Workspace == nil || caps.Workspace.WorkspaceEdit == nil {
+		return false
+	}
+	edit := caps.Workspace.WorkspaceEdit
+	if edit.DocumentChanges == nil || !*edit.DocumentChanges {
+		return false
+	}
+	return slices.Contains(edit.ResourceOperations, protocol.ResourceOperationKindCreate)
+}
+
 func (s *Server) initWorkspaceIndex(params *protocol.InitializeParams) {
+	if params != nil {
+		settings, err := parseConfig(params.InitializationOptions)
+		if err != nil {
+			s.logger.Debug("initializationOptions ignored", "error", err)
+		}
+		s.workspaceMu.Lock()
+		s.settings = settings
+		s.workspaceMu.Unlock()
+	}
 	roots := workspaceRoots(params)
 	s.logger.Debug("workspace roots", "roots", roots)
-	baseRoots := filterExistingRoots(defaultLibRoots(roots), s.logger)
-	incRoots, err := perlINCPaths()
-	if err != nil {
-		s.logger.Debug("perl @INC lookup failed", "error", err)
-	}
-
-	s.workspaceMu.Lock()
-	s.projectRoots = roots
-	s.workspaceRoots = baseRoots
-	s.incRoots = incRoots
-	if s.extraRoots == nil {
-		s.extraRoots = make(map[string]struct{})
+	if len(roots) == 0 {
+		// Without a workspace, keep a rootless folder so that @INC is still indexed.
+		roots = []string{""}
 	}
-	s.workspaceMu.Unlock()
-
-	merged := uniqueStrings(append(append([]string{}, baseRoots...), incRoots...))
-	if len(merged) == 0 {
-		s.logger.Debug("workspace index skipped: no roots")
-		return
+	for _, root := range roots {
+		s.addWorkspaceFolder(root, "initialize")
 	}
-	s.startWorkspaceIndexBuild(merged, "initialize")
 }
 
 func workspaceRoots(params *protocol.InitializeParams) []string {
@@ -2334,22 +2746,26 @@ func workspaceRoots(params *protocol.InitializeParams) []string {
 	return roots
 }
 
-func defaultLibRoots(roots []string) []string {
-	var out []string
-	for _, root := range roots {
-		if root == "" {
+func defaultLibRoots(root string, dirs []string) []string {
+	if root == "" {
+		return nil
+	}
+	out := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		if dir == "" {
+			continue
+		}
+		if filepath.IsAbs(dir) {
+			out = append(out, dir)
 			continue
 		}
-		out = append(out, filepath.Join(root, "lib"))
-		out = append(out, filepath.Join(root, "local", "lib", "perl5"))
+		out = append(out, filepath.Join(root, dir))
 	}
 	return out
 }
 
 func (s *Server) findWorkspaceDefinitions(name string, uri protocol.DocumentUri, pkg string, useImports map[string]map[string]struct{}, qualified bool) ([]analysis.Definition, error) {
-	s.workspaceMu.RLock()
-	index := s.workspaceIndex
-	s.workspaceMu.RUnlock()
+	index := s.workspaceIndexFor(uri)
 	if index == nil {
 		return nil, nil
 	}
@@ -2366,6 +2782,8 @@ func (s *Server) findWorkspaceDefinitions(name string, uri protocol.DocumentUri,
 		return index.FindSubsFull(name, exclude), nil
 	}
 
+	// Plain sub calls are not looked up through @ISA; methods are resolved
+	// by resolveMethod.
 	if pkg != "" && pkg != "main" {
 		full := pkg + "::" + name
 		defs := index.FindSubsFull(full, exclude)
@@ -2395,12 +2813,13 @@ func (s *Server) findWorkspaceDefinitions(name string, uri protocol.DocumentUri,
 }
 
 func (s *Server) moduleLocation(name string, uri protocol.DocumentUri) (protocol.Location, bool) {
+	path, _ := uriToPath(uri)
+	var index *analysis.WorkspaceIndex
+	var roots []string
 	s.workspaceMu.RLock()
-	index := s.workspaceIndex
-	roots := append([]string{}, s.workspaceRoots...)
-	roots = append(roots, s.incRoots...)
-	for p := range s.extraRoots {
-		roots = append(roots, p)
+	if folder := s.folderForPathLocked(path); folder != nil {
+		index = folder.index
+		roots = folder.indexRoots()
 	}
 	s.workspaceMu.RUnlock()
 	if index == nil {
@@ -2414,7 +2833,7 @@ func (s *Server) moduleLocation(name string, uri protocol.DocumentUri) (protocol
 	s.logger.Debug("module lookup", "name", name, "exclude", exclude)
 	defs := index.FindPackages(name, exclude)
 	if len(defs) == 0 {
-		s.logger.Debug("module not found in index", "name", name, "roots", uniqueStrings(roots))
+		s.logger.Debug("module not found in index", "name", name, "roots", roots)
 		return protocol.Location{}, false
 	}
 	def := defs[0]
@@ -2432,9 +2851,7 @@ func (s *Server) moduleLocation(name string, uri protocol.DocumentUri) (protocol
 }
 
 func (s *Server) moduleFileLocation(name string, uri protocol.DocumentUri) (protocol.Location, bool) {
-	s.workspaceMu.RLock()
-	index := s.workspaceIndex
-	s.workspaceMu.RUnlock()
+	index := s.workspaceIndexFor(uri)
 	if index == nil {
 		s.logger.Debug("module lookup skipped: no index", "name", name)
 		return protocol.Location{}, false
@@ -2490,52 +2907,51 @@ func (s *Server) ensureUseLibPaths(root *ppi.Node, filePath string) {
 	}
 	var added bool
 	s.workspaceMu.Lock()
-	if s.extraRoots == nil {
-		s.extraRoots = make(map[string]struct{})
+	folder := s.folderForPathLocked(filePath)
+	if folder == nil {
+		s.workspaceMu.Unlock()
+		return
 	}
 	for _, p := range paths {
 		if p == "" {
 			continue
 		}
-		if _, ok := s.extraRoots[p]; ok {
+		if _, ok := folder.extraRoots[p]; ok {
 			continue
 		}
-		s.extraRoots[p] = struct{}{}
+		folder.extraRoots[p] = struct{}{}
 		added = true
 	}
-	roots := append([]string{}, s.workspaceRoots...)
-	roots = append(roots, s.incRoots...)
-	for p := range s.extraRoots {
-		roots = append(roots, p)
-	}
 	s.workspaceMu.Unlock()
 
 	if !added {
 		return
 	}
-	roots = uniqueStrings(roots)
-	s.startWorkspaceIndexBuild(roots, "use lib")
+	s.startWorkspaceIndexBuild(folder, "use lib")
 }
 
-func (s *Server) startWorkspaceIndexBuild(roots []string, reason string) {
-	if len(roots) == 0 {
+func (s *Server) startWorkspaceIndexBuild(folder *workspaceFolder, reason string) {
+	s.workspaceMu.Lock()
+	roots := folder.indexRoots()
+	opts := folder.indexOptions()
+	if len(roots) == 0 && len(opts.INCRoots) == 0 && len(opts.LazyRoots) == 0 && len(opts.SigRoots) == 0 {
+		s.workspaceMu.Unlock()
+		s.logger.Debug("workspace index skipped: no roots", "folder", folder.root)
 		return
 	}
-	roots = uniqueStrings(roots)
-	s.workspaceMu.Lock()
-	if s.workspaceBuildCancel != nil {
-		s.workspaceBuildCancel()
+	if folder.buildCancel != nil {
+		folder.buildCancel()
 	}
 	ctx, cancel := context.WithCancel(context.Background())
-	s.workspaceBuildCancel = cancel
-	s.workspaceBuildID++
-	buildID := s.workspaceBuildID
+	folder.buildCancel = cancel
+	folder.buildID++
+	buildID := folder.buildID
 	s.workspaceMu.Unlock()
 
-	s.logger.Info("workspace index build started", "reason", reason, "roots", len(roots))
+	s.logger.Info("workspace index build started", "reason", reason, "folder", folder.root, "roots", len(roots))
 	go func(roots []string, reason string, buildID uint64) {
 		started := time.Now()
-		index, err := analysis.BuildWorkspaceIndex(roots)
+		index, err := analysis.BuildWorkspaceIndexWithOptions(roots, opts)
 		seconds := time.Since(started).Seconds()
 		if err != nil {
 			if ctx.Err() != nil {
@@ -2547,24 +2963,26 @@ func (s *Server) startWorkspaceIndexBuild(roots []string, reason string) {
 		}
 
 		s.workspaceMu.Lock()
-		if buildID != s.workspaceBuildID || ctx.Err() != nil {
+		if buildID != folder.buildID || ctx.Err() != nil {
 			s.workspaceMu.Unlock()
 			s.logger.Debug("workspace index result discarded", "reason", reason, "seconds", seconds)
 			return
 		}
-		s.workspaceIndex = index
-		s.workspaceBuildCancel = nil
+		folder.index = index
+		folder.buildCancel = nil
 		s.workspaceMu.Unlock()
-		s.logger.Info("workspace index ready", "reason", reason, "roots", len(roots), "files", index.Files, "seconds", seconds)
+		s.logger.Info("workspace index ready", "reason", reason, "folder", folder.root, "roots", len(roots), "incRoots", len(opts.INCRoots), "lazyRoots", len(opts.LazyRoots), "sigRoots", len(opts.SigRoots), "files", index.Files, "truncated", index.Truncated, "seconds", seconds)
 	}(roots, reason, buildID)
 }
 
 func (s *Server) cancelWorkspaceIndexBuild() {
 	s.workspaceMu.Lock()
 	defer s.workspaceMu.Unlock()
-	if s.workspaceBuildCancel != nil {
-		s.workspaceBuildCancel()
-		s.workspaceBuildCancel = nil
+	for _, folder := range s.folders {
+		if folder.buildCancel != nil {
+			folder.buildCancel()
+			folder.buildCancel = nil
+		}
 	}
 }
 
@@ -2614,23 +3032,14 @@ func (s *Server) projectBaseForFile(filePath string) string {
 	fallback := filepath.Dir(filePath)
 
 	s.workspaceMu.RLock()
-	roots := append([]string{}, s.projectRoots...)
+	folder := s.folderForPathLocked(filePath)
 	s.workspaceMu.RUnlock()
-
-	var best string
-	for _, root := range roots {
-		root = filepath.Clean(root)
-		if root == "" {
-			continue
-		}
-		if filePath == root || strings.HasPrefix(filePath, root+string(os.PathSeparator)) {
-			if len(root) > len(best) {
-				best = root
-			}
-		}
+	if folder == nil || folder.root == "" {
+		return fallback
 	}
-	if best != "" {
-		return best
+	root := filepath.Clean(folder.root)
+	if filePath == root || strings.HasPrefix(filePath, root+string(os.PathSeparator)) {
+		return root
 	}
 	return fallback
 }
@@ -2656,9 +3065,10 @@ func (s *Server) compileDiagnosticsForFile(uri protocol.DocumentUri, path string
 		args = append(args, "-I", p)
 	}
 	args = append(args, "-c", filepath.Base(path))
-	s.logger.Debug("perl -c command", "cwd", filepath.Dir(path), "cmd", "perl", "args", args)
+	perl := s.perlForPath(path)
+	s.logger.Debug("perl -c command", "cwd", filepath.Dir(path), "cmd", perl, "args", args)
 
-	cmd := exec.CommandContext(ctx, "perl", args...)
+	cmd := exec.CommandContext(ctx, perl, args...)
 	cmd.Dir = filepath.Dir(path)
 	out, err := cmd.CombinedOutput()
 	if err != nil {
@@ -2787,24 +3197,6 @@ func (s *Server) cancelCompile(uri string) {
 	delete(s.compileCancel, uri)
 }
 
-func perlINCPaths() ([]string, error) {
-	cmd := exec.Command("perl", "-e", "print join(\"\\n\", @INC)")
-	out, err := cmd.Output()
-	if err != nil {
-		return nil, err
-	}
-	lines := strings.Split(strings.TrimSpace(string(out)), "\n")
-	var paths []string
-	for _, line := range lines {
-		line = strings.TrimSpace(line)
-		if line == "" {
-			continue
-		}
-		paths = append(paths, line)
-	}
-	return paths, nil
-}
-
 func uniqueStrings(values []string) []string {
 	seen := make(map[string]struct{}, len(values))
 	out := make([]string, 0, len(values))
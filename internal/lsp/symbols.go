@@ -0,0 +1,181 @@
+package lsp
+
+import (
+	"sort"
+
+	ppi "github.com/skaji/go-ppi"
+	"github.com/skaji/perl-language-server/internal/analysis"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// documentSymbol returns the outline of a document: packages with their
+// subs, and classes of the class feature with their fields, methods and
+// ADJUST blocks.
+func (s *Server) documentSymbol(_ *glsp.Context, params *protocol.DocumentSymbolParams) (any, error) {
+	s.logger.Debug("documentSymbol", "uri", params.TextDocument.URI)
+	doc, ok := s.docs.get(string(params.TextDocument.URI))
+	if !ok || doc.parsed == nil {
+		s.logger.Debug("documentSymbol skipped: no document")
+		return nil, nil
+	}
+	return documentSymbols(doc.text, doc.parsed), nil
+}
+
+// outlineEntry is a symbol of the outline with the offsets it spans, which
+// decide where subs are nested. An open entry is a package statement
+// without a block, in effect up to the next package or class.
+type outlineEntry struct {
+	symbol     protocol.DocumentSymbol
+	start, end int
+	open       bool
+}
+
+func documentSymbols(text string, doc *ppi.Document) []protocol.DocumentSymbol {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	var containers []*outlineEntry
+	var subs []outlineEntry
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement || n.Name == "" {
+			return
+		}
+		start, end, ok := nodeTokenRange(n)
+		if !ok {
+			return
+		}
+		sel, ok := nodeNameRange(text, n)
+		if !ok {
+			return
+		}
+		switch n.Kind {
+		case "statement::package":
+			containers = append(containers, &outlineEntry{
+				symbol: protocol.DocumentSymbol{Name: n.Name, Kind: protocol.SymbolKindNamespace, SelectionRange: sel},
+				start:  start,
+				end:    end,
+				open:   n.PackageBlock == nil && !hasBlockChild(n),
+			})
+		case "statement::sub":
+			subs = append(subs, outlineEntry{
+				symbol: protocol.DocumentSymbol{Name: n.Name, Kind: protocol.SymbolKindFunction, Range: offsetRange(text, start, end), SelectionRange: sel},
+				start:  start,
+				end:    end,
+			})
+		}
+	})
+	for _, pkg := range analysis.StrayPackages(doc) {
+		containers = append(containers, &outlineEntry{
+			symbol: protocol.DocumentSymbol{Name: pkg.Name, Kind: protocol.SymbolKindNamespace, SelectionRange: offsetRange(text, pkg.Start, pkg.End)},
+			start:  pkg.Offset,
+			open:   true,
+		})
+	}
+	for _, class := range analysis.CollectClasses(doc) {
+		containers = append(containers, classOutline(text, class))
+	}
+	sort.SliceStable(containers, func(i, j int) bool {
+		return containers[i].start < containers[j].start
+	})
+	for i, c := range containers {
+		if !c.open {
+			continue
+		}
+		c.end = len(text)
+		if i+1 < len(containers) {
+			c.end = containers[i+1].start
+		}
+	}
+	var top []protocol.DocumentSymbol
+	for _, sub := range subs {
+		if c := innermostContainer(containers, sub.start); c != nil {
+			c.symbol.Children = append(c.symbol.Children, sub.symbol)
+			continue
+		}
+		top = append(top, sub.symbol)
+	}
+	for _, c := range containers {
+		c.symbol.Range = offsetRange(text, c.start, c.end)
+		top = append(top, c.symbol)
+	}
+	sort.SliceStable(top, func(i, j int) bool {
+		return comparePosition(top[i].Range.Start, top[j].Range.Start) < 0
+	})
+	return top
+}
+
+func hasBlockChild(n *ppi.Node) bool {
+	for _, c := range n.Children {
+		if c.Type == ppi.NodeBlock {
+			return true
+		}
+	}
+	return false
+}
+
+func innermostContainer(containers []*outlineEntry, offset int) *outlineEntry {
+	var found *outlineEntry
+	for _, c := range containers {
+		if offset < c.start || offset >= c.end {
+			continue
+		}
+		if found == nil || c.start >= found.start {
+			found = c
+		}
+	}
+	return found
+}
+
+func classOutline(text string, class analysis.ClassDecl) *outlineEntry {
+	sym := protocol.DocumentSymbol{
+		Name:           class.Name,
+		Kind:           protocol.SymbolKindClass,
+		SelectionRange: offsetRange(text, class.Start, class.End),
+	}
+	for _, f := range class.Fields {
+		sym.Children = append(sym.Children, protocol.DocumentSymbol{
+			Name:           f.Name,
+			Kind:           protocol.SymbolKindField,
+			Range:          offsetRange(text, f.Offset, f.End),
+			SelectionRange: offsetRange(text, f.Start, f.End),
+		})
+	}
+	methods := append(append([]analysis.ClassMethod(nil), class.Methods...), class.Adjust...)
+	for _, m := range methods {
+		kind := protocol.SymbolKindMethod
+		if m.Name == "ADJUST" {
+			kind = protocol.SymbolKindConstructor
+		}
+		sym.Children = append(sym.Children, protocol.DocumentSymbol{
+			Name:           m.Name,
+			Kind:           kind,
+			Range:          offsetRange(text, m.BodyStart, m.BodyEnd),
+			SelectionRange: offsetRange(text, m.Start, m.End),
+		})
+	}
+	sort.SliceStable(sym.Children, func(i, j int) bool {
+		return comparePosition(sym.Children[i].Range.Start, sym.Children[j].Range.Start) < 0
+	})
+	return &outlineEntry{symbol: sym, start: class.Start, end: class.ScopeEnd}
+}
+
+func offsetRange(text string, start, end int) protocol.Range {
+	return protocol.Range{Start: positionFromOffset(text, start), End: positionFromOffset(text, end)}
+}
+
+func comparePosition(a, b protocol.Position) int {
+	if a.Line != b.Line {
+		if a.Line < b.Line {
+			return -1
+		}
+		return 1
+	}
+	if a.Character != b.Character {
+		if a.Character < b.Character {
+			return -1
+		}
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,62 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestTypeAliasDiagnostics(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	writeFile(t, filepath.Join(lib, "My", "Types.pm"), "package My::Types;\n# :TYPE(Port = int)\n1;\n")
+	writeFile(t, filepath.Join(lib, "Known.pm"), "package Known;\n1;\n")
+	index, err := analysis.BuildWorkspaceIndex([]string{lib})
+	if err != nil {
+		t.Fatalf("workspace index: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	s.folders = []*workspaceFolder{{root: tmp, libRoots: []string{lib}, index: index}}
+
+	src := "# :TYPE(A = array[B])\n# :TYPE(B = A)\n# :TYPE(Server = hash{port: My::Types::Port})\n# :SIG((Server, Known) -> Missing)\nsub f {}\n"
+	uri := protocol.DocumentUri(fileURI(filepath.Join(tmp, "app.pl")))
+	doc := s.docs.set(string(uri), src, nil)
+	diags := sigDiagnostics(src, s.sigScope(uri, doc.parsed))
+	var msgs []string
+	for _, d := range diags {
+		msgs = append(msgs, d.Message)
+	}
+	want := []string{
+		"invalid :TYPE(...): type alias cycle: main::B -> main::A -> main::B",
+		"invalid :TYPE(...): type alias cycle: main::A -> main::B -> main::A",
+		`invalid :SIG(...): unknown type "Missing"`,
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("expected %v, got %v", want, msgs)
+	}
+	for i := range want {
+		if msgs[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, msgs)
+		}
+	}
+	if got := diags[2].Range.Start; got.Line != 3 || got.Character != 26 {
+		t.Fatalf("unexpected range start: %+v", got)
+	}
+}
+
+func TestHoverTypeAlias(t *testing.T) {
+	src := "package My::App;\n# :TYPE(ServerConfig = hash{host: str, port: int, tls: bool?})\n# :SIG(ServerConfig)\nmy $config = {};\n$config;\n"
+	store := newDocumentStore()
+	d := store.set("file:///test.pl", src, nil)
+	offset := strings.LastIndex(src, "$config")
+	want := "ServerConfig = hash{host: str, port: int, tls: bool?}"
+	if got := hoverVarSigType(d, offset, "$config", nil); got != want {
+		t.Fatalf("expected %q, got %q", want, got)
+	}
+}
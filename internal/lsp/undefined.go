@@ -0,0 +1,304 @@
+package lsp
+
+import (
+	"os"
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// knownExports are the subs common modules export by default, for modules
+// whose exports cannot be read from @EXPORT or that may not be installed.
+// Their import lists are not taken to replace these.
+var knownExports = map[string][]string{
+	"Carp":           {"carp", "croak", "confess"},
+	"Cwd":            {"cwd", "getcwd", "fastcwd", "fastgetcwd"},
+	"Data::Dumper":   {"Dumper"},
+	"Encode":         {"decode", "decode_utf8", "encode", "encode_utf8", "encodings", "find_encoding", "find_mime_encoding", "from_to", "str2bytes", "bytes2str"},
+	"File::Basename": {"basename", "dirname", "fileparse", "fileparse_set_fstype"},
+	"File::Copy":     {"copy", "move"},
+	"File::Path":     {"mkpath", "rmtree"},
+	"File::Temp":     {"tempfile", "tempdir"},
+	"Getopt::Long":   {"GetOptions"},
+	"JSON::PP":       {"encode_json", "decode_json", "from_json", "to_json"},
+	"List::Util":     nil,
+	"Mojo::Base":     {"has"},
+	"Moo":            {"extends", "with", "has", "before", "after", "around"},
+	"Moo::Role":      {"with", "requires", "has", "before", "after", "around"},
+	"Moose":          {"extends", "with", "has", "before", "after", "around", "override", "super", "augment", "inner", "blessed", "confess"},
+	"Moose::Role":    {"with", "requires", "excludes", "has", "before", "after", "around", "override", "super", "augment", "inner"},
+	"Mouse":          {"extends", "with", "has", "before", "after", "around", "override", "super", "augment", "inner", "blessed", "confess"},
+	"Mouse::Role":    {"with", "requires", "excludes", "has", "before", "after", "around", "override", "super", "augment", "inner"},
+	"Object::Pad":    nil,
+	"Scalar::Util":   nil,
+	"Storable":       {"store", "retrieve"},
+	"Test::More": {
+		"ok", "use_ok", "require_ok", "is", "isnt", "like", "unlike", "is_deeply", "cmp_ok",
+		"skip", "todo", "todo_skip", "pass", "fail", "eq_array", "eq_hash", "eq_set", "plan",
+		"done_testing", "can_ok", "isa_ok", "new_ok", "diag", "note", "explain", "subtest", "BAIL_OUT",
+	},
+	"Try::Tiny": {"try", "catch", "finally"},
+}
+
+// subFreePragmas are the pragmas that define no subs in the caller, or
+// whose subs DefinedSubNames finds.
+var subFreePragmas = map[string]bool{
+	"autodie": true, "base": true, "bigint": true, "bignum": true, "bigrat": true, "bytes": true,
+	"charnames": true, "constant": true, "diagnostics": true, "encoding": true, "experimental": true,
+	"feature": true, "fields": true, "integer": true, "less": true, "lib": true, "locale": true,
+	"mro": true, "open": true, "overload": true, "overloading": true, "parent": true, "re": true,
+	"sigtrap": true, "sort": true, "strict": true, "subs": true, "utf8": true, "vars": true,
+	"version": true, "vmsish": true, "warnings": true,
+}
+
+// universalMethods are the methods every class inherits from UNIVERSAL,
+// or that perl calls without them being defined.
+var universalMethods = map[string]bool{
+	"can": true, "isa": true, "DOES": true, "VERSION": true, "import": true, "unimport": true, "DESTROY": true,
+}
+
+// toUndefinedDiagnostics warns about calls of subs and methods that are
+// defined nowhere: a bare call that matches no builtin, sub of the file,
+// import or sub in the MRO of its package, and a method call on a receiver
+// of known class whose MRO has no such method. It stays quiet whenever a
+// sub may exist without it being seen: a module whose exports are unknown
+// is used, a file is loaded by require or do, a string is evaled, or a
+// package in the MRO is not indexed, has an AUTOLOAD, calls can or assigns
+// to a glob.
+func (s *Server) toUndefinedDiagnostics(uri protocol.DocumentUri, doc *documentData) []protocol.Diagnostic {
+	if doc == nil || doc.parsed == nil {
+		return nil
+	}
+	parsed := doc.parsed
+	check := &undefinedCheck{
+		s:       s,
+		uri:     uri,
+		doc:     doc,
+		local:   localPackages(parsed),
+		dynamic: analysis.DynamicPackages(parsed),
+		parsed:  make(map[string]map[string]bool),
+	}
+	var out []protocol.Diagnostic
+	source := "perl-lsp"
+	sev := protocol.DiagnosticSeverityWarning
+	report := func(start, end int, msg string) {
+		out = append(out, protocol.Diagnostic{
+			Range:    offsetRange(doc.text, start, end),
+			Severity: &sev,
+			Source:   &source,
+			Message:  msg,
+		})
+	}
+
+	if calls := analysis.BareCalls(parsed); len(calls) > 0 {
+		known := analysis.DefinedSubNames(parsed)
+		for _, name := range append(perlBuiltins(), perlKeywords()...) {
+			known[name] = true
+		}
+		imported, complete := s.importedSubNames(uri, parsed)
+		for _, call := range calls {
+			if !complete {
+				break
+			}
+			if known[call.Name] || imported[call.Name] {
+				continue
+			}
+			if _, ok := s.resolveMethod(doc, uri, call.Package, call.Name, false); ok || !check.mroComplete(call.Package) {
+				continue
+			}
+			report(call.Start, call.End, "Undefined subroutine &"+call.Package+"::"+call.Name)
+		}
+	}
+
+	tokens := parsed.Tokens
+	for i, tok := range tokens {
+		if tok.Type != ppi.TokenWord || universalMethods[tok.Value] {
+			continue
+		}
+		if prev := prevNonTriviaToken(tokens, i-1); prev < 0 || tokens[prev].Value != "->" {
+			continue
+		}
+		class, name, super, ok := methodCallAt(doc, i, tok.Start)
+		if !ok || super {
+			continue
+		}
+		if _, ok := s.resolveMethod(doc, uri, class, name, false); ok || !check.mroComplete(class) {
+			continue
+		}
+		report(tok.Start, tok.End, `Can't locate object method "`+name+`" via package "`+class+`"`)
+	}
+	return out
+}
+
+// undefinedCheck caches what toUndefinedDiagnostics learns about packages.
+type undefinedCheck struct {
+	s       *Server
+	uri     protocol.DocumentUri
+	doc     *documentData
+	local   map[string]bool
+	dynamic map[string]bool
+	// parsed holds the dynamic packages of the files read from the index.
+	parsed map[string]map[string]bool
+}
+
+// mroComplete reports whether every package in the MRO of pkg is known,
+// in the document or the workspace index, and none of them can define
+// subs that are not seen.
+func (c *undefinedCheck) mroComplete(pkg string) bool {
+	index := c.s.workspaceIndexFor(c.uri)
+	for _, p := range c.s.packageMRO(c.doc, c.uri, pkg) {
+		if c.dynamic[p] {
+			return false
+		}
+		if c.local[p] {
+			continue
+		}
+		if index == nil {
+			return false
+		}
+		defs := index.FindPackages(p, "")
+		if len(defs) == 0 || len(index.FindSubsFull(p+"::AUTOLOAD", "")) > 0 {
+			return false
+		}
+		dynamic, ok := c.parsed[defs[0].File]
+		if !ok {
+			if src, err := os.ReadFile(defs[0].File); err == nil {
+				dynamic = analysis.DynamicPackages(parseDocument(string(src)))
+			}
+			c.parsed[defs[0].File] = dynamic
+		}
+		if dynamic == nil || dynamic[p] {
+			return false
+		}
+	}
+	return true
+}
+
+// localPackages returns the packages and classes doc declares, and main.
+func localPackages(doc *ppi.Document) map[string]bool {
+	out := map[string]bool{"main": true}
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n != nil && n.Kind == "statement::package" && n.Name != "" {
+			out[n.Name] = true
+		}
+	})
+	for _, p := range analysis.StrayPackages(doc) {
+		out[p.Name] = true
+	}
+	for _, class := range analysis.CollectClasses(doc) {
+		out[class.Name] = true
+	}
+	return out
+}
+
+// importedSubNames returns the subs the use statements of doc import.
+// complete is false when a module's imports cannot be known: its file is
+// not found or builds its own import, or the import list has tags. It is
+// false too when doc loads code at run time with require or do of a file,
+// or a string eval.
+func (s *Server) importedSubNames(uri protocol.DocumentUri, doc *ppi.Document) (names map[string]bool, complete bool) {
+	names = make(map[string]bool)
+	path, _ := uriToPath(uri)
+	var searchPaths []string
+	searched := false
+	complete = !loadsCodeAtRuntime(doc.Tokens)
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if !complete || n == nil || n.Kind != "statement::include" || strings.ToLower(n.Keyword) != "use" || n.Name == "" {
+			return
+		}
+		if n.Name[0] >= 'a' && n.Name[0] <= 'z' {
+			complete = subFreePragmas[n.Name]
+			return
+		}
+		items := n.ImportItems
+		if len(items) == 0 {
+			items = importItemsFromArgs(n.Args)
+		}
+		explicit := len(items) > 0 || n.ImportKind == "paren"
+		tags := false
+		for _, item := range items {
+			name := normalizeImportName(item)
+			if isIdent(name) {
+				names[name] = true
+				continue
+			}
+			explicit = false
+			if strings.HasPrefix(name, ":") {
+				tags = true
+			}
+		}
+		if defaults, ok := knownExports[n.Name]; ok {
+			for _, name := range defaults {
+				names[name] = true
+			}
+			return
+		}
+		if explicit {
+			return
+		}
+		if tags {
+			complete = false
+			return
+		}
+		file := ""
+		if index := s.workspaceIndexFor(uri); index != nil {
+			if defs := index.FindPackages(n.Name, ""); len(defs) > 0 {
+				file = defs[0].File
+			}
+		}
+		if file == "" && path != "" {
+			if !searched {
+				searchPaths = s.moduleSearchPathsWithBase(doc.Root, path, "")
+				searched = true
+			}
+			file = findModuleFile(n.Name, searchPaths)
+		}
+		if file == "" {
+			complete = false
+			return
+		}
+		src, err := os.ReadFile(file)
+		if err != nil {
+			complete = false
+			return
+		}
+		exports, ok := analysis.ExportedSubs(parseDocument(string(src)))
+		if !ok {
+			complete = false
+			return
+		}
+		for name := range exports {
+			names[name] = true
+		}
+	})
+	return names, complete
+}
+
+// loadsCodeAtRuntime reports whether tokens have a require or do of a file,
+// such as require './helpers.pl', or an eval of a string rather than a
+// block. require of a module name and do and eval blocks do not count.
+func loadsCodeAtRuntime(tokens []ppi.Token) bool {
+	for i, tok := range tokens {
+		if tok.Type != ppi.TokenWord || (tok.Value != "require" && tok.Value != "do" && tok.Value != "eval") {
+			continue
+		}
+		if prev := prevNonTriviaToken(tokens, i-1); prev >= 0 && tokens[prev].Value == "->" {
+			continue
+		}
+		next := nextNonTriviaTokenLocal(tokens, i+1)
+		if next < 0 {
+			return tok.Value == "eval"
+		}
+		switch {
+		case tokens[next].Value == "=>":
+		case tokens[next].Value == "{" && tok.Value != "require":
+		case tokens[next].Type == ppi.TokenWord && tok.Value == "require":
+		case tokens[next].Type == ppi.TokenNumber && tok.Value == "require":
+		default:
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestUndefinedDiagnostics(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "lib", "My"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	util := "package My::Util;\nuse parent 'Exporter';\nour @EXPORT = qw(helper);\nsub helper { 1 }\n1;\n"
+	if err := os.WriteFile(filepath.Join(dir, "lib", "My", "Util.pm"), []byte(util), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	src := `use strict;
+use warnings;
+use lib 'lib';
+use Carp;
+use My::Util;
+package Animal;
+sub new { bless {}, shift }
+sub speak { 1 }
+package Dog;
+use parent -norequire, 'Animal';
+sub bark { my $self = shift; $self->speak; $self->fly; }
+package main;
+helper();
+croak("x") if 0;
+frobnicate(1);
+local_sub();
+my $ok = defined &missing;
+Dog->new;
+Dog->wag;
+Cat->can('purr');
+Animal->roar;
+sub local_sub { 1 }
+`
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	uri := protocol.DocumentUri(fileURI(filepath.Join(dir, "script.pl")))
+	d := s.docs.set(string(uri), src, nil)
+	var got []string
+	for _, diag := range s.toUndefinedDiagnostics(uri, d) {
+		got = append(got, diag.Message)
+	}
+	want := []string{
+		`Undefined subroutine &main::frobnicate`,
+		`Can't locate object method "fly" via package "Dog"`,
+		`Can't locate object method "wag" via package "Dog"`,
+		`Can't locate object method "roar" via package "Animal"`,
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	for _, quiet := range []string{
+		"use Unknown::Module;\nfrobnicate();\n",
+		"sub AUTOLOAD { 1 }\nfrobnicate();\n",
+		"frobnicate() if __PACKAGE__->can('frobnicate');\n",
+		"no strict 'refs';\n*{'main::frobnicate'} = sub { 1 };\nfrobnicate();\n",
+		"package Foo;\nsub new { bless {}, shift }\nsub AUTOLOAD { 1 }\npackage main;\nFoo->frobnicate;\n",
+		"package Foo;\nuse parent -norequire, 'Unknown::Base';\npackage main;\nFoo->frobnicate;\n",
+		"package Foo;\nuse Moo;\npackage main;\nFoo->new;\n",
+		"require './helpers.pl';\nfrobnicate();\n",
+		"do 'helpers.pl';\nfrobnicate();\n",
+		"eval \"sub frobnicate { 1 }\";\nfrobnicate();\n",
+	} {
+		d := s.docs.set(string(uri), quiet, nil)
+		if diags := s.toUndefinedDiagnostics(uri, d); len(diags) != 0 {
+			t.Fatalf("expected no diagnostics for %q, got %+v", quiet, diags)
+		}
+	}
+	loud := "require Carp;\neval { 1 };\nmy $x = do { 1 };\nfrobnicate();\n"
+	d = s.docs.set(string(uri), loud, nil)
+	if diags := s.toUndefinedDiagnostics(uri, d); len(diags) != 1 {
+		t.Fatalf("expected one diagnostic for %q, got %+v", loud, diags)
+	}
+}
@@ -0,0 +1,220 @@
+package lsp
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// unresolvedModule is a use, no or require statement whose module is found
+// neither in the workspace nor in the search paths. start and end span the
+// module name.
+type unresolvedModule struct {
+	name       string
+	require    bool
+	start, end int
+}
+
+// unresolvedModules returns the modules doc loads that cannot be found in
+// the workspace index, the lib roots, use lib paths or @INC. Pragmas,
+// packages of the document itself and loads inside eval or try blocks,
+// which are how optional dependencies are loaded, are skipped. Nothing is
+// reported when @INC is not known.
+func (s *Server) unresolvedModules(uri protocol.DocumentUri, doc *documentData) []unresolvedModule {
+	if doc == nil || doc.parsed == nil {
+		return nil
+	}
+	path, ok := uriToPath(uri)
+	if !ok {
+		return nil
+	}
+	// go-ppi parses use and no as include statements, but require as an
+	// expression, so the loads are read from the tokens.
+	tokens := doc.parsed.Tokens
+	var loads []int
+	for i, tok := range tokens {
+		if tok.Type != ppi.TokenWord || (tok.Value != "use" && tok.Value != "no" && tok.Value != "require") {
+			continue
+		}
+		// use and no start a statement; require is an expression, but not a
+		// method.
+		if prev := prevNonTriviaToken(tokens, i-1); prev >= 0 {
+			switch {
+			case tokens[prev].Value == "->":
+				continue
+			case tok.Value != "require" && tokens[prev].Value != ";" && tokens[prev].Value != "{" && tokens[prev].Value != "}":
+				continue
+			}
+		}
+		name := nextNonTriviaTokenLocal(tokens, i+1)
+		if name < 0 || tokens[name].Type != ppi.TokenWord || isPragmaName(tokens[name].Value) || !isClassName(tokens[name].Value) {
+			continue
+		}
+		if next := nextNonTriviaTokenLocal(tokens, name+1); next >= 0 && (tokens[next].Value == "=>" || tokens[next].Value == "->") {
+			continue
+		}
+		loads = append(loads, name)
+	}
+	if len(loads) == 0 {
+		return nil
+	}
+	inc := s.incRootsForPath(path)
+	if len(inc) == 0 {
+		return nil
+	}
+	roots := append(s.compileIncludePathsWithBase(doc.parsed.Root, path, ""), inc...)
+	local := localPackages(doc.parsed)
+	index := s.workspaceIndexFor(uri)
+	var out []unresolvedModule
+	for _, idx := range loads {
+		name := tokens[idx].Value
+		if local[name] || (index != nil && len(index.FindPackages(name, "")) > 0) || insideEvalBlock(tokens, idx) {
+			continue
+		}
+		if findModuleFile(name, roots) != "" {
+			continue
+		}
+		keyword := prevNonTriviaToken(tokens, idx-1)
+		out = append(out, unresolvedModule{
+			name:    name,
+			require: tokens[keyword].Value == "require",
+			start:   tokens[idx].Start,
+			end:     tokens[idx].End,
+		})
+	}
+	return out
+}
+
+// isPragmaName reports whether name is a pragma such as strict or
+// warnings::register, which perl ships with.
+func isPragmaName(name string) bool {
+	if name == "" || name[0] < 'a' || name[0] > 'z' {
+		return false
+	}
+	return !strings.Contains(name, "::") || strings.HasPrefix(name, "warnings::")
+}
+
+// insideEvalBlock reports whether tokens[idx] is in an eval or try block,
+// as in "eval { require Foo; 1 }".
+func insideEvalBlock(tokens []ppi.Token, idx int) bool {
+	depth := 0
+	for i := idx - 1; i >= 0; i-- {
+		tok := tokens[i]
+		if tok.Type != ppi.TokenOperator {
+			continue
+		}
+		switch tok.Value {
+		case "}", ")", "]":
+			depth++
+		case "(", "[":
+			if depth > 0 {
+				depth--
+			}
+		case "{":
+			if depth > 0 {
+				depth--
+				continue
+			}
+			if prev := prevNonTriviaToken(tokens, i-1); prev >= 0 && tokens[prev].Type == ppi.TokenWord && (tokens[prev].Value == "eval" || tokens[prev].Value == "try") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// toUnresolvedModuleDiagnostics reports the modules that cannot be found.
+// A missing module of a use statement fails compilation, so it is a
+// warning; a require may be on a path that never runs.
+func (s *Server) toUnresolvedModuleDiagnostics(uri protocol.DocumentUri, doc *documentData) []protocol.Diagnostic {
+	var out []protocol.Diagnostic
+	for _, m := range s.unresolvedModules(uri, doc) {
+		out = append(out, unresolvedModuleDiagnostic(doc.text, m))
+	}
+	return out
+}
+
+func unresolvedModuleDiagnostic(text string, m unresolvedModule) protocol.Diagnostic {
+	source := "perl-lsp"
+	sev := protocol.DiagnosticSeverityWarning
+	if m.require {
+		sev = protocol.DiagnosticSeverityInformation
+	}
+	return protocol.Diagnostic{
+		Range:    offsetRange(text, m.start, m.end),
+		Severity: &sev,
+		Source:   &source,
+		Message:  "Can't locate " + m.name + " in the workspace or @INC (install it with: cpanm " + m.name + ")",
+	}
+}
+
+// cpanfileCodeActions offers to add the unresolved modules in rng to the
+// cpanfile at the project root, creating it when there is none and the
+// client can create files. Modules the cpanfile already lists are only
+// missing from @INC, and get no action.
+func (s *Server) cpanfileCodeActions(uri protocol.DocumentUri, doc *documentData, rng protocol.Range) []protocol.CodeAction {
+	modules := s.unresolvedModules(uri, doc)
+	if len(modules) == 0 {
+		return nil
+	}
+	path, _ := uriToPath(uri)
+	cpanfile := filepath.Join(s.projectBaseForFile(path), "cpanfile")
+	cpanURI := protocol.DocumentUri(fileURI(cpanfile))
+	content, err := os.ReadFile(cpanfile)
+	exists := err == nil
+	if !exists {
+		s.workspaceMu.RLock()
+		create := s.createFiles
+		s.workspaceMu.RUnlock()
+		if !create {
+			return nil
+		}
+	}
+	var out []protocol.CodeAction
+	kind := protocol.CodeActionKindQuickFix
+	for _, m := range modules {
+		diag := unresolvedModuleDiagnostic(doc.text, m)
+		if comparePosition(diag.Range.End, rng.Start) < 0 || comparePosition(rng.End, diag.Range.Start) < 0 {
+			continue
+		}
+		if exists && cpanfileRequires(string(content), m.name) {
+			continue
+		}
+		line := "requires '" + m.name + "';\n"
+		var edit protocol.WorkspaceEdit
+		if exists {
+			text := string(content)
+			if text != "" && !strings.HasSuffix(text, "\n") {
+				line = "\n" + line
+			}
+			end := offsetRange(text, len(text), len(text))
+			edit.Changes = map[protocol.DocumentUri][]protocol.TextEdit{cpanURI: {{Range: end, NewText: line}}}
+		} else {
+			edit.DocumentChanges = []any{
+				protocol.CreateFile{Kind: "create", URI: cpanURI},
+				protocol.TextDocumentEdit{
+					TextDocument: protocol.OptionalVersionedTextDocumentIdentifier{TextDocumentIdentifier: protocol.TextDocumentIdentifier{URI: cpanURI}},
+					Edits:        []any{protocol.TextEdit{NewText: line}},
+				},
+			}
+		}
+		out = append(out, protocol.CodeAction{
+			Title:       "Add " + m.name + " to cpanfile",
+			Kind:        &kind,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Edit:        &edit,
+		})
+	}
+	return out
+}
+
+// cpanfileRequires reports whether a cpanfile lists module with requires,
+// recommends or suggests, in any phase.
+func cpanfileRequires(content, module string) bool {
+	re := regexp.MustCompile(`\b(?:requires|recommends|suggests)\s*\(?\s*['"]` + regexp.QuoteMeta(module) + `['"]`)
+	return re.MatchString(content)
+}
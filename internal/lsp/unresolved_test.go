@@ -0,0 +1,103 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestUnresolvedModuleDiagnosticsAndCpanfile(t *testing.T) {
+	tmp := t.TempDir()
+	lib := filepath.Join(tmp, "lib")
+	inc := filepath.Join(tmp, "inc")
+	for _, file := range []string{filepath.Join(lib, "My", "Util.pm"), filepath.Join(inc, "Installed", "Mod.pm")} {
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte("1;\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	s.folders = []*workspaceFolder{{root: tmp, libRoots: []string{lib}, incRoots: []string{inc}}}
+	src := `package My::Script;
+use strict;
+use warnings::register;
+use My::Util;
+use Installed::Mod;
+use Missing::Mod qw(f);
+use My::Script;
+my $ok = eval { require Optional::Mod; 1 };
+sub run { require Lazy::Mod }
+`
+	path := filepath.Join(tmp, "script.pl")
+	uri := protocol.DocumentUri(fileURI(path))
+	d := s.docs.set(string(uri), src, nil)
+
+	diags := s.toUnresolvedModuleDiagnostics(uri, d)
+	if len(diags) != 2 {
+		t.Fatalf("expected two diagnostics, got %+v", diags)
+	}
+	if diags[0].Message != "Can't locate Missing::Mod in the workspace or @INC (install it with: cpanm Missing::Mod)" ||
+		*diags[0].Severity != protocol.DiagnosticSeverityWarning || diags[0].Range.Start != (protocol.Position{Line: 5, Character: 4}) {
+		t.Fatalf("unexpected diagnostic: %+v", diags[0])
+	}
+	if !strings.Contains(diags[1].Message, "Lazy::Mod") || *diags[1].Severity != protocol.DiagnosticSeverityInformation {
+		t.Fatalf("unexpected diagnostic: %+v", diags[1])
+	}
+
+	line := protocol.Range{Start: protocol.Position{Line: 5}, End: protocol.Position{Line: 5, Character: 10}}
+	if actions := s.cpanfileCodeActions(uri, d, line); len(actions) != 0 {
+		t.Fatalf("expected no action creating the cpanfile without client support, got %+v", actions)
+	}
+	s.createFiles = true
+	actions := s.cpanfileCodeActions(uri, d, line)
+	if len(actions) != 1 || actions[0].Title != "Add Missing::Mod to cpanfile" || len(actions[0].Edit.DocumentChanges) != 2 {
+		t.Fatalf("expected an action creating the cpanfile, got %+v", actions)
+	}
+
+	cpanfile := filepath.Join(tmp, "cpanfile")
+	if err := os.WriteFile(cpanfile, []byte("requires 'Moo';"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	actions = s.cpanfileCodeActions(uri, d, line)
+	if len(actions) != 1 {
+		t.Fatalf("expected one action, got %+v", actions)
+	}
+	edit := actions[0].Edit.Changes[protocol.DocumentUri(fileURI(cpanfile))]
+	if len(edit) != 1 || edit[0].NewText != "\nrequires 'Missing::Mod';\n" || edit[0].Range.Start != (protocol.Position{Line: 0, Character: 15}) {
+		t.Fatalf("unexpected edit: %+v", edit)
+	}
+
+	if err := os.WriteFile(cpanfile, []byte("on test => sub {\n    requires \"Missing::Mod\";\n};\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if actions := s.cpanfileCodeActions(uri, d, line); len(actions) != 0 {
+		t.Fatalf("listed modules get no action, got %+v", actions)
+	}
+}
+
+func TestCanCreateFiles(t *testing.T) {
+	var caps protocol.ClientCapabilities
+	if canCreateFiles(caps) {
+		t.Fatalf("expected no file creation without workspace capabilities")
+	}
+	if err := json.Unmarshal([]byte(`{"workspace":{"workspaceEdit":{"documentChanges":true,"resourceOperations":["rename"]}}}`), &caps); err != nil {
+		t.Fatal(err)
+	}
+	if canCreateFiles(caps) {
+		t.Fatalf("expected no file creation without the create operation")
+	}
+	if err := json.Unmarshal([]byte(`{"workspace":{"workspaceEdit":{"documentChanges":true,"resourceOperations":["create","rename"]}}}`), &caps); err != nil {
+		t.Fatal(err)
+	}
+	if !canCreateFiles(caps) {
+		t.Fatalf("expected file creation with the create operation")
+	}
+}
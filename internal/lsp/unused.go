@@ -0,0 +1,249 @@
+package lsp
+
+import (
+	"strings"
+
+	ppi "github.com/skaji/go-ppi"
+	"github.com/skaji/perl-language-server/internal/analysis"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// unusedSymbols returns the unused lexicals, imports and private subs of a
+// document.
+func unusedSymbols(doc *ppi.Document) []analysis.Unused {
+	out := analysis.UnusedVariables(doc)
+	out = append(out, unusedImports(doc)...)
+	return append(out, analysis.UnusedPrivateSubs(doc)...)
+}
+
+// toUnusedDiagnostics reports unused symbols as hints tagged Unnecessary,
+// which editors show faded out.
+func toUnusedDiagnostics(text string, doc *ppi.Document) []protocol.Diagnostic {
+	unused := unusedSymbols(doc)
+	if len(unused) == 0 {
+		return nil
+	}
+	out := make([]protocol.Diagnostic, 0, len(unused))
+	for _, u := range unused {
+		out = append(out, unusedDiagnostic(text, u))
+	}
+	return out
+}
+
+func unusedDiagnostic(text string, u analysis.Unused) protocol.Diagnostic {
+	source := "perl-lsp"
+	sev := protocol.DiagnosticSeverityHint
+	return protocol.Diagnostic{
+		Range:    offsetRange(text, u.Start, u.End),
+		Severity: &sev,
+		Source:   &source,
+		Message:  u.Message,
+		Tags:     []protocol.DiagnosticTag{protocol.DiagnosticTagUnnecessary},
+	}
+}
+
+// codeAction offers to remove the unused symbols, to fix the module
+// hygiene problems and to add missing modules to the cpanfile in the
+// requested range.
+func (s *Server) codeAction(_ *glsp.Context, params *protocol.CodeActionParams) (any, error) {
+	s.logger.Debug("codeAction", "uri", params.TextDocument.URI)
+	doc, ok := s.docs.get(string(params.TextDocument.URI))
+	if !ok || doc.parsed == nil {
+		return nil, nil
+	}
+	actions := unusedCodeActions(params.TextDocument.URI, doc.text, doc.parsed, params.Range)
+	actions = append(actions, s.hygieneCodeActions(params.TextDocument.URI, doc, params.Range)...)
+	return append(actions, s.cpanfileCodeActions(params.TextDocument.URI, doc, params.Range)...), nil
+}
+
+func unusedCodeActions(uri protocol.DocumentUri, text string, doc *ppi.Document, rng protocol.Range) []protocol.CodeAction {
+	var out []protocol.CodeAction
+	kind := protocol.CodeActionKindQuickFix
+	for _, u := range unusedSymbols(doc) {
+		if u.Fix == nil {
+			continue
+		}
+		diag := unusedDiagnostic(text, u)
+		if comparePosition(diag.Range.End, rng.Start) < 0 || comparePosition(rng.End, diag.Range.Start) < 0 {
+			continue
+		}
+		out = append(out, protocol.CodeAction{
+			Title:       "Remove unused " + u.Kind + " " + u.Name,
+			Kind:        &kind,
+			Diagnostics: []protocol.Diagnostic{diag},
+			Edit: &protocol.WorkspaceEdit{Changes: map[protocol.DocumentUri][]protocol.TextEdit{
+				uri: {{Range: offsetRange(text, u.Fix.Start, u.Fix.End), NewText: u.Fix.NewText}},
+			}},
+		})
+	}
+	return out
+}
+
+// importItem is a name in the import list of a use statement. start and
+// end span the name; removeStart and removeEnd the text to delete with it.
+type importItem struct {
+	name                   string
+	start, end             int
+	removeStart, removeEnd int
+}
+
+// unusedImports reports the subs imported by "use Foo qw(a b)" or
+// "use Foo 'a', 'b'" that the document never mentions. Pragmas, class
+// builders such as Mojo::Base, tags and variables are not checked.
+func unusedImports(doc *ppi.Document) []analysis.Unused {
+	if doc == nil || doc.Root == nil {
+		return nil
+	}
+	imports := collectUseImports(doc.Root)
+	if len(imports) == 0 {
+		return nil
+	}
+	mentioned := mentionedNames(doc)
+	var out []analysis.Unused
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Kind != "statement::include" || strings.ToLower(n.Keyword) != "use" {
+			return
+		}
+		names := imports[n.Name]
+		if len(names) == 0 || n.Name[0] < 'A' || n.Name[0] > 'Z' || analysis.IsBuilderUse(n) {
+			return
+		}
+		items := importItems(doc.Source, n)
+		for _, item := range items {
+			if _, ok := names[item.name]; !ok || item.name == "import" || mentioned[item.name] {
+				continue
+			}
+			fix := analysis.Edit{Start: item.removeStart, End: item.removeEnd}
+			if len(items) == 1 && importCount(n) == 1 {
+				start, end := analysis.StatementSpan(doc.Source, n)
+				fix.Start, fix.End = analysis.RemovalRange(doc.Source, start, end)
+			}
+			out = append(out, analysis.Unused{
+				Kind:    "import",
+				Name:    item.name,
+				Message: item.name + " is imported from " + n.Name + " but never used",
+				Start:   item.start,
+				End:     item.end,
+				Fix:     &fix,
+			})
+		}
+	})
+	return out
+}
+
+// importCount returns the number of items in the import list of n.
+func importCount(n *ppi.Node) int {
+	if len(n.ImportItems) > 0 {
+		return len(n.ImportItems)
+	}
+	return len(importItemsFromArgs(n.Args))
+}
+
+// importItems returns the sub names of the qw lists and quoted strings of
+// a use statement. The options after a ":config" tag, as Getopt::Long
+// takes them, are not names.
+func importItems(source string, n *ppi.Node) []importItem {
+	var items []importItem
+	for i, tok := range n.Tokens {
+		switch tok.Type {
+		case ppi.TokenQuote:
+			if next := nextNonTriviaTokenLocal(n.Tokens, i+1); next >= 0 && n.Tokens[next].Value == "=>" {
+				continue
+			}
+			name := strings.Trim(tok.Value, "\"'")
+			if !isIdent(name) {
+				continue
+			}
+			start, end := tok.Start, tok.End
+			if next := nextNonTriviaTokenLocal(n.Tokens, i+1); next >= 0 && n.Tokens[next].Value == "," {
+				end = n.Tokens[next].End
+				for end < len(source) && (source[end] == ' ' || source[end] == '\t') {
+					end++
+				}
+			} else if prev := prevNonTriviaToken(n.Tokens, i-1); prev >= 0 && n.Tokens[prev].Value == "," {
+				start = n.Tokens[prev].Start
+			}
+			items = append(items, importItem{name: name, start: tok.Start + 1, end: tok.End - 1, removeStart: start, removeEnd: end})
+		case ppi.TokenQuoteLike:
+			if !strings.HasPrefix(tok.Value, "qw") || len(tok.Value) < 4 {
+				continue
+			}
+			items = append(items, qwItems(tok)...)
+		}
+	}
+	return items
+}
+
+// qwItems returns the names of a qw list. Removing a name takes the space
+// after it, or before it for the last one.
+func qwItems(tok ppi.Token) []importItem {
+	body := tok.Value[3 : len(tok.Value)-1]
+	base := tok.Start + 3
+	var items []importItem
+	for i := 0; i < len(body); {
+		if analysis.IsSpace(body[i]) {
+			i++
+			continue
+		}
+		start := i
+		for i < len(body) && !analysis.IsSpace(body[i]) {
+			i++
+		}
+		word := body[start:i]
+		if word == ":config" {
+			break
+		}
+		end := i
+		for end < len(body) && analysis.IsSpace(body[end]) {
+			end++
+		}
+		removeStart := start
+		if end == len(body) {
+			end = i
+			for removeStart > 0 && analysis.IsSpace(body[removeStart-1]) {
+				removeStart--
+			}
+		}
+		if !isIdent(word) {
+			continue
+		}
+		items = append(items, importItem{
+			name:        word,
+			start:       base + start,
+			end:         base + i,
+			removeStart: base + removeStart,
+			removeEnd:   base + end,
+		})
+	}
+	return items
+}
+
+// mentionedNames returns the bare words and &subs used outside of use
+// statements. Method names after "->" and hash keys before "=>" are not
+// calls of an imported sub.
+func mentionedNames(doc *ppi.Document) map[string]bool {
+	out := make(map[string]bool)
+	walkNodes(doc.Root, func(n *ppi.Node) {
+		if n == nil || n.Type != ppi.NodeStatement || (n.Kind == "statement::include" && strings.ToLower(n.Keyword) == "use") {
+			return
+		}
+		for i, tok := range n.Tokens {
+			switch tok.Type {
+			case ppi.TokenWord:
+				if prev := prevNonTriviaToken(n.Tokens, i-1); prev >= 0 && n.Tokens[prev].Value == "->" {
+					continue
+				}
+				if next := nextNonTriviaTokenLocal(n.Tokens, i+1); next >= 0 && n.Tokens[next].Value == "=>" {
+					continue
+				}
+				out[tok.Value] = true
+			case ppi.TokenSymbol:
+				if name, ok := strings.CutPrefix(tok.Value, "&"); ok {
+					out[name] = true
+				}
+			}
+		}
+	})
+	return out
+}
@@ -0,0 +1,75 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestUnusedDiagnosticsAndCodeActions(t *testing.T) {
+	s := NewServer(slog.New(slog.NewTextHandler(io.Discard, nil)), "test")
+	src := `package Foo;
+use strict;
+use warnings;
+use List::Util qw(first max sum);
+use Scalar::Util 'blessed';
+use POSIX qw(floor);
+sub total { my $unused = 1; return sum(@_) + max(@_) + floor(1) }
+sub _helper { 1 }
+1;
+`
+	uri := protocol.DocumentUri("file:///unused.pl")
+	d := s.docs.set(string(uri), src, nil)
+
+	var got []string
+	for _, diag := range toUnusedDiagnostics(d.text, d.parsed) {
+		if *diag.Severity != protocol.DiagnosticSeverityHint || len(diag.Tags) != 1 || diag.Tags[0] != protocol.DiagnosticTagUnnecessary {
+			t.Fatalf("unexpected diagnostic: %+v", diag)
+		}
+		got = append(got, diag.Message)
+	}
+	want := []string{
+		"$unused is declared but never used",
+		"first is imported from List::Util but never used",
+		"blessed is imported from Scalar::Util but never used",
+		"sub _helper is never called in package Foo",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("expected\n%s\ngot\n%s", strings.Join(want, "\n"), strings.Join(got, "\n"))
+	}
+
+	apply := func(line int) string {
+		rng := protocol.Range{Start: protocol.Position{Line: protocol.UInteger(line)}, End: protocol.Position{Line: protocol.UInteger(line), Character: 80}}
+		actions := unusedCodeActions(uri, d.text, d.parsed, rng)
+		if len(actions) != 1 {
+			t.Fatalf("expected one action on line %d, got %+v", line, actions)
+		}
+		if actions[0].Kind == nil || *actions[0].Kind != protocol.CodeActionKindQuickFix {
+			t.Fatalf("unexpected action kind: %+v", actions[0])
+		}
+		edit := actions[0].Edit.Changes[uri][0]
+		start := edit.Range.Start.IndexIn(src)
+		end := edit.Range.End.IndexIn(src)
+		return src[:start] + edit.NewText + src[end:]
+	}
+	if out := apply(3); !strings.Contains(out, "use List::Util qw(max sum);\n") {
+		t.Fatalf("unexpected import fix:\n%s", out)
+	}
+	if out := apply(4); strings.Contains(out, "Scalar::Util") || !strings.Contains(out, "qw(first max sum);\nuse POSIX") {
+		t.Fatalf("unexpected statement fix:\n%s", out)
+	}
+	if out := apply(6); !strings.Contains(out, "sub total { return sum") {
+		t.Fatalf("unexpected variable fix:\n%s", out)
+	}
+	if out := apply(7); !strings.Contains(out, "}\n1;\n") {
+		t.Fatalf("unexpected sub fix:\n%s", out)
+	}
+
+	mojo := s.docs.set(string(uri), "package App;\nuse Mojo::Base 'Mojolicious', -signatures;\n1;\n", nil)
+	if diags := toUnusedDiagnostics(mojo.text, mojo.parsed); len(diags) != 0 {
+		t.Fatalf("expected no diagnostics for a Mojo::Base parent, got %+v", diags)
+	}
+}
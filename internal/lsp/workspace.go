@@ -0,0 +1,255 @@
+package lsp
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	"github.com/tliron/glsp"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+// workspaceFolder holds the state of one workspace folder: its settings,
+// module search roots and the workspace index built from them.
+// Fields are guarded by Server.workspaceMu.
+type workspaceFolder struct {
+	root     string
+	config   config
+	perl     perlEnv
+	libRoots []string
+	incRoots []string
+	// incShared is set when another folder with the same perl already
+	// indexes @INC eagerly; this folder then indexes it lazily.
+	incShared   bool
+	extraRoots  map[string]struct{}
+	index       *analysis.WorkspaceIndex
+	buildID     uint64
+	buildCancel context.CancelFunc
+}
+
+// indexRoots returns the workspace roots the folder index walks.
+// @INC roots are passed separately through indexOptions.
+func (f *workspaceFolder) indexRoots() []string {
+	roots := append([]string{}, f.libRoots...)
+	extra := make([]string, 0, len(f.extraRoots))
+	for p := range f.extraRoots {
+		extra = append(extra, p)
+	}
+	sort.Strings(extra)
+	roots = append(roots, extra...)
+	return uniqueStrings(roots)
+}
+
+func (f *workspaceFolder) indexOptions() analysis.IndexOptions {
+	opts := analysis.IndexOptions{
+		CacheSize:   f.config.LazyCacheSize,
+		MaxFileSize: f.config.MaxIndexFileSize,
+		MaxFiles:    f.config.MaxIndexFiles,
+		Exclude:     f.config.exclude(),
+		ExcludeBase: f.root,
+	}
+	for _, dir := range f.config.sigPaths() {
+		if !filepath.IsAbs(dir) {
+			if f.root == "" {
+				continue
+			}
+			dir = filepath.Join(f.root, dir)
+		}
+		opts.SigRoots = append(opts.SigRoots, dir)
+	}
+	if f.config.lazyINC() || f.incShared {
+		opts.LazyRoots = append([]string{}, f.incRoots...)
+	} else {
+		opts.INCRoots = append([]string{}, f.incRoots...)
+	}
+	return opts
+}
+
+func (s *Server) newWorkspaceFolder(root string) *workspaceFolder {
+	cfg, err := loadFolderConfig(root)
+	if err != nil {
+		s.logger.Debug("folder config load failed", "root", root, "error", err)
+	}
+	s.workspaceMu.RLock()
+	cfg = s.settings.merge(cfg)
+	s.workspaceMu.RUnlock()
+
+	env := detectPerlEnv(root, cfg.Perl, os.Getenv)
+	s.logger.Debug("perl detected", "root", root, "perl", env.perl, "source", env.source, "libDirs", env.libDirs)
+	libRoots := append(defaultLibRoots(root, cfg.libDirs()), env.libDirs...)
+	return &workspaceFolder{
+		root:       root,
+		config:     cfg,
+		perl:       env,
+		libRoots:   filterExistingRoots(uniqueStrings(libRoots), s.logger),
+		incRoots:   s.perlINC(env.perl),
+		extraRoots: make(map[string]struct{}),
+	}
+}
+
+// perlForPath returns the perl interpreter of the folder that owns path.
+func (s *Server) perlForPath(path string) string {
+	s.workspaceMu.RLock()
+	defer s.workspaceMu.RUnlock()
+	if folder := s.folderForPathLocked(path); folder != nil && folder.perl.perl != "" {
+		return folder.perl.perl
+	}
+	return defaultPerl
+}
+
+// perlINC returns the @INC of perl. Each perl is run once and its @INC,
+// or the failure to get it, is shared by all folders.
+func (s *Server) perlINC(perl string) []string {
+	if perl == "" {
+		perl = defaultPerl
+	}
+	s.incMu.Lock()
+	defer s.incMu.Unlock()
+	if roots, ok := s.incCache[perl]; ok {
+		return roots
+	}
+	roots, err := perlINCPaths(perl)
+	if err != nil {
+		s.logger.Debug("perl @INC lookup failed", "perl", perl, "error", err)
+	}
+	if s.incCache == nil {
+		s.incCache = make(map[string][]string)
+	}
+	s.incCache[perl] = roots
+	return roots
+}
+
+// folderForPathLocked returns the folder that owns path, looked up in this
+// order:
+//  1. the innermost folder whose root contains path;
+//  2. the rootless folder, which exists when the client opened no
+//     workspace;
+//  3. the first folder the client listed.
+//
+// The caller must hold workspaceMu.
+func (s *Server) folderForPathLocked(path string) *workspaceFolder {
+	if len(s.folders) == 0 {
+		return nil
+	}
+	path = filepath.Clean(path)
+	var best, rootless *workspaceFolder
+	for _, f := range s.folders {
+		if f.root == "" {
+			if rootless == nil {
+				rootless = f
+			}
+			continue
+		}
+		root := filepath.Clean(f.root)
+		if path == root || strings.HasPrefix(path, root+string(os.PathSeparator)) {
+			if best == nil || len(root) > len(filepath.Clean(best.root)) {
+				best = f
+			}
+		}
+	}
+	if best != nil {
+		return best
+	}
+	if rootless != nil {
+		return rootless
+	}
+	return s.folders[0]
+}
+
+// workspaceIndexFor returns the index of the folder that owns uri.
+func (s *Server) workspaceIndexFor(uri protocol.DocumentUri) *analysis.WorkspaceIndex {
+	path, _ := uriToPath(uri)
+	s.workspaceMu.RLock()
+	defer s.workspaceMu.RUnlock()
+	f := s.folderForPathLocked(path)
+	if f == nil {
+		return nil
+	}
+	return f.index
+}
+
+func (s *Server) addWorkspaceFolder(root string, reason string) {
+	folder := s.newWorkspaceFolder(root)
+	s.workspaceMu.Lock()
+	for _, f := range s.folders {
+		if f.root == root {
+			s.workspaceMu.Unlock()
+			return
+		}
+	}
+	folder.incShared = s.eagerINCFolderLocked(folder.perl.perl) != nil
+	s.folders = append(s.folders, folder)
+	s.workspaceMu.Unlock()
+
+	s.logger.Debug("workspace folder added", "root", root, "libRoots", folder.libRoots)
+	s.startWorkspaceIndexBuild(folder, reason)
+}
+
+// eagerINCFolderLocked returns the folder that indexes the @INC of perl
+// eagerly, or nil. Only the first folder of each perl does, so that @INC is
+// not walked once per folder. The caller must hold workspaceMu.
+func (s *Server) eagerINCFolderLocked(perl string) *workspaceFolder {
+	for _, f := range s.folders {
+		if f.perl.perl == perl && !f.config.lazyINC() && !f.incShared && len(f.incRoots) > 0 {
+			return f
+		}
+	}
+	return nil
+}
+
+func (s *Server) removeWorkspaceFolder(root string) {
+	s.workspaceMu.Lock()
+	defer s.workspaceMu.Unlock()
+	for i, f := range s.folders {
+		if f.root != root {
+			continue
+		}
+		if f.buildCancel != nil {
+			f.buildCancel()
+			f.buildCancel = nil
+		}
+		s.folders = append(s.folders[:i], s.folders[i+1:]...)
+		s.logger.Debug("workspace folder removed", "root", root)
+		return
+	}
+}
+
+func (s *Server) didChangeWorkspaceFolders(_ *glsp.Context, params *protocol.DidChangeWorkspaceFoldersParams) error {
+	s.logger.Debug("didChangeWorkspaceFolders", "added", len(params.Event.Added), "removed", len(params.Event.Removed))
+	for _, folder := range params.Event.Removed {
+		if path, ok := uriToPath(folder.URI); ok {
+			s.removeWorkspaceFolder(path)
+		}
+	}
+	for _, folder := range params.Event.Added {
+		if path, ok := uriToPath(folder.URI); ok {
+			s.addWorkspaceFolder(path, "folder added")
+		}
+	}
+	return nil
+}
+
+func (s *Server) didChangeConfiguration(_ *glsp.Context, params *protocol.DidChangeConfigurationParams) error {
+	s.logger.Debug("didChangeConfiguration")
+	settings, err := parseConfig(params.Settings)
+	if err != nil {
+		s.logger.Debug("configuration ignored", "error", err)
+		return nil
+	}
+	s.workspaceMu.Lock()
+	s.settings = settings
+	roots := make([]string, 0, len(s.folders))
+	for _, f := range s.folders {
+		roots = append(roots, f.root)
+	}
+	s.workspaceMu.Unlock()
+
+	for _, root := range roots {
+		s.removeWorkspaceFolder(root)
+		s.addWorkspaceFolder(root, "configuration")
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+package lsp
+
+import (
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/skaji/perl-language-server/internal/analysis"
+	protocol "github.com/tliron/glsp/protocol_3_16"
+)
+
+func TestWorkspaceFoldersAreIsolated(t *testing.T) {
+	tmp := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	for _, name := range []string{"a", "b"} {
+		root := filepath.Join(tmp, name)
+		writeFile(t, filepath.Join(root, "lib", "Foo", "Bar.pm"), "package Foo::Bar;\nsub "+name+"_only {}\n1;\n")
+		lib := filepath.Join(root, "lib")
+		index, err := analysis.BuildWorkspaceIndex([]string{lib})
+		if err != nil {
+			t.Fatalf("workspace index: %v", err)
+		}
+		s.folders = append(s.folders, &workspaceFolder{root: root, libRoots: []string{lib}, index: index})
+	}
+
+	uriA := protocol.DocumentUri(fileURI(filepath.Join(tmp, "a", "script.pl")))
+	defs, err := s.findWorkspaceDefinitions("Foo::Bar", uriA, "main", nil, true)
+	if err != nil {
+		t.Fatalf("findWorkspaceDefinitions: %v", err)
+	}
+	if len(defs) != 1 || defs[0].File != filepath.Join(tmp, "a", "lib", "Foo", "Bar.pm") {
+		t.Fatalf("expected only folder a definition, got %+v", defs)
+	}
+	if methods := s.methodsForPackageWorkspace("Foo::Bar", uriA); len(methods) != 1 || methods[0] != "a_only" {
+		t.Fatalf("expected a_only, got %v", methods)
+	}
+
+	pathB := filepath.Join(tmp, "b", "t", "basic.t")
+	paths := s.compileIncludePathsWithBase(nil, pathB, "")
+	if len(paths) != 1 || paths[0] != filepath.Join(tmp, "b", "lib") {
+		t.Fatalf("expected folder b lib only, got %v", paths)
+	}
+
+	s.removeWorkspaceFolder(filepath.Join(tmp, "a"))
+	if len(s.folders) != 1 || s.folders[0].root != filepath.Join(tmp, "b") {
+		t.Fatalf("expected folder b to remain, got %d folders", len(s.folders))
+	}
+}
+
+func TestFolderConfigOverridesLibDirs(t *testing.T) {
+	root := t.TempDir()
+	writeFile(t, filepath.Join(root, folderConfigFile), `{"libDirs": ["src/perl"]}`)
+	if err := os.MkdirAll(filepath.Join(root, "src", "perl"), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	s.settings = config{LibDirs: []string{"lib"}}
+
+	folder := s.newWorkspaceFolder(root)
+	if len(folder.libRoots) != 1 || folder.libRoots[0] != filepath.Join(root, "src", "perl") {
+		t.Fatalf("expected src/perl lib root, got %v", folder.libRoots)
+	}
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+}
+
+func TestFolderForPathFallbackOrder(t *testing.T) {
+	tmp := t.TempDir()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	a := &workspaceFolder{root: filepath.Join(tmp, "a")}
+	nested := &workspaceFolder{root: filepath.Join(tmp, "a", "nested")}
+	rootless := &workspaceFolder{}
+	s.folders = []*workspaceFolder{a, nested}
+	if got := s.folderForPathLocked(filepath.Join(tmp, "a", "nested", "x.pl")); got != nested {
+		t.Fatalf("expected the innermost folder, got %+v", got)
+	}
+	if got := s.folderForPathLocked(filepath.Join(tmp, "elsewhere.pl")); got != a {
+		t.Fatalf("expected the first folder, got %+v", got)
+	}
+	s.folders = []*workspaceFolder{a, rootless}
+	if got := s.folderForPathLocked(filepath.Join(tmp, "elsewhere.pl")); got != rootless {
+		t.Fatalf("expected the rootless folder, got %+v", got)
+	}
+	if got := s.folderForPathLocked(filepath.Join(tmp, "a", "x.pl")); got != a {
+		t.Fatalf("expected folder a, got %+v", got)
+	}
+}
+
+func TestPerlINCIsSharedAcrossFolders(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	s.incCache = map[string][]string{"/opt/perl/bin/perl": {"/opt/perl/lib"}, "/missing/perl": nil}
+	if got := s.perlINC("/opt/perl/bin/perl"); len(got) != 1 || got[0] != "/opt/perl/lib" {
+		t.Fatalf("expected cached @INC, got %v", got)
+	}
+	if got := s.perlINC("/missing/perl"); got != nil {
+		t.Fatalf("expected the failed lookup to stay cached, got %v", got)
+	}
+
+	first := &workspaceFolder{root: "/a", perl: perlEnv{perl: "/opt/perl/bin/perl"}, incRoots: []string{"/opt/perl/lib"}}
+	s.folders = []*workspaceFolder{first}
+	if got := s.eagerINCFolderLocked("/opt/perl/bin/perl"); got != first {
+		t.Fatalf("expected the first folder to index @INC, got %+v", got)
+	}
+	if got := s.eagerINCFolderLocked("/other/perl"); got != nil {
+		t.Fatalf("expected no folder for another perl, got %+v", got)
+	}
+	second := &workspaceFolder{root: "/b", perl: first.perl, incRoots: first.incRoots, incShared: true}
+	if opts := second.indexOptions(); len(opts.INCRoots) != 0 || len(opts.LazyRoots) != 1 {
+		t.Fatalf("expected lazy @INC for a shared perl, got %+v", opts)
+	}
+	if opts := first.indexOptions(); len(opts.INCRoots) != 1 || len(opts.LazyRoots) != 0 {
+		t.Fatalf("expected eager @INC for the first folder, got %+v", opts)
+	}
+}
+
+func TestIncRootsForPathUsesPerlINCCache(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewServer(logger, "test")
+	s.incCache = map[string][]string{"/opt/perl/bin/perl": {"/opt/perl/lib"}, "/missing/perl": nil}
+	s.folders = []*workspaceFolder{
+		{root: "/a", perl: perlEnv{perl: "/opt/perl/bin/perl"}},
+		{root: "/b", perl: perlEnv{perl: "/missing/perl"}},
+	}
+	if got := s.incRootsForPath("/a/lib/Foo.pm"); len(got) != 1 || got[0] != "/opt/perl/lib" {
+		t.Fatalf("expected the cached @INC, got %v", got)
+	}
+	if got := s.incRootsForPath("/b/lib/Foo.pm"); got != nil {
+		t.Fatalf("expected the failed lookup to stay cached, got %v", got)
+	}
+}